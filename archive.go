@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+)
+
+var (
+	conflictPolicy = flag.String("conflict", "keep", "import policy for chunks saved in both archive and db: keep, replace or merge")
+)
+
+// archivePath returns the archive file argument, - is stdin or stdout
+func archivePath() (string, error) {
+	if flag.NArg() != 1 {
+		return "", errors.New("need one archive file argument, - for stdin or stdout")
+	}
+	return flag.Arg(0), nil
+}
+
+// exportWorld writes the world in -db to the archive file.
+// The db is opened read only, it must have been played once by this version
+func exportWorld() error {
+	path, err := archivePath()
+	if err != nil {
+		return err
+	}
+	if err := InitReadOnlyStore(); err != nil {
+		return err
+	}
+	defer GlobalStore.Close()
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	err = GlobalStore.Export(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("export error:%s", err)
+	}
+	log.Printf("world exported to %s", path)
+	return nil
+}
+
+// importWorld reads the archive file into the world in -db
+func importWorld() error {
+	path, err := archivePath()
+	if err != nil {
+		return err
+	}
+	policy, err := ParseConflictPolicy(*conflictPolicy)
+	if err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// the generator comes from the archive if the world is new
+	if err := InitStore(); err != nil {
+		return err
+	}
+	defer GlobalStore.Close()
+	stats, err := GlobalStore.Import(bufio.NewReader(in), policy)
+	if err != nil {
+		return fmt.Errorf("import error after %d chunks:%s", stats.Chunks, err)
+	}
+	log.Printf("%d chunks imported, %d were saved already and are resolved by %s", stats.Chunks, stats.Conflicts, policy)
+	return nil
+}
@@ -5,43 +5,41 @@ import (
 )
 
 func NewStoreMock() *StoreMock {
-	return &StoreMock{chunkBlocks: make(map[ChunkID][]BlockType)}
+	return &StoreMock{chunkBlocks: make(map[ChunkID]map[BlockID]BlockType)}
 }
 
 type StoreMock struct {
-	chunkBlocks map[ChunkID][]BlockType
+	chunkBlocks map[ChunkID]map[BlockID]BlockType
 }
 
 func (st *StoreMock) Add(bid BlockID, bt BlockType) {
 	cid := bid.ChunkID()
 	blocks, ok := st.chunkBlocks[cid]
 	if !ok {
-		blocks = make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+		blocks = make(map[BlockID]BlockType)
 		st.chunkBlocks[cid] = blocks
 	}
 
-	blocks[bid.ToIndex()] = bt
+	blocks[bid] = bt
 }
 
-func (st *StoreMock) ChunkBlocks(cid ChunkID) ([]BlockType, error) {
-	var blocks []BlockType
-	blocks, ok := st.chunkBlocks[cid]
-	if !ok {
-		return nil, nil
-	}
-
-	return blocks, nil
+func (st *StoreMock) UpdateBlock(bid BlockID, bt BlockType) error {
+	st.Add(bid, bt)
+	return nil
 }
 
-// func (st *StoreMock) RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error {
-// 	bs, ok := st.chunkBlocks[id]
-// 	if !ok {
-// 		return nil
-// 	}
-
-// 	for _, b := range bs {
-// 		f(b.bid, b.bt)
-// 	}
+func (st *StoreMock) UpdateBlocks(edits map[ChunkID]map[BlockID]BlockType) error {
+	for _, blocks := range edits {
+		for bid, bt := range blocks {
+			st.Add(bid, bt)
+		}
+	}
+	return nil
+}
 
-// 	return nil
-// }
+func (st *StoreMock) RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error {
+	for bid, bt := range st.chunkBlocks[id] {
+		f(bid, bt)
+	}
+	return nil
+}
@@ -14,8 +14,11 @@ func TestStoreMock(t *testing.T) {
 	bidA := BlockID{X: 0, Y: 0, Z: ChunkWidth}
 	store.Add(bidA, 1)
 
-	blocks, err := store.ChunkBlocks(bidA.ChunkID())
+	blocks := make(map[BlockID]BlockType)
+	err := store.RangeBlocks(bidA.ChunkID(), func(bid BlockID, w BlockType) {
+		blocks[bid] = w
+	})
 	assert.Nil(err)
 
-	assert.Equal(BlockType(1), blocks[bidA.ToIndex()])
+	assert.Equal(map[BlockID]BlockType{bidA: 1}, blocks)
 }
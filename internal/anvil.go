@@ -0,0 +1,397 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Minecraft Anvil saves: region file r.X.Z.mca holds 32x32 chunk columns of 16x16 blocks,
+// each column is a stack of sections of 16x16x16 blocks
+const (
+	anvilSectionWidth  = 16
+	anvilSectionBlocks = anvilSectionWidth * anvilSectionWidth * anvilSectionWidth
+	anvilRegionWidth   = 32
+	anvilRegionChunks  = anvilRegionWidth * anvilRegionWidth
+	anvilSectorSize    = 4096
+
+	// compression of chunks
+	anvilGzip     = 1
+	anvilZlib     = 2
+	anvilRaw      = 3
+	anvilExternal = 128 // flag of chunks too large for the region file, saved in c.X.Z.mcc
+
+	// 1.16 stopped indexes spanning two longs of block states
+	anvilNoSpanVersion = 2529
+	// 1.20.1, chunks are written as this version
+	anvilDataVersion = 3465
+	// sections Minecraft 1.18 and later keep, y -64 to 319
+	anvilMinSection = -4
+	anvilMaxSection = 19
+)
+
+// anvilState : Minecraft block state, like minecraft:oak_log with axis=y
+type anvilState struct {
+	Name       string
+	Properties map[string]string
+}
+
+// String returns the state as Minecraft writes it, name[key=value,...]
+func (s anvilState) String() string {
+	if len(s.Properties) == 0 {
+		return s.Name
+	}
+	props := make([]string, 0, len(s.Properties))
+	for k, v := range s.Properties {
+		props = append(props, k+"="+v)
+	}
+	sort.Strings(props)
+	return s.Name + "[" + strings.Join(props, ",") + "]"
+}
+
+// parseAnvilStateString parses a state written by String
+func parseAnvilStateString(s string) (anvilState, error) {
+	state := anvilState{Name: s}
+	i := strings.IndexByte(s, '[')
+	if i < 0 {
+		return state, nil
+	}
+	if !strings.HasSuffix(s, "]") {
+		return state, fmt.Errorf("bad block state %q", s)
+	}
+	state.Name = s[:i]
+	state.Properties = make(map[string]string)
+	for _, prop := range strings.Split(s[i+1:len(s)-1], ",") {
+		kv := strings.SplitN(prop, "=", 2)
+		if len(kv) != 2 {
+			return state, fmt.Errorf("bad block state %q", s)
+		}
+		state.Properties[kv[0]] = kv[1]
+	}
+	return state, nil
+}
+
+// anvilSection : blocks of section Y of a chunk as indexes into palette,
+// index (y*16+z)*16+x is block x, y, z of the section, indexes is nil if all blocks are palette[0]
+type anvilSection struct {
+	Y       int
+	palette []anvilState
+	indexes []uint16
+}
+
+func (s *anvilSection) state(i int) int {
+	if s.indexes == nil {
+		return 0
+	}
+	return int(s.indexes[i])
+}
+
+// anvilChunk : chunk column X, Z counted in chunks
+type anvilChunk struct {
+	X, Z     int
+	sections []anvilSection
+}
+
+// anvilRegion : chunks of a region file, as saved with their compression type first,
+// index x+z*32 is chunk x, z of the region, nil if not saved
+type anvilRegion [anvilRegionChunks][]byte
+
+// parseAnvilRegion splits region file data into chunks
+func parseAnvilRegion(data []byte) (*anvilRegion, error) {
+	r := new(anvilRegion)
+	if len(data) == 0 {
+		// Minecraft leaves empty files of regions it never saved a chunk to
+		return r, nil
+	}
+	if len(data) < 2*anvilSectorSize {
+		return nil, fmt.Errorf("region file of %d bytes has no header", len(data))
+	}
+	for i := range r {
+		loc := binary.BigEndian.Uint32(data[i*4:])
+		if loc == 0 {
+			continue
+		}
+		start := int(loc>>8) * anvilSectorSize
+		if start < 2*anvilSectorSize || start+5 > len(data) {
+			return nil, fmt.Errorf("chunk %d at bad offset %d", i, start)
+		}
+		n := int(binary.BigEndian.Uint32(data[start:]))
+		if n < 1 || start+4+n > len(data) {
+			return nil, fmt.Errorf("chunk %d has bad length %d", i, n)
+		}
+		r[i] = data[start+4 : start+4+n]
+	}
+	return r, nil
+}
+
+// chunk decodes chunk i
+func (r *anvilRegion) chunk(i int) (nbtCompound, error) {
+	payload := r[i]
+	var zr io.Reader
+	var err error
+	switch payload[0] {
+	case anvilGzip:
+		zr, err = gzip.NewReader(bytes.NewReader(payload[1:]))
+	case anvilZlib:
+		zr, err = zlib.NewReader(bytes.NewReader(payload[1:]))
+	case anvilRaw:
+		zr = bytes.NewReader(payload[1:])
+	default:
+		if payload[0]&anvilExternal != 0 {
+			return nil, errors.New("chunk is saved in a .mcc file, which is not supported")
+		}
+		return nil, fmt.Errorf("unknown chunk compression %d", payload[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNBT(b)
+}
+
+// setChunk saves root as chunk i
+func (r *anvilRegion) setChunk(i int, root nbtCompound) error {
+	b, err := encodeNBT(root)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer([]byte{anvilZlib})
+	zw := zlib.NewWriter(buf)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	r[i] = buf.Bytes()
+	return nil
+}
+
+// write writes r as a region file, each chunk starts at a sector of 4 KiB
+func (r *anvilRegion) write(w io.Writer) error {
+	header := make([]byte, 2*anvilSectorSize)
+	var body bytes.Buffer
+	now := uint32(time.Now().Unix())
+	sector := 2
+	for i, payload := range r {
+		if payload == nil {
+			continue
+		}
+		n := (4 + len(payload) + anvilSectorSize - 1) / anvilSectorSize
+		if n > 255 {
+			return fmt.Errorf("chunk %d of %d bytes is too large for a region file", i, len(payload))
+		}
+		binary.BigEndian.PutUint32(header[i*4:], uint32(sector<<8|n))
+		binary.BigEndian.PutUint32(header[anvilSectorSize+i*4:], now)
+
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+		body.Write(length[:])
+		body.Write(payload)
+		body.Write(make([]byte, n*anvilSectorSize-4-len(payload)))
+		sector += n
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := body.WriteTo(w)
+	return err
+}
+
+// nbtInt returns integer tag v of any size
+func nbtInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// parseAnvilChunk reads block sections of chunk column x, z,
+// saved by Minecraft 1.18 and later, or by 1.13 to 1.17 under Level
+func parseAnvilChunk(root nbtCompound, x, z int) (*anvilChunk, error) {
+	version, _ := nbtInt(root["DataVersion"])
+	sections, ok := root["sections"].(nbtList)
+	paletteKey, statesKey := "palette", "data"
+	legacy := !ok
+	if legacy {
+		level, _ := root["Level"].(nbtCompound)
+		sections, _ = level["Sections"].(nbtList)
+		paletteKey, statesKey = "Palette", "BlockStates"
+	}
+
+	c := &anvilChunk{X: x, Z: z}
+	for _, v := range sections {
+		s, ok := v.(nbtCompound)
+		if !ok {
+			return nil, errors.New("section is not a compound")
+		}
+		y, ok := nbtInt(s["Y"])
+		if !ok {
+			return nil, errors.New("section without Y")
+		}
+		states := s
+		if !legacy {
+			states, _ = s["block_states"].(nbtCompound)
+		}
+		palette, ok := states[paletteKey].(nbtList)
+		if !ok || len(palette) == 0 {
+			if _, ok := s["Blocks"]; ok {
+				return nil, errors.New("numeric block ids of Minecraft before 1.13 are not supported")
+			}
+			// sections of light only
+			continue
+		}
+
+		section := anvilSection{Y: y, palette: make([]anvilState, len(palette))}
+		for i, p := range palette {
+			state, err := parseAnvilState(p)
+			if err != nil {
+				return nil, fmt.Errorf("section %d: %s", y, err)
+			}
+			section.palette[i] = state
+		}
+		if data, ok := states[statesKey].([]int64); ok && len(palette) > 1 {
+			var err error
+			section.indexes, err = unpackAnvilIndexes(data, len(palette), version < anvilNoSpanVersion)
+			if err != nil {
+				return nil, fmt.Errorf("section %d: %s", y, err)
+			}
+		}
+		c.sections = append(c.sections, section)
+	}
+	return c, nil
+}
+
+func parseAnvilState(v interface{}) (anvilState, error) {
+	var state anvilState
+	p, ok := v.(nbtCompound)
+	if !ok {
+		return state, errors.New("palette entry is not a compound")
+	}
+	state.Name, ok = p["Name"].(string)
+	if !ok {
+		return state, errors.New("palette entry without Name")
+	}
+	if props, ok := p["Properties"].(nbtCompound); ok {
+		state.Properties = make(map[string]string, len(props))
+		for k, v := range props {
+			if s, ok := v.(string); ok {
+				state.Properties[k] = s
+			}
+		}
+	}
+	return state, nil
+}
+
+// anvilIndexBits returns bits of each index into a palette of n states, 4 at least
+func anvilIndexBits(n int) int {
+	b := bits.Len(uint(n - 1))
+	if b < 4 {
+		b = 4
+	}
+	return b
+}
+
+// unpackAnvilIndexes returns palette indexes of a section packed into longs,
+// from the lowest bits up, indexes span two longs if span is set
+func unpackAnvilIndexes(data []int64, n int, span bool) ([]uint16, error) {
+	b := anvilIndexBits(n)
+	perLong := 64 / b
+	need := (anvilSectionBlocks + perLong - 1) / perLong
+	if span {
+		need = (anvilSectionBlocks*b + 63) / 64
+	}
+	if len(data) < need {
+		return nil, fmt.Errorf("%d longs of block states, need %d", len(data), need)
+	}
+
+	mask := uint64(1)<<uint(b) - 1
+	indexes := make([]uint16, anvilSectionBlocks)
+	for i := range indexes {
+		var v uint64
+		if span {
+			bit := i * b
+			word, off := bit/64, uint(bit%64)
+			v = uint64(data[word]) >> off
+			if int(off)+b > 64 {
+				v |= uint64(data[word+1]) << (64 - off)
+			}
+		} else {
+			v = uint64(data[i/perLong]) >> uint(i%perLong*b)
+		}
+		v &= mask
+		if v >= uint64(n) {
+			return nil, fmt.Errorf("palette index %d of %d states", v, n)
+		}
+		indexes[i] = uint16(v)
+	}
+	return indexes, nil
+}
+
+// packAnvilIndexes packs indexes into a palette of n states as Minecraft 1.16 and later do
+func packAnvilIndexes(indexes []uint16, n int) []int64 {
+	b := anvilIndexBits(n)
+	perLong := 64 / b
+	data := make([]int64, (len(indexes)+perLong-1)/perLong)
+	for i, v := range indexes {
+		data[i/perLong] |= int64(uint64(v) << uint(i%perLong*b))
+	}
+	return data
+}
+
+// encode returns c as saved by Minecraft 1.20, light and heightmaps are left for Minecraft to compute
+func (c *anvilChunk) encode() nbtCompound {
+	sections := nbtList{}
+	for _, s := range c.sections {
+		palette := make(nbtList, len(s.palette))
+		for i, state := range s.palette {
+			p := nbtCompound{"Name": state.Name}
+			if len(state.Properties) > 0 {
+				props := make(nbtCompound, len(state.Properties))
+				for k, v := range state.Properties {
+					props[k] = v
+				}
+				p["Properties"] = props
+			}
+			palette[i] = p
+		}
+		states := nbtCompound{"palette": palette}
+		if len(s.palette) > 1 {
+			states["data"] = packAnvilIndexes(s.indexes, len(s.palette))
+		}
+		sections = append(sections, nbtCompound{
+			"Y":            int8(s.Y),
+			"block_states": states,
+			"biomes":       nbtCompound{"palette": nbtList{"minecraft:plains"}},
+		})
+	}
+	return nbtCompound{
+		"DataVersion":    int32(anvilDataVersion),
+		"xPos":           int32(c.X),
+		"zPos":           int32(c.Z),
+		"yPos":           int32(anvilMinSection),
+		"Status":         "minecraft:full",
+		"LastUpdate":     int64(0),
+		"InhabitedTime":  int64(0),
+		"isLightOn":      int8(0),
+		"sections":       sections,
+		"block_entities": nbtList{},
+	}
+}
@@ -0,0 +1,374 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+// region files of testdata/anvil are written by fixtures.py
+
+// blocks of the seventeen states palette of the fixtures, as mapped by anvil.json
+var anvilFixtureBlocks = []string{
+	"air", "stone", "dirt", "sand", "brick", "plank", "cobble", "glass", "light_stone", "dark_stone",
+	"chest", "leaves", "snow", "cement", "grass", "cloud", "air",
+}
+
+func lookupBlock(t *testing.T, name string) BlockType {
+	w, ok := registry.Lookup(name)
+	if !ok {
+		t.Fatalf("no block %s", name)
+	}
+	return w
+}
+
+// storeOverrides returns all saved blocks of s
+func storeOverrides(t *testing.T, s *Store) map[BlockID]BlockType {
+	assert.Nil(t, s.Flush())
+	blocks := make(map[BlockID]BlockType)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).ForEach(func(k, v []byte) error {
+			overrides, err := decodeOverridesDbValue(v)
+			if err != nil {
+				return err
+			}
+			rangeOverrides(decodeChunkDbKey(k), overrides, func(bid BlockID, w BlockType) {
+				blocks[bid] = w
+			})
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+	return blocks
+}
+
+// fillAnvilSection sets blocks of section sy of chunk cx, cz in blocks to f of x, y, z in the section
+func fillAnvilSection(blocks map[BlockID]BlockType, offset BlockID, cx, sy, cz int, f func(x, y, z int) BlockType) {
+	for y := 0; y < 16; y++ {
+		for z := 0; z < 16; z++ {
+			for x := 0; x < 16; x++ {
+				blocks[BlockID{cx*16 + x + offset.X, sy*16 + y + offset.Y, cz*16 + z + offset.Z}] = f(x, y, z)
+			}
+		}
+	}
+}
+
+func readTestAnvilMapping(t *testing.T) *AnvilMapping {
+	m, err := ReadAnvilMapping("../anvil.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAnvil_Import(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	m := readTestAnvilMapping(t)
+	// not a multiple of 16, so sections straddle chunks
+	offset := BlockID{3, -50, -7}
+
+	stats, err := store.ImportAnvil("testdata/anvil/r.0.-1.mca", m, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Chunks)
+	legacy, err := store.ImportAnvil("testdata/anvil/r.-1.0.mca", m, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, legacy.Chunks)
+
+	stone, wood := lookupBlock(t, "stone"), lookupBlock(t, "wood")
+	seventeen := make([]BlockType, len(anvilFixtureBlocks))
+	for i, name := range anvilFixtureBlocks {
+		seventeen[i] = lookupBlock(t, name)
+	}
+	want := make(map[BlockID]BlockType)
+	ores, legacyOres := 0, 0
+
+	// 1.20 chunk 1, -1: stone section, section of layers and an air section
+	fillAnvilSection(want, offset, 1, 3, -1, func(x, y, z int) BlockType { return stone })
+	fillAnvilSection(want, offset, 1, 4, -1, func(x, y, z int) BlockType {
+		switch {
+		case y == 0:
+			return stone
+		case y == 1 && z == 7 && (x == 5 || x == 6):
+			// oak_log of both axes
+			return wood
+		}
+		// diamond_block at 2, 2, 3 is not mapped
+		return 0
+	})
+	fillAnvilSection(want, offset, 1, 5, -1, func(x, y, z int) BlockType { return 0 })
+	// 1.20 chunk 0, -32 with indexes of 5 bits
+	fillAnvilSection(want, offset, 0, -4, -32, func(x, y, z int) BlockType {
+		i := (x + 3*y + 5*z) % 17
+		if i == 16 {
+			ores++
+		}
+		return seventeen[i]
+	})
+	// 1.14 chunk -1, 0 with indexes spanning longs, 1.16 chunk -2, 0
+	fillAnvilSection(want, offset, -1, 0, 0, func(x, y, z int) BlockType {
+		i := (2*x + y + 7*z) % 17
+		if i == 16 {
+			legacyOres++
+		}
+		return seventeen[i]
+	})
+	fillAnvilSection(want, offset, -2, 1, 0, func(x, y, z int) BlockType { return seventeen[(x+y+z)%5] })
+
+	assert.Equal(t, want, storeOverrides(t, store))
+	assert.Equal(t, map[string]int{"minecraft:diamond_block": 1, "minecraft:diamond_ore": ores}, stats.Unmapped)
+	assert.Equal(t, map[string]int{"minecraft:diamond_ore": legacyOres}, legacy.Unmapped)
+}
+
+func TestAnvil_ImportOverEdits(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	offset := BlockID{0, -50, 0}
+	brick := lookupBlock(t, "brick")
+
+	// above the imported sections, and in the stone section
+	above, inside := BlockID{16, 100 - 50, -16}, BlockID{20, 50 - 50, -10}
+	assert.Nil(t, store.UpdateBlock(above, brick))
+	assert.Nil(t, store.UpdateBlock(inside, brick))
+	_, err := store.ImportAnvil("testdata/anvil/r.0.-1.mca", readTestAnvilMapping(t), offset)
+	assert.Nil(t, err)
+
+	blocks := storeOverrides(t, store)
+	assert.Equal(t, brick, blocks[above])
+	assert.Equal(t, lookupBlock(t, "stone"), blocks[inside])
+}
+
+func TestAnvil_ImportErrors(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	m := readTestAnvilMapping(t)
+
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile("testdata/anvil/r.0.-1.mca")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// region coordinates come from the name
+	renamed := filepath.Join(dir, "region.mca")
+	assert.Nil(t, ioutil.WriteFile(renamed, data, 0644))
+	_, err = store.ImportAnvil(renamed, m, BlockID{})
+	assert.NotNil(t, err)
+
+	// chunk data cut off
+	cut := filepath.Join(dir, "r.0.-1.mca")
+	assert.Nil(t, ioutil.WriteFile(cut, data[:len(data)-4096], 0644))
+	_, err = store.ImportAnvil(cut, m, BlockID{})
+	assert.NotNil(t, err)
+
+	// empty region files are left by Minecraft
+	empty := filepath.Join(dir, "r.5.5.mca")
+	assert.Nil(t, ioutil.WriteFile(empty, nil, 0644))
+	stats, err := store.ImportAnvil(empty, m, BlockID{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Chunks)
+}
+
+func TestAnvil_Mapping(t *testing.T) {
+	stone, wood, plank := lookupBlock(t, "stone"), lookupBlock(t, "wood"), lookupBlock(t, "plank")
+	m, err := parseAnvilMapping([]byte(`{
+		"unmapped": {"minecraft": "bedrock", "block": "stone"},
+		"blocks": [
+			{"minecraft": "oak_log", "properties": {"axis": "y"}, "block": "wood"},
+			{"minecraft": "oak_log", "block": "plank"},
+			{"minecraft": "mod:log", "block": "wood"}
+		]
+	}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for _, c := range []struct {
+		state anvilState
+		want  BlockType
+	}{
+		{anvilState{"minecraft:oak_log", map[string]string{"axis": "y"}}, wood},
+		{anvilState{"minecraft:oak_log", map[string]string{"axis": "x"}}, plank},
+		{anvilState{"minecraft:oak_log", nil}, plank},
+		{anvilState{"mod:log", nil}, wood},
+	} {
+		w, ok := m.block(c.state)
+		assert.True(t, ok, c.state.String())
+		assert.Equal(t, c.want, w, c.state.String())
+	}
+	assert.Equal(t, "minecraft:oak_log[axis=x,waterlogged=false]",
+		anvilState{"minecraft:oak_log", map[string]string{"waterlogged": "false", "axis": "x"}}.String())
+	w, ok := m.block(anvilState{Name: "minecraft:water"})
+	assert.False(t, ok)
+	assert.Equal(t, stone, w)
+
+	// first entry of a block, air and unmapped blocks
+	s, ok := m.state(wood)
+	assert.True(t, ok)
+	assert.Equal(t, "minecraft:oak_log[axis=y]", s.String())
+	s, ok = m.state(0)
+	assert.True(t, ok)
+	assert.Equal(t, "minecraft:air", s.String())
+	s, ok = m.state(stone)
+	assert.False(t, ok)
+	assert.Equal(t, "minecraft:bedrock", s.String())
+
+	_, err = parseAnvilMapping([]byte(`{"blocks": [{"minecraft": "stone", "block": "marble"}]}`))
+	assert.NotNil(t, err)
+	_, err = parseAnvilMapping([]byte(`{"blocks": [{"block": "stone"}]}`))
+	assert.NotNil(t, err)
+}
+
+func TestAnvil_PackIndexes(t *testing.T) {
+	for _, n := range []int{2, 16, 17, 33, 300, 4096} {
+		indexes := make([]uint16, anvilSectionBlocks)
+		for i := range indexes {
+			indexes[i] = uint16(i * 7 % n)
+		}
+		data := packAnvilIndexes(indexes, n)
+		perLong := 64 / anvilIndexBits(n)
+		assert.Equal(t, (anvilSectionBlocks+perLong-1)/perLong, len(data), "%d states", n)
+		unpacked, err := unpackAnvilIndexes(data, n, false)
+		assert.Nil(t, err)
+		assert.Equal(t, indexes, unpacked, "%d states", n)
+
+		_, err = unpackAnvilIndexes(data[1:], n, false)
+		assert.NotNil(t, err)
+	}
+
+	// index past the palette
+	data := packAnvilIndexes(make([]uint16, anvilSectionBlocks), 3)
+	data[10] = 3
+	_, err := unpackAnvilIndexes(data, 3, false)
+	assert.NotNil(t, err)
+}
+
+func TestAnvil_Export(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	w := NewWorld(store, &flatGenerator{})
+	stone, brick := lookupBlock(t, "stone"), lookupBlock(t, "brick")
+	assert.Nil(t, w.UpdateBlock(BlockID{1, 20, 1}, brick))
+	assert.Nil(t, w.UpdateBlock(BlockID{-3, 9, -2}, 0))
+
+	m, err := parseAnvilMapping([]byte(`{
+		"unmapped": {"minecraft": "bedrock"},
+		"blocks": [{"minecraft": "stone", "block": "stone"}]
+	}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a chunk of the world the export goes into, away from the exported ones
+	var kept anvilRegion
+	keptChunk := &anvilChunk{X: 10, Z: 10, sections: []anvilSection{{Y: 0, palette: []anvilState{{Name: "minecraft:dirt"}}}}}
+	assert.Nil(t, kept.setChunk(10+10*anvilRegionWidth, keptChunk.encode()))
+	f, err := os.Create(filepath.Join(dir, "r.0.0.mca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, kept.write(f))
+	f.Close()
+
+	offset := BlockID{0, -50, 0}
+	stats, err := ExportAnvil(w, m, dir, offset, -5, -5, 20, 3)
+	assert.Nil(t, err)
+	// chunks x -1 to 1, z -1 to 0
+	assert.Equal(t, 6, stats.Chunks)
+	assert.Equal(t, map[string]int{"brick": 1}, stats.Unmapped)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.ElementsMatch(t, []string{"r.-1.-1.mca", "r.0.-1.mca", "r.-1.0.mca", "r.0.0.mca"}, func() []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, filepath.Base(f))
+		}
+		return names
+	}())
+
+	readChunk := func(cx, cz int) *anvilChunk {
+		data, err := ioutil.ReadFile(filepath.Join(dir, regionFileName(floorDiv(cx, 32), floorDiv(cz, 32))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		region, err := parseAnvilRegion(data)
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		i := (cx - floorDiv(cx, 32)*32) + (cz-floorDiv(cz, 32)*32)*32
+		if region[i] == nil {
+			return nil
+		}
+		root, err := region.chunk(i)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(anvilDataVersion), root["DataVersion"])
+		c, err := parseAnvilChunk(root, cx, cz)
+		assert.Nil(t, err)
+		return c
+	}
+	assert.Equal(t, keptChunk, readChunk(10, 10))
+	assert.Nil(t, readChunk(2, 0))
+
+	// stone of y 0 to 9 is at 50 to 59 of section 3, the brick at 70 of section 4
+	blockAt := func(c *anvilChunk, x, y, z int) string {
+		for _, s := range c.sections {
+			if s.Y == floorDiv(y, 16) {
+				return s.palette[s.state((y-s.Y*16)*256+z*16+x)].String()
+			}
+		}
+		return "minecraft:air"
+	}
+	c := readChunk(0, 0)
+	assert.Equal(t, 2, len(c.sections))
+	assert.Equal(t, "minecraft:stone", blockAt(c, 1, 50, 1))
+	assert.Equal(t, "minecraft:stone", blockAt(c, 15, 59, 15))
+	assert.Equal(t, "minecraft:air", blockAt(c, 1, 60, 1))
+	assert.Equal(t, "minecraft:air", blockAt(c, 1, 49, 1))
+	assert.Equal(t, "minecraft:bedrock", blockAt(c, 1, 70, 1))
+	c = readChunk(-1, -1)
+	assert.Equal(t, "minecraft:air", blockAt(c, 13, 59, 14))
+	assert.Equal(t, "minecraft:stone", blockAt(c, 13, 58, 14))
+
+	// and back
+	back, done2 := newTestStore(t)
+	defer done2()
+	stats, err = back.ImportAnvil(filepath.Join(dir, "r.-1.-1.mca"), m, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Chunks)
+	blocks := storeOverrides(t, back)
+	assert.Equal(t, stone, blocks[BlockID{-3, 8, -2}])
+	assert.Equal(t, BlockType(0), blocks[BlockID{-3, 9, -2}])
+	assert.Equal(t, BlockType(0), blocks[BlockID{-3, 10, -2}])
+}
+
+func TestAnvil_DefaultMapping(t *testing.T) {
+	m := readTestAnvilMapping(t)
+	// every placeable block but colors goes out and comes back as itself
+	for _, w := range registry.Items() {
+		name := registry.Def(w).Name
+		s, ok := m.state(w)
+		if !ok {
+			continue
+		}
+		back, ok := m.block(s)
+		assert.True(t, ok, name)
+		assert.Equal(t, w, back, "%s is %s", name, s)
+	}
+	for _, name := range []string{"grass", "stone", "wood", "plank", "glass", "leaves", "red_flower"} {
+		_, ok := m.state(lookupBlock(t, name))
+		assert.True(t, ok, name)
+	}
+}
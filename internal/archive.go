@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// A world archive is a tar of
+//
+//	manifest.json      archiveManifest, always the first entry
+//	camera.json        archiveCamera, if the camera was saved
+//	chunks/X_Y_Z.gz    gzipped chunk record of chunk X, Y, Z as saved in the chunk bucket
+const (
+	archiveFormat       = 1
+	archiveChunkFormat  = "overrides-palette"
+	archiveManifestName = "manifest.json"
+	archiveCameraName   = "camera.json"
+	archiveChunkPrefix  = "chunks/"
+
+	// chunks imported in each transaction
+	archiveImportBatch = 256
+)
+
+type archiveManifest struct {
+	Format     int    `json:"format"`
+	Generator  string `json:"generator"`
+	Seed       int64  `json:"seed"`
+	ChunkWidth int    `json:"chunk_width"`
+	// ChunkFormat : encoding of chunk records, blocks which override generated ones
+	ChunkFormat string `json:"chunk_format"`
+}
+
+type archiveCamera struct {
+	Pos [3]float32 `json:"pos"`
+	Rx  float32    `json:"rx"`
+	Ry  float32    `json:"ry"`
+}
+
+// ConflictPolicy : what import does with a chunk saved in both the archive and the db
+type ConflictPolicy string
+
+const (
+	// ConflictKeep keeps the chunk of the db
+	ConflictKeep ConflictPolicy = "keep"
+	// ConflictReplace replaces the chunk of the db with the one of the archive
+	ConflictReplace ConflictPolicy = "replace"
+	// ConflictMerge keeps edits of both, blocks edited in both take the archive's
+	ConflictMerge ConflictPolicy = "merge"
+)
+
+// ParseConflictPolicy returns policy named s
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictKeep, ConflictReplace, ConflictMerge:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, need keep, replace or merge", s)
+}
+
+func archiveChunkName(cid ChunkID) string {
+	return fmt.Sprintf("%s%d_%d_%d.gz", archiveChunkPrefix, cid.X, cid.Y, cid.Z)
+}
+
+func parseArchiveChunkName(name string) (ChunkID, error) {
+	var cid ChunkID
+	_, err := fmt.Sscanf(strings.TrimPrefix(name, archiveChunkPrefix), "%d_%d_%d.gz", &cid.X, &cid.Y, &cid.Z)
+	if err != nil {
+		return cid, fmt.Errorf("bad chunk entry %s", name)
+	}
+	return cid, nil
+}
+
+// Export writes the saved world to w as an archive, chunks are read from one transaction as they are written
+func (s *Store) Export(w io.Writer) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	name, seed, ok, err := s.GeneratorMeta()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("world has no generator saved, play it once to save it")
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	writeEntry := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+	writeJSON := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeEntry(name, append(data, '\n'))
+	}
+
+	err = writeJSON(archiveManifestName, archiveManifest{
+		Format:      archiveFormat,
+		Generator:   name,
+		Seed:        seed,
+		ChunkWidth:  ChunkWidth,
+		ChunkFormat: archiveChunkFormat,
+	})
+	if err != nil {
+		return err
+	}
+	if pos, rx, ry, ok := s.camera(); ok {
+		err = writeJSON(archiveCameraName, archiveCamera{Pos: pos, Rx: rx, Ry: ry})
+		if err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).ForEach(func(k, v []byte) error {
+			// chunks of old versions are migrated when the world is opened to play
+			if len(v) > 0 && v[0] != chunkFormatOverrides {
+				return fmt.Errorf("chunk %v is of an old format, play the world once to migrate it", decodeChunkDbKey(k))
+			}
+			buf.Reset()
+			zw.Reset(&buf)
+			if _, err := zw.Write(v); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			return writeEntry(archiveChunkName(decodeChunkDbKey(k)), buf.Bytes())
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ImportStats : what Import did
+type ImportStats struct {
+	Chunks, Conflicts int
+}
+
+// Import reads an archive written by Export from r into s, chunks saved in both are resolved by policy.
+// The archive must be of the same generator and seed as the world in s, if s has one.
+// Chunks are committed in batches as they are read
+func (s *Store) Import(r io.Reader, policy ConflictPolicy) (ImportStats, error) {
+	var stats ImportStats
+	if err := s.Flush(); err != nil {
+		return stats, err
+	}
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return stats, fmt.Errorf("read manifest:%s", err)
+	}
+	if hdr.Name != archiveManifestName {
+		return stats, fmt.Errorf("first entry is %s, not %s", hdr.Name, archiveManifestName)
+	}
+	var manifest archiveManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return stats, fmt.Errorf("read manifest:%s", err)
+	}
+	if err := s.checkManifest(&manifest); err != nil {
+		return stats, err
+	}
+
+	batch := make(map[ChunkID][]byte)
+	commit := func() error {
+		n, err := s.importChunks(batch, policy)
+		stats.Conflicts += n
+		stats.Chunks += len(batch)
+		batch = make(map[ChunkID][]byte)
+		return err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		switch {
+		case hdr.Name == archiveCameraName:
+			var c archiveCamera
+			if err := json.NewDecoder(tr).Decode(&c); err != nil {
+				return stats, fmt.Errorf("read camera:%s", err)
+			}
+			if _, _, _, ok := s.camera(); !ok || policy == ConflictReplace {
+				if err := s.UpdateCamera(c.Pos, c.Rx, c.Ry); err != nil {
+					return stats, err
+				}
+			}
+		case strings.HasPrefix(hdr.Name, archiveChunkPrefix):
+			cid, err := parseArchiveChunkName(hdr.Name)
+			if err != nil {
+				return stats, err
+			}
+			value, err := readArchiveChunk(tr)
+			if err != nil {
+				return stats, fmt.Errorf("chunk %v:%s", cid, err)
+			}
+			batch[cid] = value
+			if len(batch) >= archiveImportBatch {
+				if err := commit(); err != nil {
+					return stats, err
+				}
+			}
+		}
+	}
+	return stats, commit()
+}
+
+// checkManifest checks the archive can be imported into s, and saves its generator in a new world
+func (s *Store) checkManifest(m *archiveManifest) error {
+	if m.Format != archiveFormat {
+		return fmt.Errorf("archive format %d is not supported", m.Format)
+	}
+	if m.ChunkWidth != ChunkWidth || m.ChunkFormat != archiveChunkFormat {
+		return fmt.Errorf("archive chunks are %s of width %d, need %s of width %d", m.ChunkFormat, m.ChunkWidth, archiveChunkFormat, ChunkWidth)
+	}
+	name, seed, ok, err := s.GeneratorMeta()
+	if err != nil {
+		return err
+	}
+	if ok {
+		// edits are over generated terrain, they only make sense over the same one
+		if name != m.Generator || seed != m.Seed {
+			return fmt.Errorf("archive is a world of generator %s seed %d, db is %s seed %d", m.Generator, m.Seed, name, seed)
+		}
+		return nil
+	}
+	if has, err := s.HasChunks(); err != nil || has {
+		if err == nil {
+			err = errors.New("db has chunks but no generator saved, play it once to save it")
+		}
+		return err
+	}
+	return s.SaveGeneratorMeta(m.Generator, m.Seed)
+}
+
+// readArchiveChunk returns chunk record of a chunk entry
+func readArchiveChunk(r io.Reader) ([]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	value, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decodeOverridesDbValue(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// importChunks saves chunk records in one transaction, it returns number of chunks which were saved already
+func (s *Store) importChunks(chunks map[ChunkID][]byte, policy ConflictPolicy) (int, error) {
+	conflicts := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(chunkBucket)
+		for cid, value := range chunks {
+			key := encodeChunkDbKey(cid)
+			old := bkt.Get(key)
+			if old != nil {
+				conflicts++
+				switch policy {
+				case ConflictKeep:
+					continue
+				case ConflictMerge:
+					merged, err := mergeOverrides(old, value)
+					if err != nil {
+						return fmt.Errorf("merge chunk %v:%s", cid, err)
+					}
+					value = merged
+				}
+			}
+			if err := bkt.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return conflicts, err
+}
+
+// mergeOverrides returns chunk record of the edits of both records, edits of src win
+func mergeOverrides(dst, src []byte) ([]byte, error) {
+	overrides, err := decodeOverridesDbValue(dst)
+	if err != nil {
+		return nil, err
+	}
+	edits, err := decodeOverridesDbValue(src)
+	if err != nil {
+		return nil, err
+	}
+	for i, w := range edits {
+		if w != noOverride {
+			overrides[i] = w
+		}
+	}
+	return encodeOverridesDbValue(overrides)
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+// newArchiveTestStore returns store of a biome world with seed 5
+func newArchiveTestStore(t *testing.T) (*Store, func()) {
+	store, done := newTestStore(t)
+	assert.Nil(t, store.SaveGeneratorMeta(biomeGeneratorName, 5))
+	return store, done
+}
+
+func exportStore(t *testing.T, store *Store) *bytes.Buffer {
+	var buf bytes.Buffer
+	assert.Nil(t, store.Export(&buf))
+	return &buf
+}
+
+func TestArchive_RoundTrip(t *testing.T) {
+	src, done := newArchiveTestStore(t)
+	defer done()
+	edits := map[BlockID]BlockType{
+		{1, 2, 3}:      stoneBlock,
+		{-40, 70, 5}:   brickBlock,
+		{100, 0, -100}: 0,
+	}
+	for bid, w := range edits {
+		assert.Nil(t, src.UpdateBlock(bid, w))
+	}
+	assert.Nil(t, src.UpdateCamera(mgl32.Vec3{1, 40, -2}, 0.5, 1.5))
+	archive := exportStore(t, src)
+
+	dst, done2 := newTestStore(t)
+	defer done2()
+	stats, err := dst.Import(archive, ConflictKeep)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportStats{Chunks: 3}, stats)
+
+	name, seed, ok, err := dst.GeneratorMeta()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, biomeGeneratorName, name)
+	assert.Equal(t, int64(5), seed)
+	for bid, w := range edits {
+		assert.Equal(t, map[BlockID]BlockType{bid: w}, rangeStoreBlocks(t, dst, bid.ChunkID()))
+	}
+	pos, rx, ry := dst.GetCamera()
+	assert.Equal(t, mgl32.Vec3{1, 40, -2}, pos)
+	assert.Equal(t, float32(0.5), rx)
+	assert.Equal(t, float32(1.5), ry)
+}
+
+func TestArchive_Entries(t *testing.T) {
+	store, done := newArchiveTestStore(t)
+	defer done()
+	assert.Nil(t, store.UpdateBlock(BlockID{-1, 2, 33}, stoneBlock))
+
+	tr := tar.NewReader(exportStore(t, store))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == archiveManifestName {
+			var m archiveManifest
+			assert.Nil(t, json.NewDecoder(tr).Decode(&m))
+			assert.Equal(t, archiveManifest{
+				Format:      archiveFormat,
+				Generator:   biomeGeneratorName,
+				Seed:        5,
+				ChunkWidth:  ChunkWidth,
+				ChunkFormat: archiveChunkFormat,
+			}, m)
+		}
+	}
+	// no camera saved
+	assert.Equal(t, []string{archiveManifestName, "chunks/-1_0_1.gz"}, names)
+}
+
+func TestArchive_Conflicts(t *testing.T) {
+	src, done := newArchiveTestStore(t)
+	defer done()
+	assert.Nil(t, src.UpdateBlock(BlockID{1, 1, 1}, stoneBlock))
+	assert.Nil(t, src.UpdateBlock(BlockID{2, 2, 2}, stoneBlock))
+	assert.Nil(t, src.UpdateCamera(mgl32.Vec3{5, 5, 5}, 0, 0))
+	archive := exportStore(t, src).Bytes()
+
+	for policy, want := range map[ConflictPolicy]map[BlockID]BlockType{
+		ConflictKeep:    {{2, 2, 2}: brickBlock, {3, 3, 3}: brickBlock},
+		ConflictReplace: {{1, 1, 1}: stoneBlock, {2, 2, 2}: stoneBlock},
+		ConflictMerge:   {{1, 1, 1}: stoneBlock, {2, 2, 2}: stoneBlock, {3, 3, 3}: brickBlock},
+	} {
+		dst, done := newArchiveTestStore(t)
+		assert.Nil(t, dst.UpdateBlock(BlockID{2, 2, 2}, brickBlock))
+		assert.Nil(t, dst.UpdateBlock(BlockID{3, 3, 3}, brickBlock))
+		assert.Nil(t, dst.UpdateCamera(mgl32.Vec3{9, 9, 9}, 0, 0))
+
+		stats, err := dst.Import(bytes.NewReader(archive), policy)
+		assert.Nil(t, err, policy)
+		assert.Equal(t, ImportStats{Chunks: 1, Conflicts: 1}, stats, policy)
+		assert.Equal(t, want, rangeStoreBlocks(t, dst, ChunkID{0, 0, 0}), policy)
+		pos, _, _ := dst.GetCamera()
+		if policy == ConflictReplace {
+			assert.Equal(t, mgl32.Vec3{5, 5, 5}, pos, policy)
+		} else {
+			assert.Equal(t, mgl32.Vec3{9, 9, 9}, pos, policy)
+		}
+		done()
+	}
+}
+
+func TestArchive_ManyChunks(t *testing.T) {
+	src, done := newArchiveTestStore(t)
+	defer done()
+	n := archiveImportBatch*2 + 10
+	for i := 0; i < n; i++ {
+		assert.Nil(t, src.UpdateBlock(BlockID{i * ChunkWidth, 1, 0}, stoneBlock))
+	}
+	archive := exportStore(t, src)
+
+	dst, done2 := newTestStore(t)
+	defer done2()
+	stats, err := dst.Import(archive, ConflictKeep)
+	assert.Nil(t, err)
+	assert.Equal(t, n, stats.Chunks)
+	assert.Equal(t, map[BlockID]BlockType{{(n - 1) * ChunkWidth, 1, 0}: stoneBlock}, rangeStoreBlocks(t, dst, ChunkID{n - 1, 0, 0}))
+}
+
+func TestArchive_OldChunks(t *testing.T) {
+	store, done := newArchiveTestStore(t)
+	defer done()
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).Put(encodeChunkDbKey(ChunkID{0, 0, 0}), []byte{chunkFormatEmpty})
+	})
+	assert.Nil(t, err)
+
+	// chunks are exported once they are migrated
+	assert.NotNil(t, store.Export(ioutil.Discard))
+	assert.Nil(t, store.MigrateChunks(classicTestChunk))
+	assert.Nil(t, store.Export(ioutil.Discard))
+}
+
+func TestArchive_Refused(t *testing.T) {
+	src, done := newArchiveTestStore(t)
+	defer done()
+	assert.Nil(t, src.UpdateBlock(BlockID{1, 1, 1}, stoneBlock))
+	archive := exportStore(t, src).Bytes()
+
+	// edits of another terrain
+	other, done2 := newTestStore(t)
+	defer done2()
+	assert.Nil(t, other.SaveGeneratorMeta(biomeGeneratorName, 6))
+	_, err := other.Import(bytes.NewReader(archive), ConflictKeep)
+	assert.NotNil(t, err)
+	assert.Equal(t, map[BlockID]BlockType{}, rangeStoreBlocks(t, other, ChunkID{0, 0, 0}))
+
+	// not an archive
+	_, err = other.Import(bytes.NewReader([]byte("gocraft")), ConflictKeep)
+	assert.NotNil(t, err)
+
+	// archive of a later version
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	manifest, _ := json.Marshal(archiveManifest{Format: archiveFormat + 1, Generator: biomeGeneratorName, Seed: 6})
+	tw.WriteHeader(&tar.Header{Name: archiveManifestName, Mode: 0644, Size: int64(len(manifest))})
+	tw.Write(manifest)
+	tw.Close()
+	_, err = other.Import(&buf, ConflictKeep)
+	assert.NotNil(t, err)
+
+	_, err = ParseConflictPolicy("overwrite")
+	assert.NotNil(t, err)
+}
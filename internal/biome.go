@@ -0,0 +1,113 @@
+package internal
+
+// Biome : kind of landscape of a column
+type Biome int
+
+const (
+	BiomePlains Biome = iota
+	BiomeDesert
+	BiomeForest
+	BiomeTundra
+	BiomeMountains
+)
+
+func (b Biome) String() string {
+	if b >= 0 && int(b) < len(biomes) {
+		return biomes[b].name
+	}
+	return "unknown"
+}
+
+// BiomeSource is implemented by generators which have biomes
+type BiomeSource interface {
+	Biome(x, z int) Biome
+}
+
+// Biome returns biome of column x, z, plains if generator does not have biomes
+func (w *World) Biome(x, z int) Biome {
+	if src, ok := w.gen.(BiomeSource); ok {
+		return src.Biome(x, z)
+	}
+	return BiomePlains
+}
+
+type biomeDesc struct {
+	name string
+
+	// height = base + amplitude * noise, blended between neighbour biomes
+	base, amplitude float32
+
+	surface, filler BlockType
+	fillerDepth     int
+
+	// rock and snow replace surface from these heights, 0 means never
+	rockLine, snowLine int
+
+	// chance of a plant on each surface block
+	plants     float32
+	plantTypes []BlockType
+
+	// chance of a tree or boulder on each surface block
+	trees, boulders float32
+	pines           bool
+}
+
+var biomes = [...]biomeDesc{
+	BiomePlains: {
+		name: "plains",
+		base: 14, amplitude: 10,
+		surface: grassBlock, filler: dirtBlock, fillerDepth: 3,
+		plants:     0.12,
+		plantTypes: []BlockType{tallGrass, tallGrass, tallGrass, 18, 19, 20, 21, 22, 23},
+		trees:      0.002, boulders: 0.0006,
+	},
+	BiomeDesert: {
+		name: "desert",
+		base: 13, amplitude: 8,
+		surface: sandBlock, filler: sandBlock, fillerDepth: 5,
+		plants:     0.004,
+		plantTypes: []BlockType{tallGrass},
+		boulders:   0.0003,
+	},
+	BiomeForest: {
+		name: "forest",
+		base: 15, amplitude: 14,
+		surface: grassBlock, filler: dirtBlock, fillerDepth: 4,
+		plants:     0.08,
+		plantTypes: []BlockType{tallGrass, tallGrass, 19, 23},
+		trees:      0.03,
+	},
+	BiomeTundra: {
+		name: "tundra",
+		base: 14, amplitude: 10,
+		surface: snowBlock, filler: dirtBlock, fillerDepth: 2,
+		plants:     0.01,
+		plantTypes: []BlockType{tallGrass},
+		trees:      0.004, boulders: 0.0008, pines: true,
+	},
+	BiomeMountains: {
+		name: "mountains",
+		base: 22, amplitude: 56,
+		surface: grassBlock, filler: dirtBlock, fillerDepth: 2,
+		rockLine: 38, snowLine: 56,
+		plants:     0.02,
+		plantTypes: []BlockType{tallGrass, 22},
+		trees:      0.004, boulders: 0.002, pines: true,
+	},
+}
+
+// pickBiome chooses biome by climate, all arguments are in [0, 1]
+func pickBiome(temperature, humidity, mountain float32) Biome {
+	switch {
+	case mountain > 0.64:
+		return BiomeMountains
+	case temperature < 0.37:
+		return BiomeTundra
+	case temperature > 0.58 && humidity < 0.48:
+		return BiomeDesert
+	case humidity > 0.55:
+		return BiomeForest
+	default:
+		return BiomePlains
+	}
+}
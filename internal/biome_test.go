@@ -0,0 +1,77 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/cLazyZombie/gocraft/gocrafttest"
+	. "github.com/cLazyZombie/gocraft/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// surfaceY returns y of the top block of column x, z, skipping plants, trees and clouds
+func surfaceY(world *World, x, z int) (int, BlockType) {
+	for y := 127; y >= 0; y-- {
+		bid := BlockID{x, y, z}
+		w := world.Chunk(bid.ChunkID()).Block(bid)
+		if w != 0 && !w.IsPlant() && w != 5 && w != 15 && w != 16 {
+			return y, w
+		}
+	}
+	return -1, 0
+}
+
+func TestWorld_Biome(t *testing.T) {
+	gen, err := NewGenerator("biome", 3)
+	assert.Nil(t, err)
+	world := NewWorld(gocrafttest.NewStoreMock(), gen)
+
+	found := make(map[Biome]bool)
+	for x := -12800; x < 12800; x += 320 {
+		for z := -12800; z < 12800; z += 320 {
+			biome := world.Biome(x, z)
+			assert.Equal(t, biome, gen.(BiomeSource).Biome(x, z))
+			if found[biome] {
+				continue
+			}
+			found[biome] = true
+
+			// caves can open the surface of a column, so look at a few of them
+			ok := false
+			for i := 0; i < 8 && !ok; i++ {
+				y, w := surfaceY(world, x+i, z)
+				switch {
+				case y <= 12:
+					ok = w == 2 // beach
+				case biome == BiomeDesert:
+					ok = w == 2
+				case biome == BiomeTundra:
+					ok = w == 9
+				case biome == BiomeMountains:
+					ok = w == 1 || w == 3 || w == 9
+				default:
+					ok = w == 1
+				}
+			}
+			assert.True(t, ok, "surface of %v at %d,%d", biome, x, z)
+		}
+	}
+	for _, biome := range []Biome{BiomePlains, BiomeDesert, BiomeForest, BiomeTundra, BiomeMountains} {
+		assert.True(t, found[biome], "biome %v not found", biome)
+	}
+}
+
+func TestWorld_BiomeWithoutBiomeSource(t *testing.T) {
+	gen, err := NewGenerator("classic", 0)
+	assert.Nil(t, err)
+	world := NewWorld(gocrafttest.NewStoreMock(), gen)
+	assert.Equal(t, BiomePlains, world.Biome(100, 100))
+	assert.Equal(t, "plains", BiomePlains.String())
+}
+
+func TestBiomeGenerator_Deterministic(t *testing.T) {
+	a, _ := NewGenerator("biome", 5)
+	b, _ := NewGenerator("biome", 5)
+	for _, cid := range []ChunkID{{0, 0, 0}, {-3, 0, 7}, {2, 1, -1}} {
+		assert.Equal(t, a.Chunk(cid), b.Chunk(cid))
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+const latticeStep = 4
+
+const latticeSize = ChunkWidth/latticeStep + 1
+
+// noiseLattice : noise sampled every latticeStep blocks of a chunk,
+// blocks between samples are interpolated.
+// Samples are on world positions, so neighbour chunks share their border samples.
+type noiseLattice [latticeSize][latticeSize][latticeSize]float32
+
+func newNoiseLattice(cid ChunkID, f func(x, y, z float32) float32) *noiseLattice {
+	l := new(noiseLattice)
+	sx, sy, sz := cid.X*ChunkWidth, cid.Y*ChunkWidth, cid.Z*ChunkWidth
+	for i := 0; i < latticeSize; i++ {
+		for j := 0; j < latticeSize; j++ {
+			for k := 0; k < latticeSize; k++ {
+				l[i][j][k] = f(float32(sx+i*latticeStep), float32(sy+j*latticeStep), float32(sz+k*latticeStep))
+			}
+		}
+	}
+	return l
+}
+
+// at returns interpolated noise of chunk local position
+func (l *noiseLattice) at(dx, dy, dz int) float32 {
+	i, j, k := dx/latticeStep, dy/latticeStep, dz/latticeStep
+	fx := float32(dx%latticeStep) / latticeStep
+	fy := float32(dy%latticeStep) / latticeStep
+	fz := float32(dz%latticeStep) / latticeStep
+	lerp := func(a, b, t float32) float32 {
+		return a + (b-a)*t
+	}
+	x00 := lerp(l[i][j][k], l[i+1][j][k], fx)
+	x10 := lerp(l[i][j+1][k], l[i+1][j+1][k], fx)
+	x01 := lerp(l[i][j][k+1], l[i+1][j][k+1], fx)
+	x11 := lerp(l[i][j+1][k+1], l[i+1][j+1][k+1], fx)
+	return lerp(lerp(x00, x10, fy), lerp(x01, x11, fy), fz)
+}
+
+// caveCarver decides which underground blocks of a chunk are air
+type caveCarver struct {
+	g                *biomeGenerator
+	cid              ChunkID
+	tunnelA, tunnelB *noiseLattice
+	cavern           *noiseLattice
+}
+
+func (g *biomeGenerator) newCaveCarver(cid ChunkID) *caveCarver {
+	return &caveCarver{
+		g:   g,
+		cid: cid,
+		tunnelA: newNoiseLattice(cid, func(x, y, z float32) float32 {
+			return g.tunnelA.noise3(x*0.012, y*0.024, z*0.012, 2, 0.5, 2)
+		}),
+		tunnelB: newNoiseLattice(cid, func(x, y, z float32) float32 {
+			return g.tunnelB.noise3(x*0.012, y*0.024, z*0.012, 2, 0.5, 2)
+		}),
+		cavern: newNoiseLattice(cid, func(x, y, z float32) float32 {
+			return g.cavern.noise3(x*0.016, y*0.03, z*0.016, 2, 0.5, 2)
+		}),
+	}
+}
+
+// carved reports whether block at chunk local dx, dy, dz of column with surface h is a cave
+func (c *caveCarver) carved(dx, dy, dz, h int) bool {
+	y := c.cid.Y*ChunkWidth + dy
+	if y < 1 || y > h {
+		return false
+	}
+
+	// tunnels are where both noises cross the middle
+	a, b := c.tunnelA.at(dx, dy, dz)-0.5, c.tunnelB.at(dx, dy, dz)-0.5
+	if a*a+b*b < 0.0006 {
+		return true
+	}
+
+	// caverns stay deep under the surface
+	if y < h-8 && y < 48 && c.cavern.at(dx, dy, dz) > 0.68 {
+		return true
+	}
+
+	return c.g.ravine(c.cid.X*ChunkWidth+dx, y, c.cid.Z*ChunkWidth+dz, h)
+}
+
+// ravine : deep narrow crack along the middle line of a 2d noise
+func (g *biomeGenerator) ravine(x, y, z, h int) bool {
+	fx, fz := float32(x), float32(z)
+	if g.ravineMask.noise2(fx*0.004, fz*0.004, 2, 0.5, 2) < 0.66 {
+		return false
+	}
+	r := abs(g.ravineLine.noise2(fx*0.006, fz*0.006, 2, 0.5, 2) - 0.5)
+	depth := 12 + int(hashFloat(g.seed, x/16, 1, z/16)*4) + int(g.ravineMask.noise2(fz*0.02, fx*0.02, 1, 0.5, 2)*24)
+	if y < h-depth || y < 4 {
+		return false
+	}
+	// narrower at the bottom
+	width := 0.004 + 0.006*float32(y-(h-depth))/float32(depth)
+	return r < width
+}
+
+type oreDesc struct {
+	block      BlockType
+	minY, maxY int
+	// veins in each chunk, blocks of a vein are in radius of its center
+	veins  int
+	radius int
+}
+
+// gocraft has no ore textures, so veins use blocks of matching colours
+var ores = []oreDesc{
+	{block: 11, minY: 1, maxY: 96, veins: 4, radius: 3}, // gravel: cobble
+	{block: 48, minY: 1, maxY: 80, veins: 8, radius: 2}, // coal: black
+	{block: 54, minY: 1, maxY: 48, veins: 5, radius: 2}, // iron: tan
+	{block: 32, minY: 1, maxY: 28, veins: 2, radius: 1}, // gold: yellow
+	{block: 59, minY: 1, maxY: 14, veins: 1, radius: 1}, // diamond: cyan
+}
+
+// placeOres puts ore veins of this and neighbour chunks into stone blocks of m
+func (g *biomeGenerator) placeOres(cid ChunkID, m []BlockType) {
+	startX, startY, startZ := cid.X*ChunkWidth, cid.Y*ChunkWidth, cid.Z*ChunkWidth
+	for ox := -1; ox <= 1; ox++ {
+		for oy := -1; oy <= 1; oy++ {
+			for oz := -1; oz <= 1; oz++ {
+				src := ChunkID{cid.X + ox, cid.Y + oy, cid.Z + oz}
+				for i, ore := range ores {
+					for v := 0; v < ore.veins; v++ {
+						seed := int64(hash3(g.seed, src.X, src.Y, src.Z) ^ uint64(i<<16|v))
+						cx := src.X*ChunkWidth + int(hashFloat(seed, 0, 0, 0)*ChunkWidth)
+						cy := src.Y*ChunkWidth + int(hashFloat(seed, 1, 0, 0)*ChunkWidth)
+						cz := src.Z*ChunkWidth + int(hashFloat(seed, 2, 0, 0)*ChunkWidth)
+						if cy < ore.minY || cy > ore.maxY {
+							continue
+						}
+						r := ore.radius
+						for x := cx - r; x <= cx+r; x++ {
+							for y := cy - r; y <= cy+r; y++ {
+								for z := cz - r; z <= cz+r; z++ {
+									if x < startX || x >= startX+ChunkWidth ||
+										y < startY || y >= startY+ChunkWidth ||
+										z < startZ || z >= startZ+ChunkWidth {
+										continue
+									}
+									d := (x-cx)*(x-cx) + (y-cy)*(y-cy) + (z-cz)*(z-cz)
+									if d > r*r || hashFloat(seed, x, y, z) < 0.4 {
+										continue
+									}
+									idx := BlockID{x, y, z}.ToIndex()
+									if m[idx] == stoneBlock {
+										m[idx] = ore.block
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
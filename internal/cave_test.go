@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoiseLattice_Border(t *testing.T) {
+	f := func(x, y, z float32) float32 {
+		return x*0.5 + y*0.25 + z
+	}
+	a := newNoiseLattice(ChunkID{0, 0, 0}, f)
+	b := newNoiseLattice(ChunkID{1, 0, 0}, f)
+	for j := 0; j < latticeSize; j++ {
+		for k := 0; k < latticeSize; k++ {
+			assert.Equal(t, a[latticeSize-1][j][k], b[0][j][k])
+		}
+	}
+	// linear function is interpolated exactly
+	assert.InDelta(t, f(3, 5, 7), a.at(3, 5, 7), 1e-4)
+	assert.InDelta(t, f(ChunkWidth+1, 2, 31), b.at(1, 2, 31), 1e-4)
+}
+
+func TestBiomeGenerator_Underground(t *testing.T) {
+	gen := newBiomeGenerator(11).(*biomeGenerator)
+	counts := make(map[BlockType]int)
+	for cx := -2; cx < 2; cx++ {
+		for cz := -2; cz < 2; cz++ {
+			cid := ChunkID{cx, 0, cz}
+			m := gen.Chunk(cid)
+			cols := gen.chunkColumns(cx, cz)
+			for dz := 0; dz < ChunkWidth; dz++ {
+				for dx := 0; dx < ChunkWidth; dx++ {
+					x, z := cx*ChunkWidth+dx, cz*ChunkWidth+dz
+					h := cols[dx+dz*ChunkWidth].surfaceHeight()
+					assert.Equal(t, bottomBlock, m[BlockID{x, 0, z}.ToIndex()])
+					for y := 1; y < h && y < ChunkWidth; y++ {
+						w := m[BlockID{x, y, z}.ToIndex()]
+						counts[w]++
+						for _, ore := range ores {
+							if w == ore.block && ore.block != 11 {
+								// vein blocks are within radius of a center in range
+								assert.True(t, y >= ore.minY-ore.radius && y <= ore.maxY+ore.radius,
+									"ore %d at y %d", w, y)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	assert.True(t, counts[stoneBlock] > counts[dirtBlock], "stone %d dirt %d", counts[stoneBlock], counts[dirtBlock])
+	assert.True(t, counts[0] > 0, "no cave")
+	assert.True(t, counts[48] > 0, "no coal")
+	assert.True(t, counts[54] > 0, "no iron")
+}
+
+func TestBiomeGenerator_OreAcrossBorder(t *testing.T) {
+	gen := newBiomeGenerator(11).(*biomeGenerator)
+	// a chunk full of stone gets the parts of neighbour veins which cross its border
+	var crossed int
+	for cx := 0; cx < 8; cx++ {
+		cid := ChunkID{cx, 0, 0}
+		m := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+		for i := range m {
+			m[i] = stoneBlock
+		}
+		gen.placeOres(cid, m)
+		for _, bid := range []BlockID{{cx * ChunkWidth, 0, 0}, {cx*ChunkWidth + ChunkWidth - 1, 0, 0}} {
+			for y := 0; y < ChunkWidth; y++ {
+				for z := 0; z < ChunkWidth; z++ {
+					if m[BlockID{bid.X, y, z}.ToIndex()] != stoneBlock {
+						crossed++
+					}
+				}
+			}
+		}
+		assert.Equal(t, m, func() []BlockType {
+			again := make([]BlockType, len(m))
+			for i := range again {
+				again[i] = stoneBlock
+			}
+			gen.placeOres(cid, again)
+			return again
+		}())
+	}
+	assert.True(t, crossed > 0)
+}
@@ -96,6 +96,7 @@ type Chunk struct {
 
 	blocks []BlockType
 	locker sync.Locker
+	light  *lightMap // guarded by World.lightMutex
 
 	Version int64
 }
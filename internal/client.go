@@ -2,61 +2,385 @@ package internal
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// clientTimeout : max wait for a chunk from server
+var clientTimeout = 10 * time.Second
+
+var (
+	errClientClosed  = errors.New("client closed")
+	errClientTimeout = errors.New("server timeout")
 )
 
+// Player : other player on the server
+type Player struct {
+	ID   int
+	Name string
+	Pos  mgl32.Vec3
+	// Rx, Ry are the yaw and pitch in radian, yaw 0 looks to +x like the camera.
+	// Craft's yaw 0 looks to -z, it is converted when sent and received
+	Rx, Ry float32
+}
+
+// Sign : text on a block face
+type Sign struct {
+	Block BlockID
+	Face  int
+	Text  string
+}
+
+// columnRequest : blocks of a chunk column being fetched
+type columnRequest struct {
+	blocks map[BlockID]BlockType
+	done   chan struct{}
+}
+
+// Client : connection to a fogleman/Craft server
 type Client struct {
-	lock sync.Mutex
-	conn net.Conn
-	r    *bufio.Reader
+	conn   net.Conn
+	wmutex sync.Mutex
+
+	mutex    sync.Mutex
+	id       int
+	requests map[[2]int]*columnRequest
+	players  map[int]*Player
+	signs    map[[4]int]Sign
+	chat     []string
+	onBlock  func(id BlockID, w BlockType)
+	lastPos  string
+	err      error
+
+	// generator of a gocraft server, set before hello is closed
+	genName   string
+	genSeed   int64
+	hello     chan struct{}
+	helloOnce sync.Once
+
+	done chan struct{}
 }
 
-func NewClient(addr string) *Client {
+func NewClient(addr string) (*Client, error) {
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return &Client{
-		conn: conn,
-		r:    bufio.NewReader(conn),
+	c := &Client{
+		conn:     conn,
+		requests: make(map[[2]int]*columnRequest),
+		players:  make(map[int]*Player),
+		signs:    make(map[[4]int]Sign),
+		hello:    make(chan struct{}),
+		done:     make(chan struct{}),
 	}
+	go c.readLoop()
+	return c, nil
 }
 
-func (c *Client) readCommand() string {
-	line, err := c.r.ReadString('\n')
-	if err != nil {
-		log.Fatal(err)
-	}
-	return line[:len(line)-1]
+// OnBlock sets f to be called with blocks changed by other players
+func (c *Client) OnBlock(f func(id BlockID, w BlockType)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onBlock = f
+}
+
+func (c *Client) send(format string, args ...interface{}) error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	_, err := fmt.Fprintf(c.conn, format+"\n", args...)
+	return err
 }
 
-func (c *Client) FetchChunk(id ChunkID) map[BlockID]int {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	fmt.Fprintf(c.conn, "C,%d,%d,123\r\n", id.X, id.Z)
-	m := make(map[BlockID]int)
+func (c *Client) readLoop() {
+	r := bufio.NewReader(c.conn)
+	var err error
 	for {
-		cmd := c.readCommand()
-		if cmd[0] == 'C' {
+		var line string
+		line, err = r.ReadString('\n')
+		if err != nil {
 			break
 		}
-		if cmd[0] != 'B' {
-			continue
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			c.handle(line)
+		}
+	}
+
+	c.mutex.Lock()
+	c.err = err
+	c.mutex.Unlock()
+	close(c.done)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func atof(s string) float32 {
+	f, _ := strconv.ParseFloat(s, 32)
+	return float32(f)
+}
+
+func (c *Client) handle(line string) {
+	args := strings.Split(line, ",")
+	// G,name,seed comes right after U from a gocraft server
+	if args[0] != "U" {
+		c.helloOnce.Do(func() {
+			if args[0] == "G" && len(args) >= 3 {
+				c.genName = args[1]
+				c.genSeed, _ = strconv.ParseInt(args[2], 10, 64)
+			}
+			close(c.hello)
+		})
+	}
+	if args[0] == "B" {
+		c.handleBlock(args)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch args[0] {
+	case "U":
+		// U,id,x,y,z,rx,ry : our id
+		if len(args) >= 2 {
+			c.id = atoi(args[1])
+		}
+	case "C", "R":
+		// C,p,q,key or R,p,q : end of a requested chunk
+		if len(args) < 3 {
+			return
+		}
+		key := [2]int{atoi(args[1]), atoi(args[2])}
+		if req, ok := c.requests[key]; ok {
+			delete(c.requests, key)
+			close(req.done)
+		}
+	case "P":
+		// P,id,x,y,z,rx,ry : position of other player
+		if len(args) < 7 {
+			return
+		}
+		id := atoi(args[1])
+		if id == c.id {
+			return
+		}
+		p := c.player(id)
+		p.Pos = mgl32.Vec3{atof(args[2]), atof(args[3]), atof(args[4])}
+		p.Rx, p.Ry = atof(args[5])-math.Pi/2, atof(args[6])
+	case "D":
+		// D,id : player left
+		if len(args) >= 2 {
+			delete(c.players, atoi(args[1]))
+		}
+	case "N":
+		// N,id,name
+		if len(args) >= 3 {
+			c.player(atoi(args[1])).Name = strings.Join(args[2:], ",")
+		}
+	case "T":
+		// T,text
+		c.chat = append(c.chat, strings.TrimPrefix(line, "T,"))
+	case "S":
+		// S,p,q,x,y,z,face,text : empty text removes the sign
+		args = strings.SplitN(line, ",", 8)
+		if len(args) < 8 {
+			return
+		}
+		sign := Sign{
+			Block: BlockID{atoi(args[3]), atoi(args[4]), atoi(args[5])},
+			Face:  atoi(args[6]),
+			Text:  args[7],
+		}
+		key := [4]int{sign.Block.X, sign.Block.Y, sign.Block.Z, sign.Face}
+		if sign.Text == "" {
+			delete(c.signs, key)
+		} else {
+			c.signs[key] = sign
+		}
+	}
+}
+
+// handleBlock handles B,p,q,x,y,z,w : block of a requested chunk, or a block changed by other player
+func (c *Client) handleBlock(args []string) {
+	if len(args) < 7 {
+		return
+	}
+	bid := BlockID{atoi(args[3]), atoi(args[4]), atoi(args[5])}
+	// negative w are copies of blocks at borders of neighbour chunks, the block itself comes in its own chunk
+	n := atoi(args[6])
+	if n < 0 || n >= int(noOverride) {
+		return
+	}
+	w := BlockType(n)
+
+	c.mutex.Lock()
+	req, ok := c.requests[[2]int{atoi(args[1]), atoi(args[2])}]
+	if ok {
+		req.blocks[bid] = w
+	}
+	onBlock := c.onBlock
+	c.mutex.Unlock()
+
+	if !ok && onBlock != nil {
+		onBlock(bid, w)
+	}
+}
+
+// player returns player of id, adding it if not exists
+func (c *Client) player(id int) *Player {
+	p, ok := c.players[id]
+	if !ok {
+		p = &Player{ID: id}
+		c.players[id] = p
+	}
+	return p
+}
+
+// Generator returns terrain generator of server, ok is false for Craft servers which don't tell it
+func (c *Client) Generator() (name string, seed int64, ok bool) {
+	select {
+	case <-c.hello:
+	case <-c.done:
+	case <-time.After(clientTimeout):
+	}
+	select {
+	case <-c.hello:
+		return c.genName, c.genSeed, c.genName != ""
+	default:
+		return "", 0, false
+	}
+}
+
+// FetchColumn returns blocks saved on server in chunk column p, q
+func (c *Client) FetchColumn(p, q int) (map[BlockID]BlockType, error) {
+	key := [2]int{p, q}
+	c.mutex.Lock()
+	if c.isClosed() {
+		c.mutex.Unlock()
+		return nil, errClientClosed
+	}
+	req, ok := c.requests[key]
+	if !ok {
+		req = &columnRequest{
+			blocks: make(map[BlockID]BlockType),
+			done:   make(chan struct{}),
 		}
-		var p, q, x, y, z, w int
-		fmt.Sscanf(cmd, "B,%d,%d,%d,%d,%d,%d", &p, &q, &x, &y, &z, &w)
-		block := BlockID{x, y, z}
-		if block.ChunkID() != id {
-			// log.Printf("block %v chunk %v, %v", block, block.Chunkid(), id)
-			continue
+		c.requests[key] = req
+	}
+	c.mutex.Unlock()
+
+	if !ok {
+		// key 0 asks for all blocks of the chunk
+		err := c.send("C,%d,%d,0", p, q)
+		if err != nil {
+			return nil, err
 		}
-		if w == 0 {
-			continue
+	}
+
+	select {
+	case <-req.done:
+	case <-c.done:
+		return nil, errClientClosed
+	case <-time.After(clientTimeout):
+		// next fetch asks again
+		c.mutex.Lock()
+		if c.requests[key] == req {
+			delete(c.requests, key)
 		}
-		m[block] = w
+		c.mutex.Unlock()
+		return nil, errClientTimeout
 	}
-	return m
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	blocks := make(map[BlockID]BlockType, len(req.blocks))
+	for bid, w := range req.blocks {
+		blocks[bid] = w
+	}
+	return blocks, nil
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// UpdateBlock sends block change to server
+func (c *Client) UpdateBlock(id BlockID, w BlockType) error {
+	return c.send("B,%d,%d,%d,%d", id.X, id.Y, id.Z, w)
+}
+
+// UpdatePosition sends our position to server if it is changed
+func (c *Client) UpdatePosition(pos mgl32.Vec3, rx, ry float32) error {
+	msg := fmt.Sprintf("P,%.2f,%.2f,%.2f,%.2f,%.2f", pos.X(), pos.Y(), pos.Z(), radian(rx+90), radian(ry))
+	c.mutex.Lock()
+	same := msg == c.lastPos
+	c.lastPos = msg
+	c.mutex.Unlock()
+	if same {
+		return nil
+	}
+	return c.send("%s", msg)
+}
+
+// Talk sends chat message
+func (c *Client) Talk(text string) error {
+	return c.send("T,%s", text)
+}
+
+// Players returns other players on server
+func (c *Client) Players() []Player {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var players []Player
+	for _, p := range c.players {
+		players = append(players, *p)
+	}
+	return players
+}
+
+// Chat returns chat messages received
+func (c *Client) Chat() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.chat...)
+}
+
+// Signs returns signs of chunks fetched
+func (c *Client) Signs() []Sign {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var signs []Sign
+	for _, s := range c.signs {
+		signs = append(signs, s)
+	}
+	return signs
+}
+
+// Err returns error which stopped the connection
+func (c *Client) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
 }
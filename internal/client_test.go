@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer : one connection of a local Craft server
+type fakeServer struct {
+	t    *testing.T
+	ln   net.Listener
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *Client) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeServer{t: t, ln: ln, conn: conn, r: bufio.NewReader(conn)}, client
+}
+
+func (s *fakeServer) send(lines ...string) {
+	for _, line := range lines {
+		fmt.Fprintf(s.conn, "%s\n", line)
+	}
+}
+
+func (s *fakeServer) read() string {
+	s.conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return strings.TrimRight(line, "\n")
+}
+
+// serveColumn answers a chunk request with blocks
+func (s *fakeServer) serveColumn(blocks ...string) {
+	var p, q, key int
+	fmt.Sscanf(s.read(), "C,%d,%d,%d", &p, &q, &key)
+	assert.Equal(s.t, 0, key)
+	for _, b := range blocks {
+		s.send(fmt.Sprintf("B,%d,%d,%s", p, q, b))
+	}
+	s.send(fmt.Sprintf("K,%d,%d,1", p, q), fmt.Sprintf("R,%d,%d", p, q))
+}
+
+func (s *fakeServer) Close() {
+	s.conn.Close()
+	s.ln.Close()
+}
+
+func TestClient_FetchColumn(t *testing.T) {
+	server, client := newFakeServer(t)
+	defer server.Close()
+	defer client.Close()
+
+	go server.serveColumn("33,5,2,3", "40,70,3,0")
+	blocks, err := client.FetchColumn(1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, map[BlockID]BlockType{{33, 5, 2}: 3, {40, 70, 3}: 0}, blocks)
+}
+
+func TestClient_Messages(t *testing.T) {
+	server, client := newFakeServer(t)
+	defer server.Close()
+	defer client.Close()
+
+	server.send(
+		"U,1,0,0,0,0,0",
+		"P,1,5,5,5,0,0",
+		"P,2,1.5,20,-3,1.5707964,0.25",
+		"N,2,alice",
+		"P,3,0,0,0,0,0",
+		"D,3",
+		"T,hello, world",
+		"S,0,0,1,2,3,4,keep, out",
+		"S,0,0,5,5,5,0,gone",
+		"S,0,0,5,5,5,0,",
+	)
+	// messages are handled in order, so they are done when the column arrives
+	go server.serveColumn()
+	_, err := client.FetchColumn(0, 0)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Player{{ID: 2, Name: "alice", Pos: mgl32.Vec3{1.5, 20, -3}, Rx: 0, Ry: 0.25}}, client.Players())
+	assert.Equal(t, []string{"hello, world"}, client.Chat())
+	assert.Equal(t, []Sign{{Block: BlockID{1, 2, 3}, Face: 4, Text: "keep, out"}}, client.Signs())
+}
+
+func TestClient_Send(t *testing.T) {
+	server, client := newFakeServer(t)
+	defer server.Close()
+	defer client.Close()
+
+	assert.Nil(t, client.UpdateBlock(BlockID{1, -2, 3}, 5))
+	assert.Equal(t, "B,1,-2,3,5", server.read())
+
+	pos := mgl32.Vec3{1, 2, 3}
+	assert.Nil(t, client.UpdatePosition(pos, 0, 0))
+	// same position is sent once
+	assert.Nil(t, client.UpdatePosition(pos, 0, 0))
+	assert.Nil(t, client.Talk("hi"))
+	// Craft's yaw is 90 degrees more than the camera's
+	assert.Equal(t, "P,1.00,2.00,3.00,1.57,0.00", server.read())
+	assert.Equal(t, "T,hi", server.read())
+	assert.Nil(t, client.UpdatePosition(pos, 90, -45))
+	assert.Equal(t, "P,1.00,2.00,3.00,3.14,-0.79", server.read())
+}
+
+func TestClient_Closed(t *testing.T) {
+	server, client := newFakeServer(t)
+	defer client.Close()
+
+	go func() {
+		server.read()
+		server.Close()
+	}()
+	_, err := client.FetchColumn(0, 0)
+	assert.NotNil(t, err)
+	assert.NotNil(t, client.Err())
+	_, err = client.FetchColumn(0, 0)
+	assert.Equal(t, errClientClosed, err)
+}
+
+func TestRemoteStore(t *testing.T) {
+	server, client := newFakeServer(t)
+	defer server.Close()
+	defer client.Close()
+
+	gen, err := NewGenerator("classic", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewRemoteStore(client)
+	world := NewWorld(store, gen)
+	store.OnChange(world.SetBlock)
+
+	// server blocks replace generated terrain, for every chunk of the column
+	go server.serveColumn("1,0,1,0", "1,40,1,5")
+	ground, sky := BlockID{1, 0, 1}, BlockID{1, 40, 1}
+	assert.Equal(t, BlockType(0), world.Chunk(ground.ChunkID()).Block(ground))
+	assert.Equal(t, BlockType(5), world.Chunk(sky.ChunkID()).Block(sky))
+
+	// our edit is sent to server
+	assert.Nil(t, world.UpdateBlock(BlockID{2, 40, 2}, 4))
+	assert.Equal(t, "B,2,40,2,4", server.read())
+	assert.Equal(t, BlockType(4), world.Block(BlockID{2, 40, 2}))
+
+	// edit of other player changes the world
+	server.send("B,0,0,3,40,3,8", "R,0,0")
+	go server.serveColumn()
+	_, err = client.FetchColumn(5, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, BlockType(8), world.Block(BlockID{3, 40, 3}))
+
+	// border copies and bad block types are dropped
+	server.send("B,0,0,3,40,3,-8", "B,0,0,3,40,3,65535", "B,0,0,3,40,3,70000", "R,0,0")
+	go server.serveColumn("1,41,1,-2", "1,42,1,65536")
+	fetched, err := client.FetchColumn(6, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(fetched))
+	assert.Equal(t, BlockType(8), world.Block(BlockID{3, 40, 3}))
+
+	var blocks []string
+	store.RangeBlocks(sky.ChunkID(), func(bid BlockID, w BlockType) {
+		blocks = append(blocks, fmt.Sprint(bid, w))
+	})
+	sort.Strings(blocks)
+	assert.Equal(t, []string{"{1 40 1} 5", "{2 40 2} 4", "{3 40 3} 8"}, blocks)
+}
@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// edited blocks are kept in memory until they are committed
+	editMaxSide   = 4096
+	editMaxBlocks = 1 << 22
+)
+
+// Region : box of blocks between two corners, both included
+type Region struct {
+	Min, Max BlockID
+}
+
+// NewRegion returns the region between corners a and b, in any order
+func NewRegion(a, b BlockID) Region {
+	r := Region{a, b}
+	for _, c := range []struct{ lo, hi *int }{{&r.Min.X, &r.Max.X}, {&r.Min.Y, &r.Max.Y}, {&r.Min.Z, &r.Max.Z}} {
+		if *c.lo > *c.hi {
+			*c.lo, *c.hi = *c.hi, *c.lo
+		}
+	}
+	return r
+}
+
+// Size returns the number of blocks along x, y and z
+func (r Region) Size() (int, int, int) {
+	return r.Max.X - r.Min.X + 1, r.Max.Y - r.Min.Y + 1, r.Max.Z - r.Min.Z + 1
+}
+
+// Contains reports whether block id is in r
+func (r Region) Contains(id BlockID) bool {
+	return id.X >= r.Min.X && id.X <= r.Max.X &&
+		id.Y >= r.Min.Y && id.Y <= r.Max.Y &&
+		id.Z >= r.Min.Z && id.Z <= r.Max.Z
+}
+
+// intersect returns the blocks which are in both r and o, they must overlap
+func (r Region) intersect(o Region) Region {
+	for _, c := range []struct{ lo, hi, olo, ohi *int }{
+		{&r.Min.X, &r.Max.X, &o.Min.X, &o.Max.X},
+		{&r.Min.Y, &r.Max.Y, &o.Min.Y, &o.Max.Y},
+		{&r.Min.Z, &r.Max.Z, &o.Min.Z, &o.Max.Z},
+	} {
+		if *c.olo > *c.lo {
+			*c.lo = *c.olo
+		}
+		if *c.ohi < *c.hi {
+			*c.hi = *c.ohi
+		}
+	}
+	return r
+}
+
+// onWall reports whether block id of r is on one of its four vertical sides
+func (r Region) onWall(id BlockID) bool {
+	return id.X == r.Min.X || id.X == r.Max.X || id.Z == r.Min.Z || id.Z == r.Max.Z
+}
+
+// onSide reports whether block id of r is on one of its six sides
+func (r Region) onSide(id BlockID) bool {
+	return r.onWall(id) || id.Y == r.Min.Y || id.Y == r.Max.Y
+}
+
+// Fill sets all blocks of r to tp, it returns the number of blocks changed
+func (w *World) Fill(r Region, tp BlockType) (int, error) {
+	return w.editRegion(r, func(id BlockID, old BlockType) BlockType {
+		return tp
+	})
+}
+
+// Replace sets blocks of r which are from to to
+func (w *World) Replace(r Region, from, to BlockType) (int, error) {
+	return w.editRegion(r, func(id BlockID, old BlockType) BlockType {
+		if old == from {
+			return to
+		}
+		return old
+	})
+}
+
+// Walls sets blocks of the four vertical sides of r to tp, floor, ceiling and inside are kept
+func (w *World) Walls(r Region, tp BlockType) (int, error) {
+	return w.editRegion(r, func(id BlockID, old BlockType) BlockType {
+		if r.onWall(id) {
+			return tp
+		}
+		return old
+	})
+}
+
+// Hollow sets blocks of the six sides of r to tp, and clears the inside
+func (w *World) Hollow(r Region, tp BlockType) (int, error) {
+	return w.editRegion(r, func(id BlockID, old BlockType) BlockType {
+		if r.onSide(id) {
+			return tp
+		}
+		return 0
+	})
+}
+
+// Clear removes all blocks of r
+func (w *World) Clear(r Region) (int, error) {
+	return w.Fill(r, 0)
+}
+
+// editRegion sets blocks of r to f of their id and block, chunk by chunk.
+// Edits of all chunks are committed in one store transaction, then loaded chunks are changed
+func (w *World) editRegion(r Region, f func(id BlockID, old BlockType) BlockType) (int, error) {
+	x, y, z := r.Size()
+	if x > editMaxSide || y > editMaxSide || z > editMaxSide || x*y*z > editMaxBlocks {
+		return 0, fmt.Errorf("region of %dx%dx%d blocks is larger than %d blocks", x, y, z, editMaxBlocks)
+	}
+
+	edits := make(map[ChunkID]map[BlockID]BlockType)
+	n := 0
+	lo, hi := r.Min.ChunkID(), r.Max.ChunkID()
+	for cy := lo.Y; cy <= hi.Y; cy++ {
+		for cz := lo.Z; cz <= hi.Z; cz++ {
+			for cx := lo.X; cx <= hi.X; cx++ {
+				cid := ChunkID{cx, cy, cz}
+				chunk := w.peekChunk(cid)
+				if chunk == nil {
+					return 0, fmt.Errorf("read chunk %v failed", cid)
+				}
+				cr := r.intersect(Region{
+					BlockID{cx * ChunkWidth, cy * ChunkWidth, cz * ChunkWidth},
+					BlockID{(cx+1)*ChunkWidth - 1, (cy+1)*ChunkWidth - 1, (cz+1)*ChunkWidth - 1},
+				})
+				var blocks map[BlockID]BlockType
+				for by := cr.Min.Y; by <= cr.Max.Y; by++ {
+					for bz := cr.Min.Z; bz <= cr.Max.Z; bz++ {
+						for bx := cr.Min.X; bx <= cr.Max.X; bx++ {
+							id := BlockID{bx, by, bz}
+							old := chunk.Block(id)
+							tp := f(id, old)
+							if tp == old {
+								continue
+							}
+							if blocks == nil {
+								blocks = make(map[BlockID]BlockType)
+								edits[cid] = blocks
+							}
+							blocks[id] = tp
+							n++
+						}
+					}
+				}
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := w.store.UpdateBlocks(edits); err != nil {
+		return 0, err
+	}
+	w.applyEdits(edits)
+	return n, nil
+}
+
+// editParts edits r like editRegion, in parts cut on chunk borders if it is too large to be edited at once.
+// Each part is committed on its own
+func (w *World) editParts(r Region, f func(id BlockID, old BlockType) BlockType) (int, error) {
+	x, y, z := r.Size()
+	if x <= editMaxSide && y <= editMaxSide && z <= editMaxSide && x*y*z <= editMaxBlocks {
+		return w.editRegion(r, f)
+	}
+	// the longest side is cut in halves
+	a, b := r, r
+	sides := []struct {
+		n, min int
+		max    *int
+		next   *int
+	}{{x, r.Min.X, &a.Max.X, &b.Min.X}, {y, r.Min.Y, &a.Max.Y, &b.Min.Y}, {z, r.Min.Z, &a.Max.Z, &b.Min.Z}}
+	side := sides[0]
+	for _, s := range sides[1:] {
+		if s.n > side.n {
+			side = s
+		}
+	}
+	cut := BlockID{side.min + side.n/2, 0, 0}.ChunkID().X * ChunkWidth
+	if cut <= side.min {
+		cut = side.min + side.n/2
+	}
+	*side.max, *side.next = cut-1, cut
+
+	n, err := w.editParts(a, f)
+	if err != nil {
+		return n, err
+	}
+	m, err := w.editParts(b, f)
+	return n + m, err
+}
+
+// applyEdits sets saved edits in loaded chunks, and bumps versions of the edited chunks
+// and of loaded chunks next to edited blocks, whose faces may be shown or hidden
+func (w *World) applyEdits(edits map[ChunkID]map[BlockID]BlockType) {
+	loaded := make(map[*Chunk]map[BlockID]BlockType)
+	neighbors := make(map[ChunkID]bool)
+	for cid, blocks := range edits {
+		if chunk, ok := w.loadChunk(cid); ok {
+			loaded[chunk] = blocks
+		}
+		for id := range blocks {
+			for _, neighbor := range []BlockID{id.Left(), id.Right(), id.Front(), id.Back(), id.Up(), id.Down()} {
+				if ncid := neighbor.ChunkID(); ncid != cid {
+					neighbors[ncid] = true
+				}
+			}
+		}
+	}
+	// blocks are all set before light is updated, so light is spread once whatever the size of the edit
+	w.addBlocks(loaded)
+	for cid, blocks := range edits {
+		w.editMutex.Lock()
+		w.edits[cid] += int64(len(blocks))
+		w.editMutex.Unlock()
+	}
+	for cid := range neighbors {
+		if chunk, ok := w.loadChunk(cid); ok {
+			chunk.UpdateVersion()
+		}
+	}
+}
+
+// editCommandBlocks : number of blocks each edit command takes at most
+var editCommandBlocks = map[string]int{
+	"fill":    1,
+	"replace": 2,
+	"walls":   1,
+	"hollow":  1,
+	"clear":   0,
+}
+
+// editCommand runs an edit command line on r, blocks it does not name are item:
+//
+//	fill [block]
+//	replace from [to]
+//	walls [block]
+//	hollow [block]
+//	clear
+//
+// it returns the number of blocks changed
+func editCommand(w *World, r Region, line string, item BlockType) (int, error) {
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "/"))
+	if len(args) == 0 {
+		return 0, errors.New("no command")
+	}
+	cmd, names := args[0], args[1:]
+	nblocks, ok := editCommandBlocks[cmd]
+	if !ok {
+		return 0, fmt.Errorf("unknown command %s", cmd)
+	}
+	if len(names) > nblocks {
+		return 0, fmt.Errorf("%s takes at most %d blocks", cmd, nblocks)
+	}
+	blocks := []BlockType{item, item}
+	for i, name := range names {
+		tp, ok := registry.Lookup(name)
+		if !ok {
+			return 0, fmt.Errorf("no block %s", name)
+		}
+		blocks[i] = tp
+	}
+
+	switch cmd {
+	case "fill":
+		return w.Fill(r, blocks[0])
+	case "replace":
+		if len(names) == 0 {
+			return 0, errors.New("replace needs the block to replace")
+		}
+		return w.Replace(r, blocks[0], blocks[1])
+	case "walls":
+		return w.Walls(r, blocks[0])
+	case "hollow":
+		return w.Hollow(r, blocks[0])
+	}
+	return w.Clear(r)
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegion(t *testing.T) {
+	r := NewRegion(BlockID{3, -1, 5}, BlockID{-2, 4, 5})
+	assert.Equal(t, Region{BlockID{-2, -1, 5}, BlockID{3, 4, 5}}, r)
+	x, y, z := r.Size()
+	assert.Equal(t, []int{6, 6, 1}, []int{x, y, z})
+	assert.True(t, r.Contains(BlockID{-2, 4, 5}))
+	assert.False(t, r.Contains(BlockID{-2, 4, 6}))
+
+	o := Region{BlockID{0, -10, 0}, BlockID{10, 2, 10}}
+	assert.Equal(t, Region{BlockID{0, -1, 5}, BlockID{3, 2, 5}}, r.intersect(o))
+	assert.Equal(t, r.intersect(o), o.intersect(r))
+}
+
+// editTestWorld returns a world of flat stone up to y 9, and its store
+func editTestWorld(t *testing.T) (*World, *Store, func()) {
+	store, done := newTestStore(t)
+	return NewWorld(store, &flatGenerator{}), store, done
+}
+
+func TestEdit_Fill(t *testing.T) {
+	w, store, done := editTestWorld(t)
+	defer done()
+	brick := lookupBlock(t, "brick")
+
+	// across chunks of x and z, the stone below y 10 is replaced too
+	r := NewRegion(BlockID{-1, 9, 31}, BlockID{1, 11, 32})
+	n, err := w.Fill(r, brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 3*3*2, n)
+	want := make(map[BlockID]BlockType)
+	for y := 9; y <= 11; y++ {
+		for z := 31; z <= 32; z++ {
+			for x := -1; x <= 1; x++ {
+				want[BlockID{x, y, z}] = brick
+			}
+		}
+	}
+	assert.Equal(t, want, storeOverrides(t, store))
+
+	// nothing to change
+	n, err = w.Fill(r, brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = w.Clear(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 18, n)
+	for bid := range want {
+		want[bid] = 0
+	}
+	assert.Equal(t, want, storeOverrides(t, store))
+	assert.Equal(t, BlockType(0), w.Chunk(BlockID{0, 9, 32}.ChunkID()).Block(BlockID{0, 9, 32}))
+
+	_, err = w.Fill(NewRegion(BlockID{0, 0, 0}, BlockID{editMaxSide, 0, 0}), brick)
+	assert.NotNil(t, err)
+	_, err = w.Fill(NewRegion(BlockID{0, 0, 0}, BlockID{1 << 8, 1 << 8, 1 << 8}), brick)
+	assert.NotNil(t, err)
+}
+
+func TestEdit_Shapes(t *testing.T) {
+	brick, glass := lookupBlock(t, "brick"), lookupBlock(t, "glass")
+	// a 4x4x4 box whose lower half is stone
+	r := NewRegion(BlockID{0, 8, 0}, BlockID{3, 11, 3})
+	for _, c := range []struct {
+		name string
+		edit func(w *World) (int, error)
+		// block x, y, z of the box after the edit
+		block func(x, y, z int) BlockType
+	}{
+		{"walls", func(w *World) (int, error) { return w.Walls(r, brick) }, func(x, y, z int) BlockType {
+			switch {
+			case x == 0 || x == 3 || z == 0 || z == 3:
+				return brick
+			case y < 10:
+				return stoneBlock
+			}
+			return 0
+		}},
+		{"hollow", func(w *World) (int, error) { return w.Hollow(r, glass) }, func(x, y, z int) BlockType {
+			if x == 0 || x == 3 || z == 0 || z == 3 || y == 8 || y == 11 {
+				return glass
+			}
+			return 0
+		}},
+		{"replace", func(w *World) (int, error) { return w.Replace(r, stoneBlock, brick) }, func(x, y, z int) BlockType {
+			if y < 10 {
+				return brick
+			}
+			return 0
+		}},
+	} {
+		w, _, done := editTestWorld(t)
+		n, err := c.edit(w)
+		assert.Nil(t, err, c.name)
+		changed := 0
+		for y := 8; y <= 11; y++ {
+			for z := 0; z <= 3; z++ {
+				for x := 0; x <= 3; x++ {
+					bid := BlockID{x, y, z}
+					assert.Equal(t, c.block(x, y, z), w.Chunk(bid.ChunkID()).Block(bid), "%s %v", c.name, bid)
+					old := BlockType(0)
+					if y < 10 {
+						old = stoneBlock
+					}
+					if c.block(x, y, z) != old {
+						changed++
+					}
+				}
+			}
+		}
+		assert.Equal(t, changed, n, c.name)
+		// blocks around the box are kept
+		assert.Equal(t, stoneBlock, w.Chunk(ChunkID{}).Block(BlockID{4, 9, 0}))
+		assert.Equal(t, stoneBlock, w.Chunk(ChunkID{}).Block(BlockID{0, 7, 0}))
+		done()
+	}
+}
+
+func TestEdit_Versions(t *testing.T) {
+	w, store, done := editTestWorld(t)
+	defer done()
+
+	// loaded chunk with the edit, its loaded neighbour and a loaded chunk away from it
+	edited, neighbor, away := w.Chunk(ChunkID{0, 0, 0}), w.Chunk(ChunkID{-1, 0, 0}), w.Chunk(ChunkID{2, 0, 0})
+	for _, c := range []*Chunk{edited, neighbor, away} {
+		c.Version = 0
+	}
+	// an older edit waiting in the store queue
+	assert.Nil(t, w.UpdateBlock(BlockID{0, 9, 0}, lookupBlock(t, "glass")))
+	edited.Version = 0
+
+	n, err := w.Clear(NewRegion(BlockID{0, 9, 0}, BlockID{0, 9, 40}))
+	assert.Nil(t, err)
+	assert.Equal(t, 41, n)
+	assert.NotEqual(t, int64(0), edited.Version)
+	assert.NotEqual(t, int64(0), neighbor.Version)
+	assert.Equal(t, int64(0), away.Version)
+	assert.Equal(t, int64(1+32), w.editVersion(ChunkID{0, 0, 0}))
+	assert.Equal(t, int64(9), w.editVersion(ChunkID{0, 0, 1}))
+	assert.Equal(t, BlockType(0), edited.Block(BlockID{0, 9, 0}))
+
+	// the queued edit does not come back
+	assert.Nil(t, store.Flush())
+	assert.Equal(t, BlockType(0), storeOverrides(t, store)[BlockID{0, 9, 0}])
+}
+
+func TestEdit_Command(t *testing.T) {
+	w, _, done := editTestWorld(t)
+	defer done()
+	brick, glass := lookupBlock(t, "brick"), lookupBlock(t, "glass")
+	r := NewRegion(BlockID{0, 9, 0}, BlockID{1, 10, 0})
+	block := func(bid BlockID) BlockType {
+		return w.Chunk(bid.ChunkID()).Block(bid)
+	}
+
+	n, err := editCommand(w, r, "/fill", brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, brick, block(BlockID{1, 10, 0}))
+
+	n, err = editCommand(w, r, " replace brick  glass ", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, glass, block(BlockID{0, 9, 0}))
+
+	n, err = editCommand(w, r, "/replace glass", brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = editCommand(w, r, "/walls glass", brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = editCommand(w, r, "/clear", brick)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, BlockType(0), block(BlockID{0, 9, 0}))
+
+	for _, line := range []string{"", "/", "/paint brick", "/fill brick glass", "/fill marble", "/replace", "/replace a b c", "/clear brick"} {
+		_, err := editCommand(w, r, line, brick)
+		assert.NotNil(t, err, line)
+	}
+}
@@ -1,6 +1,10 @@
+//go:build !headless
+// +build !headless
+
 package internal
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"time"
@@ -11,22 +15,37 @@ import (
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+var (
+	reach         = flag.Float64("reach", 8, "max distance to add and remove blocks")
+	schematicPath = flag.String("schematic", "copy.schem", "schematic file blocks are copied to and pasted from")
+)
+
 type Game struct {
 	win *glfw.Window
 
 	camera   *Camera
+	physics  *Physics
 	lx, ly   float64
 	vy       float32
 	prevtime float64
 
-	blockRender *BlockRender
-	lineRender  *LineRender
+	blockRender  *BlockRender
+	lineRender   *LineRender
+	playerRender *PlayerRender
 
 	world   *World
+	client  *Client
 	itemidx int
 	item    BlockType
 	fps     FPS
 
+	// corners of the selected box, and the blocks copied or read from -schematic
+	corners   [2]*BlockID
+	clipboard *Schematic
+	// edit command being typed, after / is pressed
+	typing  bool
+	command []rune
+
 	exclusiveMouse bool
 	closed         bool
 }
@@ -57,13 +76,13 @@ func initGL(w, h int) *glfw.Window {
 	return win
 }
 
-func NewGame(w, h int) (*Game, error) {
+func NewGame(w, h int, world *World) (*Game, error) {
 	var (
 		err  error
 		game *Game
 	)
 	game = new(Game)
-	game.item = availableItems[0]
+	game.item = registry.Items()[0]
 
 	mainthread.Call(func() {
 		win := initGL(w, h)
@@ -71,11 +90,15 @@ func NewGame(w, h int) (*Game, error) {
 		win.SetCursorPosCallback(game.onCursorPosCallback)
 		win.SetFramebufferSizeCallback(game.onFrameBufferSizeCallback)
 		win.SetKeyCallback(game.onKeyCallback)
+		win.SetCharCallback(game.onCharCallback)
 		game.win = win
 	})
 
-	game.world = NewWorld(GlobalStore)
+	game.world = world
+	// shade of blocks comes from their light
+	world.EnableLight()
 	game.camera = NewCamera(mgl32.Vec3{0, 16, 0})
+	game.physics = NewPhysics()
 	game.blockRender, err = NewBlockRender(game)
 	if err != nil {
 		return nil, err
@@ -87,6 +110,10 @@ func NewGame(w, h int) (*Game, error) {
 	if err != nil {
 		return nil, err
 	}
+	game.playerRender, err = NewPlayerRender(game)
+	if err != nil {
+		return nil, err
+	}
 	go game.blockRender.UpdateLoop()
 	return game, nil
 }
@@ -111,31 +138,36 @@ func (g *Game) dirtyBlock(id BlockID) {
 	}
 }
 
+// hitBlock returns block which camera is looking at
+func (g *Game) hitBlock() *RayHit {
+	return g.world.Raycast(g.camera.Pos(), g.camera.Front(), float32(*reach), nil)
+}
+
 func (g *Game) onMouseButtonCallback(win *glfw.Window, button glfw.MouseButton, action glfw.Action, mod glfw.ModifierKey) {
 	if !g.exclusiveMouse {
 		g.setExclusiveMouse(true)
 		return
 	}
-	head := NearBlock(g.camera.Pos())
-	foot := head.Down()
-	block, prev := g.world.HitTest(g.camera.Pos(), g.camera.Front())
-	if button == glfw.MouseButton2 && action == glfw.Press {
-		if prev != nil && *prev != head && *prev != foot {
-			chunk := g.world.BlockChunk(*prev)
-			chunk.Add(*prev, g.item)
-			GlobalStore.UpdateChunk(chunk.ID(), chunk.blocks)
-			//GlobalStore.UpdateBlock(*prev, g.item)
-			g.dirtyBlock(*prev)
+	hit := g.hitBlock()
+	if hit == nil || action != glfw.Press {
+		return
+	}
+	if button == glfw.MouseButton2 {
+		prev := hit.Adjacent()
+		if prev != hit.Block && !g.physics.Overlaps(g.camera.Pos(), prev) {
+			err := g.world.UpdateBlock(prev, g.item)
+			if err != nil {
+				log.Printf("update block %v error:%s", prev, err)
+			}
+			g.dirtyBlock(prev)
 		}
 	}
-	if button == glfw.MouseButton1 && action == glfw.Press {
-		if block != nil {
-			chunk := g.world.BlockChunk(*block)
-			chunk.Del(*block)
-			GlobalStore.UpdateChunk(chunk.ID(), chunk.blocks)
-			//GlobalStore.UpdateBlock(*block, 0)
-			g.dirtyBlock(*block)
+	if button == glfw.MouseButton1 {
+		err := g.world.UpdateBlock(hit.Block, 0)
+		if err != nil {
+			log.Printf("update block %v error:%s", hit.Block, err)
 		}
+		g.dirtyBlock(hit.Block)
 	}
 }
 
@@ -157,29 +189,182 @@ func (g *Game) onCursorPosCallback(win *glfw.Window, xpos float64, ypos float64)
 }
 
 func (g *Game) onKeyCallback(win *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press && action != glfw.Repeat {
+		return
+	}
+	if g.typing {
+		g.onCommandKey(key)
+		return
+	}
 	if action != glfw.Press {
 		return
 	}
 	switch key {
+	case glfw.KeySlash:
+		// the slash comes again as the first char of the command
+		g.typing = true
+		g.command = nil
 	case glfw.KeyTab:
 		g.camera.FlipFlying()
 	case glfw.KeySpace:
-		block := g.CurrentBlockid()
-		if g.world.HasBlock(BlockID{block.X, block.Y - 2, block.Z}) {
+		if g.physics.OnGround {
 			g.vy = 8
 		}
 	case glfw.KeyE:
-		g.itemidx = (1 + g.itemidx) % len(availableItems)
-		g.item = availableItems[g.itemidx]
+		items := registry.Items()
+		g.itemidx = (1 + g.itemidx) % len(items)
+		g.item = items[g.itemidx]
 		g.blockRender.UpdateItem(g.item)
 	case glfw.KeyR:
+		items := registry.Items()
 		g.itemidx--
 		if g.itemidx < 0 {
-			g.itemidx = len(availableItems) - 1
+			g.itemidx = len(items) - 1
 		}
-		g.item = availableItems[g.itemidx]
+		g.item = items[g.itemidx]
 		g.blockRender.UpdateItem(g.item)
+	case glfw.KeyZ:
+		g.selectCorner(0)
+	case glfw.KeyX:
+		g.selectCorner(1)
+	case glfw.KeyC:
+		g.copySelection()
+	case glfw.KeyV:
+		g.pasteClipboard()
+	case glfw.KeyT:
+		if g.loadClipboard() {
+			g.clipboard = g.clipboard.Rotate(1)
+			log.Printf("schematic turned, %dx%dx%d", g.clipboard.Width, g.clipboard.Height, g.clipboard.Length)
+		}
+	case glfw.KeyM:
+		if g.loadClipboard() {
+			g.clipboard = g.clipboard.Mirror()
+			log.Printf("schematic mirrored")
+		}
+	}
+}
+
+// onCommandKey edits the command being typed, it is run by enter
+func (g *Game) onCommandKey(key glfw.Key) {
+	switch key {
+	case glfw.KeyEscape:
+		g.typing = false
+	case glfw.KeyBackspace:
+		if len(g.command) > 0 {
+			g.command = g.command[:len(g.command)-1]
+		}
+	case glfw.KeyEnter:
+		g.typing = false
+		g.runCommand(string(g.command))
+	}
+}
+
+func (g *Game) onCharCallback(win *glfw.Window, char rune) {
+	if g.typing {
+		g.command = append(g.command, char)
+	}
+}
+
+// keyDown reports whether key is held, keys are typed into commands while one is typed
+func (g *Game) keyDown(key glfw.Key) bool {
+	return !g.typing && g.win.GetKey(key) == glfw.Press
+}
+
+// selection returns the box between the corners, or the one corner selected
+func (g *Game) selection() (Region, bool) {
+	a, b := g.corners[0], g.corners[1]
+	if a == nil {
+		a = b
+	}
+	if b == nil {
+		b = a
+	}
+	if a == nil {
+		return Region{}, false
+	}
+	return NewRegion(*a, *b), true
+}
+
+// runCommand runs edit command line on the selection, with the current block
+func (g *Game) runCommand(line string) {
+	r, ok := g.selection()
+	if !ok {
+		log.Printf("select corners to edit, with Z and X")
+		return
+	}
+	n, err := editCommand(g.world, r, line, g.item)
+	if err != nil {
+		log.Printf("%s error:%s", line, err)
+		return
+	}
+	log.Printf("%s: %d blocks changed", line, n)
+}
+
+// selectCorner sets corner i of the selected box to the block looked at
+func (g *Game) selectCorner(i int) {
+	hit := g.hitBlock()
+	if hit == nil {
+		return
+	}
+	bid := hit.Block
+	g.corners[i] = &bid
+	log.Printf("corner %d at %v", i+1, bid)
+}
+
+// copySelection copies the selected box, and saves it to -schematic
+func (g *Game) copySelection() {
+	r, ok := g.selection()
+	if !ok {
+		log.Printf("select corners to copy, with Z and X")
+		return
+	}
+	s, err := CopySchematic(g.world, r.Min, r.Max)
+	if err != nil {
+		log.Printf("copy error:%s", err)
+		return
+	}
+	g.clipboard = s
+	err = WriteSchematicFile(*schematicPath, s, LoadSchematicMapping())
+	if err != nil {
+		log.Printf("save schematic error:%s", err)
+		return
 	}
+	log.Printf("%dx%dx%d blocks copied to %s", s.Width, s.Height, s.Length, *schematicPath)
+}
+
+// loadClipboard reads -schematic if nothing was copied yet, it reports whether there are blocks to paste
+func (g *Game) loadClipboard() bool {
+	if g.clipboard != nil {
+		return true
+	}
+	s, unmapped, err := ReadSchematicFile(*schematicPath, LoadSchematicMapping())
+	if err != nil {
+		log.Printf("read schematic error:%s", err)
+		return false
+	}
+	for name, n := range unmapped {
+		log.Printf("unmapped %s: %d blocks", name, n)
+	}
+	g.clipboard = s
+	return true
+}
+
+// pasteClipboard pastes the blocks with their lowest corner at the block in front of the one looked at
+func (g *Game) pasteClipboard() {
+	hit := g.hitBlock()
+	if hit == nil || !g.loadClipboard() {
+		return
+	}
+	n, err := g.clipboard.Paste(g.world, hit.Adjacent(), false)
+	if err != nil {
+		log.Printf("paste error:%s", err)
+	}
+	log.Printf("%d blocks pasted at %v", n, hit.Adjacent())
+}
+
+// SetClient sets client of the server, whose players are drawn
+func (g *Game) SetClient(client *Client) {
+	g.client = client
 }
 
 func (g *Game) Camera() *Camera {
@@ -191,33 +376,37 @@ func (g *Game) handleKeyInput(dt float64) {
 	if g.camera.flying {
 		speed = 0.2
 	}
-	if g.win.GetKey(glfw.KeyEscape) == glfw.Press {
+	g.physics.Sneak = !g.camera.Flying() && g.keyDown(glfw.KeyLeftShift)
+	if g.physics.Sneak {
+		speed = 0.03
+	}
+	old := g.camera.Pos()
+	if g.keyDown(glfw.KeyEscape) {
 		g.setExclusiveMouse(false)
 	}
-	if g.win.GetKey(glfw.KeyW) == glfw.Press {
+	if g.keyDown(glfw.KeyW) {
 		g.camera.OnMoveChange(MoveForward, speed)
 	}
-	if g.win.GetKey(glfw.KeyS) == glfw.Press {
+	if g.keyDown(glfw.KeyS) {
 		g.camera.OnMoveChange(MoveBackward, speed)
 	}
-	if g.win.GetKey(glfw.KeyA) == glfw.Press {
+	if g.keyDown(glfw.KeyA) {
 		g.camera.OnMoveChange(MoveLeft, speed)
 	}
-	if g.win.GetKey(glfw.KeyD) == glfw.Press {
+	if g.keyDown(glfw.KeyD) {
 		g.camera.OnMoveChange(MoveRight, speed)
 	}
-	pos := g.camera.Pos()
-	stop := false
+	delta := g.camera.Pos().Sub(old)
 	if !g.camera.Flying() {
 		g.vy -= float32(dt * 20)
 		if g.vy < -50 {
 			g.vy = -50
 		}
-		pos = mgl32.Vec3{pos.X(), pos.Y() + g.vy*float32(dt), pos.Z()}
+		delta[1] += g.vy * float32(dt)
 	}
 
-	pos, stop = g.world.Collide(pos)
-	if stop {
+	pos := g.physics.Move(g.world, old, delta)
+	if (g.physics.OnGround && g.vy < 0) || (g.physics.HitCeiling && g.vy > 0) {
 		g.vy = 0
 	}
 	g.camera.SetPos(pos)
@@ -239,6 +428,9 @@ func (g *Game) renderStat() {
 	stat := g.blockRender.Stat()
 	title := fmt.Sprintf("[%.2f %.2f %.2f] %v [%d/%d %d] %d", p.X(), p.Y(), p.Z(),
 		cid, stat.RendingChunks, stat.CacheChunks, stat.Faces, g.fps.Fps())
+	if g.typing {
+		title = string(g.command) + "_"
+	}
 	g.win.SetTitle(title)
 }
 
@@ -260,6 +452,7 @@ func (g *Game) Update() {
 		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
 		g.blockRender.Draw()
+		g.playerRender.Draw()
 		g.lineRender.Draw()
 
 		g.renderStat()
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+)
+
+var (
+	worldSeed     = flag.Int64("seed", 0, "world seed, only used by new world")
+	generatorName = flag.String("gen", biomeGeneratorName, "terrain generator, only used by new world")
+)
+
+// Generator : makes the blocks of chunks before any player edit
+type Generator interface {
+	Name() string
+	Seed() int64
+	// Chunk returns ChunkWidth^3 blocks indexed by BlockID.ToIndex
+	Chunk(id ChunkID) []BlockType
+}
+
+var generators = make(map[string]func(seed int64) Generator)
+
+func RegisterGenerator(name string, f func(seed int64) Generator) {
+	if _, ok := generators[name]; ok {
+		log.Panicf("generator %s already registered", name)
+	}
+	generators[name] = f
+}
+
+func NewGenerator(name string, seed int64) (Generator, error) {
+	f, ok := generators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q, available:%v", name, GeneratorNames())
+	}
+	return f(seed), nil
+}
+
+func GeneratorNames() []string {
+	var names []string
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenGenerator returns the generator saved in store.
+// A new world saves the -gen and -seed flags,
+// a world saved before generators were configurable uses classic generator with seed 0.
+func OpenGenerator(store *Store) (Generator, error) {
+	name, seed, ok, err := store.GeneratorMeta()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		name, seed = *generatorName, *worldSeed
+		legacy, err := store.HasChunks()
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			name, seed = classicGeneratorName, 0
+		}
+	} else if name != *generatorName || seed != *worldSeed {
+		log.Printf("use saved generator %s with seed %d", name, seed)
+	}
+
+	gen, err := NewGenerator(name, seed)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		err = store.SaveGeneratorMeta(name, seed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = store.MigrateChunks(gen.Chunk)
+	if err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+const classicGeneratorName = "classic"
+
+func init() {
+	RegisterGenerator(classicGeneratorName, func(seed int64) Generator {
+		return &classicGenerator{
+			seed:  seed,
+			noise: NewNoise(seed),
+		}
+	})
+}
+
+// classicGenerator : the first terrain of gocraft, grass over sand with flowers and leaves
+type classicGenerator struct {
+	seed  int64
+	noise *Noise
+}
+
+func (g *classicGenerator) Name() string {
+	return classicGeneratorName
+}
+
+func (g *classicGenerator) Seed() int64 {
+	return g.seed
+}
+
+func (g *classicGenerator) Chunk(cid ChunkID) []BlockType {
+	const (
+		grassBlock = 1
+		sandBlock  = 2
+		grass      = 17
+		leaves     = 15
+		wood       = 5
+	)
+	noise2, noise3 := g.noise.noise2, g.noise.noise3
+	m := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+	startY, endY := cid.Y*ChunkWidth, (cid.Y+1)*ChunkWidth-1
+	p, q := cid.X, cid.Z
+	for dx := 0; dx < ChunkWidth; dx++ {
+		for dz := 0; dz < ChunkWidth; dz++ {
+			x, z := p*ChunkWidth+dx, q*ChunkWidth+dz
+			f := noise2(float32(x)*0.01, float32(z)*0.01, 4, 0.5, 2)
+			g := noise2(float32(-x)*0.01, float32(-z)*0.01, 2, 0.9, 2)
+			mh := int(g*32 + 16)
+			h := int(f * float32(mh))
+			var w BlockType = grassBlock
+			if h <= 12 {
+				h = 12
+				w = sandBlock
+			}
+
+			// grass and sand
+			for y := 0; y < h; y++ {
+				if y >= startY && y <= endY {
+					m[BlockID{x, y, z}.ToIndex()] = w
+				}
+			}
+
+			// flowers
+			if h >= startY && h <= endY {
+				if w == grassBlock {
+					if noise2(-float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2) > 0.6 {
+						m[BlockID{x, h, z}.ToIndex()] = grass
+					}
+					if noise2(float32(x)*0.05, float32(-z)*0.05, 4, 0.8, 2) > 0.7 {
+						w := BlockType(18 + int(noise2(float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2)*7))
+						m[BlockID{x, h, z}.ToIndex()] = w
+					}
+				}
+			}
+
+			// tree
+			if w == 1 {
+				ok := true
+				if dx-4 < 0 || dz-4 < 0 ||
+					dx+4 > ChunkWidth || dz+4 > ChunkWidth {
+					ok = false
+				}
+				if ok && noise2(float32(x), float32(z), 6, 0.5, 2) > 0.79 {
+					for y := h + 3; y < h+8; y++ {
+						for ox := -3; ox <= 3; ox++ {
+							for oz := -3; oz <= 3; oz++ {
+								d := ox*ox + oz*oz + (y-h-4)*(y-h-4)
+								if d < 11 {
+									if y >= startY && y <= endY {
+										m[BlockID{x + ox, y, z + oz}.ToIndex()] = leaves
+									}
+								}
+							}
+						}
+					}
+					for y := h; y < h+7; y++ {
+						if y >= startY && y <= endY {
+						}
+					}
+				}
+			}
+
+			// cloud
+			for y := 64; y < 72; y++ {
+				if y >= startY && y <= endY && noise3(float32(x)*0.01, float32(y)*0.1, float32(z)*0.01, 8, 0.5, 2) > 0.69 {
+					m[BlockID{x, y, z}.ToIndex()] = 16
+				}
+			}
+		}
+	}
+	return m
+}
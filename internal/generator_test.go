@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_Seed(t *testing.T) {
+	cid := ChunkID{0, 0, 0}
+	a, err := NewGenerator(classicGeneratorName, 1)
+	assert.Nil(t, err)
+	b, _ := NewGenerator(classicGeneratorName, 1)
+	c, _ := NewGenerator(classicGeneratorName, 2)
+
+	assert.Equal(t, int64(1), a.Seed())
+	assert.Equal(t, a.Chunk(cid), b.Chunk(cid))
+	assert.NotEqual(t, a.Chunk(cid), c.Chunk(cid))
+
+	_, err = NewGenerator("nope", 1)
+	assert.NotNil(t, err)
+}
+
+func TestOpenGenerator(t *testing.T) {
+	name, seed := *generatorName, *worldSeed
+	defer func() {
+		*generatorName, *worldSeed = name, seed
+	}()
+	*generatorName, *worldSeed = classicGeneratorName, 7
+
+	// new world saves flags
+	store, done := newTestStore(t)
+	defer done()
+	gen, err := OpenGenerator(store)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), gen.Seed())
+
+	// saved world ignores flags
+	*worldSeed = 8
+	gen, err = OpenGenerator(store)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), gen.Seed())
+}
+
+func TestOpenGenerator_Legacy(t *testing.T) {
+	seed := *worldSeed
+	defer func() {
+		*worldSeed = seed
+	}()
+	*worldSeed = 7
+
+	store, done := newTestStore(t)
+	defer done()
+	assert.Nil(t, store.UpdateBlock(BlockID{1, 2, 3}, 4))
+	assert.Nil(t, store.Flush())
+
+	gen, err := OpenGenerator(store)
+	assert.Nil(t, err)
+	assert.Equal(t, classicGeneratorName, gen.Name())
+	assert.Equal(t, int64(0), gen.Seed())
+}
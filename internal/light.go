@@ -0,0 +1,367 @@
+package internal
+
+// light levels of blocks, sky light comes down from above and block light from emissive blocks,
+// both fall by one for each block they spread, except sky light going straight down
+
+const (
+	maxLight = 15
+
+	// ChunkWidth is 1 << chunkShift
+	chunkShift = 5
+)
+
+// lightKind : shift of a light in lightMap
+type lightKind uint
+
+const (
+	blockLight lightKind = 0
+	skyLight   lightKind = 4
+)
+
+// lightMap : sky light in the high and block light in the low 4 bits of each block of a chunk
+type lightMap [ChunkWidth * ChunkWidth * ChunkWidth]uint8
+
+func (m *lightMap) get(i int, k lightKind) uint8 {
+	return m[i] >> k & 0xf
+}
+
+func (m *lightMap) set(i int, k lightKind, v uint8) {
+	m[i] = m[i]&^(0xf<<k) | v<<k
+}
+
+// EnableLight makes w light chunks when they load and relight blocks around edits
+func (w *World) EnableLight() {
+	w.lightOn = true
+}
+
+// lighter : one run of light propagation over loaded chunks, w.lightMutex must be held,
+// so blocks of chunks do not change and are read without locks
+type lighter struct {
+	w       *World
+	chunks  map[ChunkID]*Chunk // nil for chunks not loaded
+	changed map[*Chunk]bool
+
+	// last chunks looked up and changed, most lookups hit the same chunk
+	lastID      ChunkID
+	last        *Chunk
+	lastChanged *Chunk
+}
+
+func newLighter(w *World) *lighter {
+	return &lighter{
+		w:       w,
+		chunks:  make(map[ChunkID]*Chunk),
+		changed: make(map[*Chunk]bool),
+		lastID:  ChunkID{1 << 30, 0, 0},
+	}
+}
+
+func (l *lighter) chunk(cid ChunkID) *Chunk {
+	c, ok := l.chunks[cid]
+	if !ok {
+		c, _ = l.w.loadChunk(cid)
+		l.chunks[cid] = c
+	}
+	if c != nil && c.light == nil {
+		c.light = new(lightMap)
+	}
+	return c
+}
+
+// locate returns loaded chunk of block id, or nil, and index of the block in the chunk
+func (l *lighter) locate(id BlockID) (*Chunk, int) {
+	cid := ChunkID{id.X >> chunkShift, id.Y >> chunkShift, id.Z >> chunkShift}
+	if cid != l.lastID {
+		l.lastID, l.last = cid, l.chunk(cid)
+	}
+	const mask = ChunkWidth - 1
+	return l.last, id.X&mask + (id.Y&mask)*ChunkWidth + (id.Z&mask)*ChunkWidth*ChunkWidth
+}
+
+// block returns block id and whether its chunk is loaded
+func (l *lighter) block(id BlockID) (BlockType, bool) {
+	c, i := l.locate(id)
+	if c == nil {
+		return 0, false
+	}
+	return blockAt(c, i), true
+}
+
+func blockAt(c *Chunk, i int) BlockType {
+	if len(c.blocks) == 0 {
+		return 0
+	}
+	return c.blocks[i]
+}
+
+func (l *lighter) light(id BlockID, k lightKind) uint8 {
+	c, i := l.locate(id)
+	if c == nil {
+		return 0
+	}
+	return c.light.get(i, k)
+}
+
+func (l *lighter) setLight(id BlockID, k lightKind, v uint8) {
+	c, i := l.locate(id)
+	c.light.set(i, k, v)
+	if c != l.lastChanged {
+		l.changed[c] = true
+		l.lastChanged = c
+	}
+}
+
+// sinks returns whether light v of kind k keeps its level going from a block to its neighbour on side
+func sinks(k lightKind, side int, v uint8) bool {
+	return k == skyLight && side == sdown && v == maxLight
+}
+
+func neighbours(id BlockID) [6]BlockID {
+	return [...]BlockID{id.Left(), id.Right(), id.Up(), id.Down(), id.Front(), id.Back()}
+}
+
+// spread floods light of kind k from blocks of queue into transparent blocks around them
+func (l *lighter) spread(queue []BlockID, k lightKind) {
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		v := l.light(id, k)
+		if v <= 1 {
+			continue
+		}
+		for side, n := range neighbours(id) {
+			c, i := l.locate(n)
+			if c == nil || !blockAt(c, i).IsTransparent() {
+				continue
+			}
+			nv := v - 1
+			if sinks(k, side, v) {
+				nv = v
+			}
+			if c.light.get(i, k) < nv {
+				l.setLight(n, k, nv)
+				queue = append(queue, n)
+			}
+		}
+	}
+}
+
+// lightNode : a block and the light it had before removal
+type lightNode struct {
+	id BlockID
+	v  uint8
+}
+
+// remove darkens blocks lit by the blocks of queue, which are already dark,
+// and returns blocks whose light must spread again into the dark
+func (l *lighter) remove(queue []lightNode, k lightKind) []BlockID {
+	var relight []BlockID
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for side, n := range neighbours(node.id) {
+			nv := l.light(n, k)
+			if nv == 0 {
+				continue
+			}
+			if nv < node.v || sinks(k, side, node.v) {
+				l.setLight(n, k, 0)
+				queue = append(queue, lightNode{n, nv})
+				w, _ := l.block(n)
+				if e := registry.Def(w).Light; k == blockLight && e > 0 {
+					l.setLight(n, k, uint8(e))
+					relight = append(relight, n)
+				}
+			} else {
+				relight = append(relight, n)
+			}
+		}
+	}
+	return relight
+}
+
+// done marks chunks with changed light for meshing
+func (l *lighter) done(skip *Chunk) {
+	for c := range l.changed {
+		if c != skip {
+			c.UpdateVersion()
+		}
+	}
+}
+
+// lightChunk lights chunk c which is being loaded, and chunks around it, and caches it.
+// Both are done under lightMutex, so chunks loaded next to it at the same time see it,
+// it returns the chunk cached by an other load of the same chunk if there is one
+func (w *World) lightChunk(c *Chunk) *Chunk {
+	w.lightMutex.Lock()
+	defer w.lightMutex.Unlock()
+
+	cid := c.ID()
+	if loaded, ok := w.loadChunk(cid); ok {
+		return loaded
+	}
+	l := newLighter(w)
+	l.chunks[cid] = c
+	c.light = new(lightMap)
+	sx, sy, sz := cid.X*ChunkWidth, cid.Y*ChunkWidth, cid.Z*ChunkWidth
+
+	var sky, blocks []BlockID
+	c.RangeBlocks(func(id BlockID, w BlockType) {
+		if e := registry.Def(w).Light; e > 0 {
+			l.setLight(id, blockLight, uint8(e))
+			blocks = append(blocks, id)
+		}
+	})
+
+	// nothing above a chunk on top of the loaded ones shades it
+	if l.chunk(cid.Up()) == nil {
+		for z := 0; z < ChunkWidth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				id := BlockID{sx + x, sy + ChunkWidth - 1, sz + z}
+				if c.Block(id).IsTransparent() {
+					l.setLight(id, skyLight, maxLight)
+					sky = append(sky, id)
+				}
+			}
+		}
+	}
+
+	// light coming in from loaded neighbours
+	for side, ncid := range []ChunkID{cid.Left(), cid.Right(), cid.Up(), cid.Down(), cid.Front(), cid.Back()} {
+		if l.chunk(ncid) == nil {
+			continue
+		}
+		for i := 0; i < ChunkWidth; i++ {
+			for j := 0; j < ChunkWidth; j++ {
+				var id BlockID
+				switch side {
+				case sleft:
+					id = BlockID{sx - 1, sy + i, sz + j}
+				case sright:
+					id = BlockID{sx + ChunkWidth, sy + i, sz + j}
+				case sup:
+					id = BlockID{sx + i, sy + ChunkWidth, sz + j}
+				case sdown:
+					id = BlockID{sx + i, sy - 1, sz + j}
+				case sfront:
+					id = BlockID{sx + i, sy + j, sz + ChunkWidth}
+				case sback:
+					id = BlockID{sx + i, sy + j, sz - 1}
+				}
+				sky = append(sky, id)
+				blocks = append(blocks, id)
+			}
+		}
+	}
+	l.spread(sky, skyLight)
+	l.spread(blocks, blockLight)
+
+	// the chunk below was lit as if open to the sky
+	if l.chunk(cid.Down()) != nil {
+		var dark []lightNode
+		for z := 0; z < ChunkWidth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				top, bottom := BlockID{sx + x, sy - 1, sz + z}, BlockID{sx + x, sy, sz + z}
+				if l.light(top, skyLight) == maxLight && l.light(bottom, skyLight) != maxLight {
+					l.setLight(top, skyLight, 0)
+					dark = append(dark, lightNode{top, maxLight})
+				}
+			}
+		}
+		l.spread(l.remove(dark, skyLight), skyLight)
+	}
+	l.done(c)
+	w.storeChunk(cid, c)
+	return c
+}
+
+// addBlock sets block id of loaded chunk to tp, and relights blocks around it if light is on
+func (w *World) addBlock(chunk *Chunk, id BlockID, tp BlockType) {
+	if !w.lightOn {
+		chunk.Add(id, tp)
+		return
+	}
+	w.lightMutex.Lock()
+	defer w.lightMutex.Unlock()
+	old := chunk.Block(id)
+	chunk.Add(id, tp)
+	w.updateLight([]blockChange{{id, old}})
+}
+
+// addBlocks sets blocks of loaded chunks like addBlock, and relights around all of them at once
+func (w *World) addBlocks(chunks map[*Chunk]map[BlockID]BlockType) {
+	if !w.lightOn {
+		for chunk, blocks := range chunks {
+			for id, tp := range blocks {
+				chunk.Add(id, tp)
+			}
+		}
+		return
+	}
+	w.lightMutex.Lock()
+	defer w.lightMutex.Unlock()
+	var changes []blockChange
+	for chunk, blocks := range chunks {
+		for id, tp := range blocks {
+			changes = append(changes, blockChange{id, chunk.Block(id)})
+			chunk.Add(id, tp)
+		}
+	}
+	w.updateLight(changes)
+}
+
+// blockChange : a block which changed, and the block it was
+type blockChange struct {
+	id  BlockID
+	old BlockType
+}
+
+// updateLight relights blocks around changed blocks in one run, w.lightMutex must be held
+func (w *World) updateLight(changes []blockChange) {
+	l := newLighter(w)
+	for _, k := range []lightKind{skyLight, blockLight} {
+		var dark []lightNode
+		var relight []BlockID
+		for _, change := range changes {
+			tp, ok := l.block(change.id)
+			if !ok {
+				continue
+			}
+			olddef, def := registry.Def(change.old), registry.Def(tp)
+			if v := l.light(change.id, k); v > 0 && (!def.Transparent || k == blockLight && olddef.Light > 0) {
+				l.setLight(change.id, k, 0)
+				dark = append(dark, lightNode{change.id, v})
+			}
+			if k == blockLight && def.Light > 0 {
+				l.setLight(change.id, k, uint8(def.Light))
+				relight = append(relight, change.id)
+			}
+		}
+		relight = append(relight, l.remove(dark, k)...)
+		// light flows into the opened blocks
+		for _, change := range changes {
+			if tp, ok := l.block(change.id); !ok || !registry.Def(tp).Transparent {
+				continue
+			}
+			for _, n := range neighbours(change.id) {
+				if l.light(n, k) > 1 {
+					relight = append(relight, n)
+				}
+			}
+		}
+		l.spread(relight, k)
+	}
+	l.done(nil)
+}
+
+// Light returns sky and block light of block id, or full sky light if it is not lit
+func (w *World) Light(id BlockID) (uint8, uint8) {
+	w.lightMutex.Lock()
+	defer w.lightMutex.Unlock()
+	c, ok := w.loadChunk(id.ChunkID())
+	if !ok || c.light == nil {
+		return maxLight, 0
+	}
+	i := id.ToIndex()
+	return c.light.get(i, skyLight), c.light.get(i, blockLight)
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lampBlock BlockType = 12
+
+// flatGenerator : stone up to y 9, and a stone ceiling at y ceiling if it is not 0
+type flatGenerator struct {
+	ceiling int
+}
+
+func (g *flatGenerator) Name() string { return "flat" }
+func (g *flatGenerator) Seed() int64  { return 0 }
+
+func (g *flatGenerator) Chunk(cid ChunkID) []BlockType {
+	m := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+	for y := cid.Y * ChunkWidth; y < (cid.Y+1)*ChunkWidth; y++ {
+		if y < 0 || (y >= 10 && (g.ceiling == 0 || y != g.ceiling)) {
+			continue
+		}
+		for z := 0; z < ChunkWidth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				m[BlockID{x, y, z}.ToIndex()] = stoneBlock
+			}
+		}
+	}
+	return m
+}
+
+func newLightTestWorld(t *testing.T, gen Generator) (*World, func()) {
+	store, done := newTestStore(t)
+	world := NewWorld(store, gen)
+	world.EnableLight()
+	return world, done
+}
+
+func loadChunks(w *World, cids ...ChunkID) {
+	for _, cid := range cids {
+		w.Chunk(cid)
+	}
+}
+
+func skyAt(w *World, id BlockID) uint8 {
+	sky, _ := w.Light(id)
+	return sky
+}
+
+func blockLightAt(w *World, id BlockID) uint8 {
+	_, block := w.Light(id)
+	return block
+}
+
+func TestLight_Sky(t *testing.T) {
+	w, done := newLightTestWorld(t, &flatGenerator{})
+	defer done()
+	loadChunks(w, ChunkID{0, 0, 0}, ChunkID{0, 1, 0})
+
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{5, 10, 5}))
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{5, 40, 5}))
+	assert.Equal(t, uint8(0), skyAt(w, BlockID{5, 9, 5}))
+
+	// a closed room is dark
+	for x := 0; x <= 4; x++ {
+		for y := 10; y <= 13; y++ {
+			for z := 0; z <= 4; z++ {
+				if x == 0 || x == 4 || z == 0 || z == 4 || y == 13 {
+					assert.Nil(t, w.UpdateBlock(BlockID{x, y, z}, stoneBlock))
+				}
+			}
+		}
+	}
+	assert.Equal(t, uint8(0), skyAt(w, BlockID{2, 10, 2}))
+	assert.Equal(t, uint8(0), skyAt(w, BlockID{1, 12, 3}))
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{5, 10, 5}))
+
+	// until a hole in the roof lets sun in
+	assert.Nil(t, w.UpdateBlock(BlockID{2, 13, 2}, 0))
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{2, 10, 2}))
+	assert.Equal(t, uint8(maxLight-1), skyAt(w, BlockID{1, 10, 2}))
+	assert.Equal(t, uint8(maxLight-2), skyAt(w, BlockID{1, 10, 1}))
+}
+
+func TestLight_Block(t *testing.T) {
+	w, done := newLightTestWorld(t, &flatGenerator{})
+	defer done()
+	loadChunks(w, ChunkID{0, 0, 0}, ChunkID{0, 1, 0})
+
+	lamp := BlockID{5, 10, 5}
+	assert.Nil(t, w.UpdateBlock(lamp, lampBlock))
+	assert.Equal(t, uint8(maxLight), blockLightAt(w, lamp))
+	assert.Equal(t, uint8(maxLight-1), blockLightAt(w, BlockID{5, 11, 5}))
+	assert.Equal(t, uint8(maxLight-3), blockLightAt(w, BlockID{6, 10, 7}))
+	// light does not get into stone
+	assert.Equal(t, uint8(0), blockLightAt(w, BlockID{5, 9, 5}))
+
+	// a wall makes light go around
+	assert.Nil(t, w.UpdateBlock(BlockID{6, 10, 5}, stoneBlock))
+	assert.Nil(t, w.UpdateBlock(BlockID{6, 11, 5}, stoneBlock))
+	assert.Equal(t, uint8(maxLight-4), blockLightAt(w, BlockID{7, 10, 5}))
+
+	assert.Nil(t, w.UpdateBlock(lamp, 0))
+	assert.Equal(t, uint8(0), blockLightAt(w, lamp))
+	assert.Equal(t, uint8(0), blockLightAt(w, BlockID{7, 10, 5}))
+}
+
+func TestLight_AcrossChunks(t *testing.T) {
+	w, done := newLightTestWorld(t, &flatGenerator{})
+	defer done()
+	loadChunks(w, ChunkID{0, 0, 0}, ChunkID{0, 1, 0})
+	assert.Nil(t, w.UpdateBlock(BlockID{31, 10, 5}, lampBlock))
+
+	// the neighbour takes light over the border when it loads
+	loadChunks(w, ChunkID{1, 0, 0})
+	assert.Equal(t, uint8(maxLight-1), blockLightAt(w, BlockID{32, 10, 5}))
+	assert.Equal(t, uint8(maxLight-3), blockLightAt(w, BlockID{34, 10, 5}))
+
+	// and gives light back to the other side
+	assert.Nil(t, w.UpdateBlock(BlockID{31, 10, 5}, 0))
+	assert.Nil(t, w.UpdateBlock(BlockID{33, 10, 5}, lampBlock))
+	assert.Equal(t, uint8(maxLight-2), blockLightAt(w, BlockID{31, 10, 5}))
+}
+
+func TestLight_ChunksLoadedTogether(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	gen := &flatGenerator{}
+	var cids []ChunkID
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			cids = append(cids, ChunkID{x, 0, z}, ChunkID{x, 1, z})
+		}
+	}
+	// lamps at both sides of chunk borders
+	assert.Nil(t, store.UpdateBlock(BlockID{31, 10, 5}, lampBlock))
+	assert.Nil(t, store.UpdateBlock(BlockID{32, 10, 20}, lampBlock))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 40; i++ {
+		id := BlockID{[]int{-33, -32, -1, 0, 31, 32}[r.Intn(6)], 10 + r.Intn(8), r.Intn(96) - 32}
+		assert.Nil(t, store.UpdateBlock(id, lampBlock))
+	}
+
+	want := NewWorld(store, gen)
+	want.EnableLight()
+	loadChunks(want, cids...)
+	assert.Equal(t, uint8(maxLight-1), blockLightAt(want, BlockID{32, 10, 5}))
+	assert.Equal(t, uint8(maxLight-1), blockLightAt(want, BlockID{31, 10, 20}))
+
+	// chunks loaded at the same time each see the others, whichever is lit first
+	for i := 0; i < 10; i++ {
+		w := NewWorld(store, gen)
+		w.EnableLight()
+		assert.Equal(t, len(cids), len(w.Chunks(cids)))
+		assert.Equal(t, lightMaps(want, cids), lightMaps(w, cids))
+	}
+}
+
+func TestLight_CeilingLoadedLater(t *testing.T) {
+	w, done := newLightTestWorld(t, &flatGenerator{ceiling: 40})
+	defer done()
+	// lit as open to the sky, until the ceiling above loads
+	loadChunks(w, ChunkID{0, 0, 0})
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{5, 20, 5}))
+
+	c := w.Chunk(ChunkID{0, 0, 0})
+	version := c.Version
+	loadChunks(w, ChunkID{0, 1, 0})
+	assert.Equal(t, uint8(maxLight), skyAt(w, BlockID{5, 41, 5}))
+	assert.Equal(t, uint8(0), skyAt(w, BlockID{5, 39, 5}))
+	assert.Equal(t, uint8(0), skyAt(w, BlockID{5, 20, 5}))
+	assert.NotEqual(t, version, c.Version)
+}
+
+// lightMaps returns light of chunks cids
+func lightMaps(w *World, cids []ChunkID) []lightMap {
+	var maps []lightMap
+	for _, cid := range cids {
+		maps = append(maps, *w.Chunk(cid).light)
+	}
+	return maps
+}
+
+func TestLight_EditsMatchFullLight(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	gen := &flatGenerator{}
+	var cids []ChunkID
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			cids = append(cids, ChunkID{x, 0, z}, ChunkID{x, 1, z})
+		}
+	}
+
+	w := NewWorld(store, gen)
+	w.EnableLight()
+	loadChunks(w, cids...)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 400; i++ {
+		id := BlockID{r.Intn(16) - 8, 8 + r.Intn(8), r.Intn(16) - 8}
+		tp := []BlockType{0, 0, stoneBlock, stoneBlock, lampBlock, 10}[r.Intn(6)]
+		assert.Nil(t, w.UpdateBlock(id, tp))
+	}
+
+	// a new world lights the edited chunks from scratch
+	fresh := NewWorld(store, gen)
+	fresh.EnableLight()
+	loadChunks(fresh, cids...)
+	assert.Equal(t, lightMaps(fresh, cids), lightMaps(w, cids))
+}
+
+func TestLight_RegionEditsMatchFullLight(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	gen := &flatGenerator{}
+	var cids []ChunkID
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			cids = append(cids, ChunkID{x, 0, z}, ChunkID{x, 1, z})
+		}
+	}
+
+	w := NewWorld(store, gen)
+	w.EnableLight()
+	loadChunks(w, cids...)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 40; i++ {
+		a := BlockID{r.Intn(40) - 20, 4 + r.Intn(16), r.Intn(40) - 20}
+		b := BlockID{a.X + r.Intn(12) - 6, a.Y + r.Intn(8) - 4, a.Z + r.Intn(12) - 6}
+		tp := []BlockType{stoneBlock, lampBlock, 10}[r.Intn(3)]
+		var err error
+		switch r.Intn(3) {
+		case 0:
+			_, err = w.Fill(NewRegion(a, b), tp)
+		case 1:
+			_, err = w.Hollow(NewRegion(a, b), tp)
+		default:
+			_, err = w.Clear(NewRegion(a, b))
+		}
+		assert.Nil(t, err)
+	}
+
+	fresh := NewWorld(store, gen)
+	fresh.EnableLight()
+	loadChunks(fresh, cids...)
+	assert.Equal(t, lightMaps(fresh, cids), lightMaps(w, cids))
+}
+
+func TestLight_Snapshot(t *testing.T) {
+	w, done := newLightTestWorld(t, &flatGenerator{})
+	defer done()
+	loadChunks(w, ChunkID{0, 0, 0}, ChunkID{0, 1, 0}, ChunkID{1, 0, 0})
+	assert.Nil(t, w.UpdateBlock(BlockID{32, 10, 5}, lampBlock))
+
+	s := w.snapshot(w.Chunk(ChunkID{0, 0, 0}))
+	sky, block := s.Light(ChunkWidth-1, 10, 5)
+	assert.Equal(t, uint8(maxLight), sky)
+	assert.Equal(t, uint8(maxLight-1), block)
+	_, block = s.Light(ChunkWidth, 10, 5)
+	assert.Equal(t, uint8(maxLight), block)
+	sky, _ = s.Light(5, 5, 5)
+	assert.Equal(t, uint8(0), sky)
+}
@@ -0,0 +1,18 @@
+package internal_test
+
+import (
+	"flag"
+	"log"
+	"os"
+	"testing"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+)
+
+func TestMain(m *testing.M) {
+	flag.Set("blocks", "../blocks.json")
+	if err := LoadBlocks(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// mapTileSize : pixels along each side of a map tile
+	mapTileSize = 256
+	// mapMaxZoom : zoom of tiles with one pixel a block, each zoom out halves the scale
+	mapMaxZoom = 3
+	// tiles kept in memory
+	mapTileCache = 512
+)
+
+// MapServer : serves the world seen from above as XYZ tiles for web maps,
+// tiles are drawn again when chunks under them change
+//
+//	/                  page of the map
+//	/tiles/z/x/y.png   tile y of row x at zoom z, x grows east and y south
+//	/players           json of player positions
+type MapServer struct {
+	world   *World
+	colors  *MapColors
+	players func() []Player
+
+	tiles *lru.Cache // map[mapTileKey]*mapTile
+	// drawn counts tiles drawn, each tile drawn gets the next number
+	drawn uint64
+}
+
+type mapTileKey struct {
+	z, x, y int
+}
+
+type mapTile struct {
+	img *image.RGBA
+	png []byte
+	num uint64
+
+	// region under the tile at mapMaxZoom, child tiles at lower zooms
+	region   *mapRegion
+	children [4]uint64
+}
+
+// NewMapServer returns map server of w, players returns positions of players shown on the map, it can be nil
+func NewMapServer(w *World, colors *MapColors, players func() []Player) *MapServer {
+	tiles, _ := lru.New(mapTileCache)
+	return &MapServer{
+		world:   w,
+		colors:  colors,
+		players: players,
+		tiles:   tiles,
+	}
+}
+
+func (m *MapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, mapPage, mapTileSize, mapMaxZoom)
+	case r.URL.Path == "/players":
+		m.servePlayers(w)
+	case strings.HasPrefix(r.URL.Path, "/tiles/"):
+		var k mapTileKey
+		_, err := fmt.Sscanf(r.URL.Path, "/tiles/%d/%d/%d.png", &k.z, &k.x, &k.y)
+		if err != nil || k.z < 0 || k.z > mapMaxZoom {
+			http.NotFound(w, r)
+			return
+		}
+		t := m.tile(k)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(t.png)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// mapPlayer : player marker as sent to the page
+type mapPlayer struct {
+	Name string  `json:"name"`
+	X    float32 `json:"x"`
+	Y    float32 `json:"y"`
+	Z    float32 `json:"z"`
+}
+
+func (m *MapServer) servePlayers(w http.ResponseWriter) {
+	players := []mapPlayer{}
+	if m.players != nil {
+		for _, p := range m.players() {
+			players = append(players, mapPlayer{Name: p.Name, X: p.Pos.X(), Y: p.Pos.Y(), Z: p.Pos.Z()})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(players)
+	if err != nil {
+		log.Printf("send map players error:%s", err)
+	}
+}
+
+// tile returns tile k, drawn again if what is under it has changed
+func (m *MapServer) tile(k mapTileKey) *mapTile {
+	var old *mapTile
+	if v, ok := m.tiles.Get(k); ok {
+		old = v.(*mapTile)
+	}
+
+	var t *mapTile
+	if k.z == mapMaxZoom {
+		if old != nil && !old.region.stale(m.world) {
+			return old
+		}
+		x0, z0 := k.x*mapTileSize, k.y*mapTileSize
+		region := sampleMap(m.world, x0, z0, x0+mapTileSize-1, z0+mapTileSize-1)
+		t = &mapTile{img: region.image(m.colors), region: region}
+	} else {
+		// a quarter of the tile for each child tile of the next zoom
+		var children [4]*mapTile
+		for i := range children {
+			children[i] = m.tile(mapTileKey{k.z + 1, k.x*2 + i%2, k.y*2 + i/2})
+		}
+		if old != nil && old.children == [4]uint64{children[0].num, children[1].num, children[2].num, children[3].num} {
+			return old
+		}
+		t = &mapTile{img: shrinkTiles(children)}
+		for i, c := range children {
+			t.children[i] = c.num
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, t.img)
+	if err != nil {
+		log.Printf("encode map tile %v error:%s", k, err)
+	}
+	t.png = buf.Bytes()
+	t.num = atomic.AddUint64(&m.drawn, 1)
+	m.tiles.Add(k, t)
+	return t
+}
+
+// shrinkTiles draws four tiles, in order of top left, top right, bottom left, bottom right, at half size in one tile,
+// each pixel is the average of four
+func shrinkTiles(tiles [4]*mapTile) *image.RGBA {
+	const half = mapTileSize / 2
+	img := image.NewRGBA(image.Rect(0, 0, mapTileSize, mapTileSize))
+	var wg sync.WaitGroup
+	for i, t := range tiles {
+		wg.Add(1)
+		go func(i int, src *image.RGBA) {
+			defer wg.Done()
+			ox, oy := i%2*half, i/2*half
+			for y := 0; y < half; y++ {
+				for x := 0; x < half; x++ {
+					var sum [4]int
+					for _, p := range [4]image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+						off := src.PixOffset(x*2+p.X, y*2+p.Y)
+						for c := range sum {
+							sum[c] += int(src.Pix[off+c])
+						}
+					}
+					off := img.PixOffset(ox+x, oy+y)
+					for c := range sum {
+						img.Pix[off+c] = uint8(sum[c] / 4)
+					}
+				}
+			}
+		}(i, t.img)
+	}
+	wg.Wait()
+	return img
+}
+
+// mapPage : leaflet map of the tiles, with tileSize and maxZoom to fill in.
+// Leaflet is loaded from unpkg.com, browsers showing the map need to reach it
+const mapPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gocraft map</title>
+<link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
+<style>html, body, #map { height: 100%%; margin: 0; background: #000; }</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+var tileSize = %d, maxZoom = %d;
+// tiles at maxZoom have a pixel a block
+var scale = 1 << maxZoom;
+function latLng(x, z) { return L.latLng(-z / scale, x / scale); }
+
+var map = L.map('map', {crs: L.CRS.Simple, minZoom: 0, maxZoom: maxZoom + 2});
+L.tileLayer('tiles/{z}/{x}/{y}.png', {tileSize: tileSize, maxNativeZoom: maxZoom, noWrap: true}).addTo(map);
+map.setView(latLng(0, 0), maxZoom - 1);
+
+var markers = L.layerGroup().addTo(map);
+function updatePlayers() {
+	fetch('players').then(function(r) { return r.json(); }).then(function(players) {
+		markers.clearLayers();
+		players.forEach(function(p) {
+			// names are chosen by players, they are shown as text, never as html
+			var label = document.createElement('span');
+			label.textContent = p.name + ' (' + Math.round(p.x) + ', ' + Math.round(p.y) + ', ' + Math.round(p.z) + ')';
+			L.circleMarker(latLng(p.x, p.z), {radius: 6, color: '#f00'})
+				.bindTooltip(label)
+				.addTo(markers);
+		});
+	});
+}
+updatePlayers();
+setInterval(updatePlayers, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMapServer(t *testing.T, players func() []Player) (*World, *MapServer, *httptest.Server, func()) {
+	store, done := newTestStore(t)
+	w := NewWorld(store, &flatGenerator{})
+	colors := NewMapColors(testAtlas(map[int]color.RGBA{
+		registry.Def(stoneBlock).mapTile(): red,
+		registry.Def(brickBlock).mapTile(): blue,
+	}))
+	m := NewMapServer(w, colors, players)
+	server := httptest.NewServer(m)
+	return w, m, server, func() {
+		server.Close()
+		done()
+	}
+}
+
+func getTile(t *testing.T, url string) *image.RGBA {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.(*image.RGBA)
+}
+
+func TestMapServer_Tiles(t *testing.T) {
+	w, m, server, done := newTestMapServer(t, nil)
+	defer done()
+
+	img := getTile(t, server.URL+"/tiles/3/-1/0.png")
+	assert.Equal(t, image.Rect(0, 0, mapTileSize, mapTileSize), img.Bounds())
+	assert.Equal(t, shade(red, 9, 9), img.RGBAAt(0, 0))
+	assert.Equal(t, uint64(1), m.drawn)
+
+	// a tile is drawn once while nothing under it changes
+	getTile(t, server.URL+"/tiles/3/-1/0.png")
+	assert.Equal(t, uint64(1), m.drawn)
+
+	// edits show up
+	assert.Nil(t, w.UpdateBlock(BlockID{-250, 20, 3}, brickBlock))
+	img = getTile(t, server.URL+"/tiles/3/-1/0.png")
+	assert.Equal(t, uint64(2), m.drawn)
+	assert.Equal(t, shade(blue, 20, 9), img.RGBAAt(6, 3))
+	getTile(t, server.URL+"/tiles/3/-1/0.png")
+	assert.Equal(t, uint64(2), m.drawn)
+
+	// tiles elsewhere are not touched by the edit
+	getTile(t, server.URL+"/tiles/3/0/0.png")
+	assert.Equal(t, uint64(3), m.drawn)
+}
+
+func TestMapServer_Zoom(t *testing.T) {
+	w, m, server, done := newTestMapServer(t, nil)
+	defer done()
+
+	assert.Nil(t, w.UpdateBlock(BlockID{0, 20, 0}, brickBlock))
+	assert.Nil(t, w.UpdateBlock(BlockID{1, 20, 0}, brickBlock))
+	img := getTile(t, server.URL+"/tiles/2/0/0.png")
+	// four tiles of the next zoom and this one
+	assert.Equal(t, uint64(5), m.drawn)
+	assert.Equal(t, shade(red, 9, 9), img.RGBAAt(1, 1))
+	// pixel of two brick and two stone columns
+	full := getTile(t, server.URL+"/tiles/3/0/0.png")
+	a, b, c, d := full.RGBAAt(0, 0), full.RGBAAt(1, 0), full.RGBAAt(0, 1), full.RGBAAt(1, 1)
+	assert.Equal(t, uint8((int(a.B)+int(b.B)+int(c.B)+int(d.B))/4), img.RGBAAt(0, 0).B)
+	assert.Equal(t, uint64(5), m.drawn)
+
+	// the change of a tile goes up to the tiles over it
+	assert.Nil(t, w.UpdateBlock(BlockID{300, 20, 0}, brickBlock))
+	getTile(t, server.URL+"/tiles/2/0/0.png")
+	assert.Equal(t, uint64(7), m.drawn)
+}
+
+func TestMapServer_Players(t *testing.T) {
+	_, _, server, done := newTestMapServer(t, func() []Player {
+		return []Player{{ID: 1, Name: "bob", Pos: mgl32.Vec3{1, 30, -2}}}
+	})
+	defer done()
+
+	resp, err := http.Get(server.URL + "/players")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var players []mapPlayer
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&players))
+	assert.Equal(t, []mapPlayer{{Name: "bob", X: 1, Y: 30, Z: -2}}, players)
+}
+
+func TestMapServer_PlayerNames(t *testing.T) {
+	name := `<img src=x onerror="alert(1)">`
+	_, _, server, done := newTestMapServer(t, func() []Player {
+		return []Player{{ID: 1, Name: name}}
+	})
+	defer done()
+
+	resp, err := http.Get(server.URL + "/players")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(body), "<img")
+	var players []mapPlayer
+	assert.Nil(t, json.Unmarshal(body, &players))
+	assert.Equal(t, []mapPlayer{{Name: name}}, players)
+
+	// the page shows names as text
+	resp, err = http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.Contains(t, string(page), "label.textContent = p.name")
+	assert.NotContains(t, string(page), "bindTooltip(p.name")
+}
+
+func TestMapServer_Paths(t *testing.T) {
+	_, _, server, done := newTestMapServer(t, nil)
+	defer done()
+
+	for path, status := range map[string]int{
+		"/":                    http.StatusOK,
+		"/players":             http.StatusOK,
+		"/tiles/4/0/0.png":     http.StatusNotFound,
+		"/tiles/-1/0/0.png":    http.StatusNotFound,
+		"/tiles/1/0.png":       http.StatusNotFound,
+		"/tiles/a/b/c.png":     http.StatusNotFound,
+		"/somewhere/else.html": http.StatusNotFound,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+}
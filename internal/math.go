@@ -7,9 +7,16 @@ import (
 	opensimplex "github.com/ojrac/opensimplex-go"
 )
 
-var (
-	sim = opensimplex.NewWithSeed(0)
-)
+// Noise : fractal simplex noise of a seed
+type Noise struct {
+	sim *opensimplex.Noise
+}
+
+func NewNoise(seed int64) *Noise {
+	return &Noise{
+		sim: opensimplex.NewWithSeed(seed),
+	}
+}
 
 func abs(x float32) float32 {
 	return float32(math.Abs(float64(x)))
@@ -31,34 +38,72 @@ func radian(angle float32) float32 {
 	return mgl32.DegToRad(angle)
 }
 
-func noise2(x, y float32, octaves int, persistence, lacunarity float32) float32 {
+// floorDiv divides a by b > 0 rounding down, so negative a goes down too
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+func (n *Noise) noise2(x, y float32, octaves int, persistence, lacunarity float32) float32 {
 	var (
 		freq  float32 = 1
 		amp   float32 = 1
 		max   float32 = 1
-		total         = sim.Eval2(float64(x), float64(y))
+		total         = n.sim.Eval2(float64(x), float64(y))
 	)
 	for i := 0; i < octaves; i++ {
 		freq *= lacunarity
 		amp *= persistence
 		max += amp
-		total += sim.Eval2(float64(x*freq), float64(y*freq)) * float64(amp)
+		total += n.sim.Eval2(float64(x*freq), float64(y*freq)) * float64(amp)
 	}
 	return (1 + float32(total)/max) / 2
 }
 
-func noise3(x, y, z float32, octaves int, persistence, lacunarity float32) float32 {
+func (n *Noise) noise3(x, y, z float32, octaves int, persistence, lacunarity float32) float32 {
 	var (
 		freq  float32 = 1
 		amp   float32 = 1
 		max   float32 = 1
-		total         = sim.Eval3(float64(x), float64(y), float64(z))
+		total         = n.sim.Eval3(float64(x), float64(y), float64(z))
 	)
 	for i := 0; i < octaves; i++ {
 		freq *= lacunarity
 		amp *= persistence
 		max += amp
-		total += sim.Eval3(float64(x*freq), float64(y*freq), float64(z*freq)) * float64(amp)
+		total += n.sim.Eval3(float64(x*freq), float64(y*freq), float64(z*freq)) * float64(amp)
 	}
 	return (1 + float32(total)/max) / 2
 }
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// hash3 : deterministic random bits of a seed and a position
+func hash3(seed int64, x, y, z int) uint64 {
+	h := splitmix64(uint64(seed))
+	h = splitmix64(h ^ uint64(x))
+	h = splitmix64(h ^ uint64(y))
+	return splitmix64(h ^ uint64(z))
+}
+
+// hashFloat : deterministic random number in [0, 1) of a seed and a position
+func hashFloat(seed int64, x, y, z int) float32 {
+	return float32(hash3(seed, x, y, z)>>40) / (1 << 24)
+}
+
+func clamp(x, min, max float32) float32 {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
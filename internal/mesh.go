@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/cLazyZombie/gocraft/internal/mesher"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var (
+	greedyMeshing = flag.Bool("greedy", false, "merge faces of chunk meshes into larger quads")
+)
+
+// snapshot copies blocks and light of chunk c and of loaded neighbour chunks around it, for meshing without locks
+func (w *World) snapshot(c *Chunk) *mesher.Snapshot {
+	w.lightMutex.Lock()
+	defer w.lightMutex.Unlock()
+
+	cid := c.ID()
+	s := mesher.NewSnapshot(cid.X*ChunkWidth, cid.Y*ChunkWidth, cid.Z*ChunkWidth)
+	for dz := -1; dz <= 1; dz++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				chunk := c
+				if dx != 0 || dy != 0 || dz != 0 {
+					var ok bool
+					chunk, ok = w.loadChunk(ChunkID{cid.X + dx, cid.Y + dy, cid.Z + dz})
+					if !ok {
+						continue
+					}
+				}
+				chunk.snapshot(s, dx, dy, dz)
+			}
+		}
+	}
+	return s
+}
+
+// snapshotSpan returns range of snapshot positions inside the neighbour chunk at offset d
+func snapshotSpan(d int) (int, int) {
+	switch d {
+	case -1:
+		return -1, -1
+	case 1:
+		return ChunkWidth, ChunkWidth
+	}
+	return 0, ChunkWidth - 1
+}
+
+// snapshot copies blocks and light of c into s, c is at offset dx, dy, dz from the chunk of s
+func (c *Chunk) snapshot(s *mesher.Snapshot, dx, dy, dz int) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if len(c.blocks) == 0 && c.light == nil {
+		return
+	}
+	x0, x1 := snapshotSpan(dx)
+	y0, y1 := snapshotSpan(dy)
+	z0, z1 := snapshotSpan(dz)
+	for z := z0; z <= z1; z++ {
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				i := (x - dx*ChunkWidth) + (y-dy*ChunkWidth)*ChunkWidth + (z-dz*ChunkWidth)*ChunkWidth*ChunkWidth
+				if len(c.blocks) != 0 && c.blocks[i] != 0 {
+					s.Set(x, y, z, registry.Def(c.blocks[i]).mesh)
+				}
+				if c.light != nil {
+					s.SetLight(x, y, z, c.light.get(i, skyLight), c.light.get(i, blockLight))
+				}
+			}
+		}
+	}
+}
+
+// meshSnapshot appends vertices of chunk snapshot s to buckets
+func meshSnapshot(buckets *mesher.Buckets, s *mesher.Snapshot) {
+	if *greedyMeshing {
+		s.Greedy(buckets)
+		return
+	}
+	s.Mesh(buckets)
+}
+
+// chunkOrigin returns world position of the first block of chunk id
+func chunkOrigin(id ChunkID) mgl32.Vec3 {
+	return mgl32.Vec3{float32(id.X * ChunkWidth), float32(id.Y * ChunkWidth), float32(id.Z * ChunkWidth)}
+}
+
+// chunkCenter returns center of chunk id, blocks are centered on their ids
+func chunkCenter(id ChunkID) mgl32.Vec3 {
+	const half = (ChunkWidth - 1) / 2.0
+	return chunkOrigin(id).Add(mgl32.Vec3{half, half, half})
+}
+
+// sortBackToFront sorts chunks ids from the farthest to the nearest to eye, the order translucent faces are blended in
+func sortBackToFront(ids []ChunkID, eye mgl32.Vec3) {
+	sort.Slice(ids, func(i, j int) bool {
+		return chunkCenter(ids[i]).Sub(eye).Len() > chunkCenter(ids[j]).Sub(eye).Len()
+	})
+}
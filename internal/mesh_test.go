@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/cLazyZombie/gocraft/internal/mesher"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMeshTestWorld returns world of biome terrain with chunks around cids loaded
+func newMeshTestWorld(t testing.TB, cids []ChunkID) (*World, func()) {
+	store, done := newTestStore(t)
+	gen, err := NewGenerator(biomeGeneratorName, 1)
+	assert.Nil(t, err)
+	world := NewWorld(store, gen)
+	for _, cid := range cids {
+		for dz := -1; dz <= 1; dz++ {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					world.Chunk(ChunkID{cid.X + dx, cid.Y + dy, cid.Z + dz})
+				}
+			}
+		}
+	}
+	return world, done
+}
+
+func TestMesh_Snapshot(t *testing.T) {
+	cid := ChunkID{-1, 0, 2}
+	world, done := newMeshTestWorld(t, []ChunkID{cid})
+	defer done()
+	world.UpdateBlock(BlockID{-1, 20, 95}, stoneBlock)
+
+	s := world.snapshot(world.Chunk(cid))
+	for z := -1; z <= ChunkWidth; z++ {
+		for y := -1; y <= ChunkWidth; y++ {
+			for x := -1; x <= ChunkWidth; x++ {
+				w := world.Block(BlockID{cid.X*ChunkWidth + x, y, cid.Z*ChunkWidth + z})
+				expect := registry.Def(w).mesh
+				if w == 0 {
+					expect = mesher.Air
+				}
+				if s.At(x, y, z) != expect {
+					t.Fatalf("block %d %d %d is %v, want %v", x, y, z, s.At(x, y, z), expect)
+				}
+			}
+		}
+	}
+	assert.Equal(t, registry.Def(stoneBlock).mesh, s.At(ChunkWidth-1, 20, ChunkWidth-1))
+}
+
+func TestMesh_GreedyGenerated(t *testing.T) {
+	cids := []ChunkID{{0, 0, 0}, {-1, 0, 2}, {3, 1, -2}}
+	world, done := newMeshTestWorld(t, cids)
+	defer done()
+	for _, cid := range cids {
+		s := world.snapshot(world.Chunk(cid))
+		var plain, greedy mesher.Buckets
+		s.Mesh(&plain)
+		s.Greedy(&greedy)
+		assert.True(t, greedy.Faces() <= plain.Faces(), "chunk %v", cid)
+	}
+}
+
+func TestMesh_Buckets(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	world := NewWorld(store, &flatGenerator{})
+	water, glass := lookupBlock(t, "water"), lookupBlock(t, "glass")
+	assert.Equal(t, mesher.Translucent, registry.Def(water).mesh.Pass)
+
+	// blocks of blocks.json in the air, two water blocks side by side
+	assert.Nil(t, world.UpdateBlock(BlockID{3, 20, 1}, glass))
+	assert.Nil(t, world.UpdateBlock(BlockID{5, 20, 1}, water))
+	assert.Nil(t, world.UpdateBlock(BlockID{6, 20, 1}, water))
+	var b mesher.Buckets
+	world.snapshot(world.Chunk(ChunkID{})).Mesh(&b)
+	assert.Equal(t, 6*6*mesher.VertexSize, len(b[mesher.Cutout]))
+	// the face between the water blocks is culled
+	assert.Equal(t, 10*6*mesher.VertexSize, len(b[mesher.Translucent]))
+}
+
+func TestMesh_SortBackToFront(t *testing.T) {
+	ids := []ChunkID{{0, 0, 0}, {2, 0, 0}, {-1, 0, 0}, {0, 0, 3}, {1, 0, 0}}
+	sortBackToFront(ids, mgl32.Vec3{10, 5, 10})
+	assert.Equal(t, []ChunkID{{0, 0, 3}, {2, 0, 0}, {1, 0, 0}, {-1, 0, 0}, {0, 0, 0}}, ids)
+}
+
+func BenchmarkMesh_Faces(b *testing.B) {
+	var cids []ChunkID
+	for p := -2; p < 2; p++ {
+		for q := -2; q < 2; q++ {
+			cids = append(cids, ChunkID{p, 0, q})
+		}
+	}
+	world, done := newMeshTestWorld(b, cids)
+	defer done()
+	var snapshots []*mesher.Snapshot
+	for _, cid := range cids {
+		snapshots = append(snapshots, world.snapshot(world.Chunk(cid)))
+	}
+
+	var buckets mesher.Buckets
+	b.Run("plain", func(b *testing.B) {
+		var n float64
+		for i := 0; i < b.N; i++ {
+			for _, s := range snapshots {
+				buckets.Reset()
+				s.Mesh(&buckets)
+				n += float64(buckets.Faces())
+			}
+		}
+		b.ReportMetric(n/float64(b.N*len(snapshots)), "faces/chunk")
+	})
+	b.Run("greedy", func(b *testing.B) {
+		var n float64
+		for i := 0; i < b.N; i++ {
+			for _, s := range snapshots {
+				buckets.Reset()
+				s.Greedy(&buckets)
+				n += float64(buckets.Faces())
+			}
+		}
+		b.ReportMetric(n/float64(b.N*len(snapshots)), "faces/chunk")
+	})
+}
@@ -0,0 +1,105 @@
+package mesher
+
+// corners : offsets of the corners of each face along axes (a+1)%3 and (a+2)%3, a is the axis of the normal,
+// in order of the first, second, third and fifth vertex made by AppendCube
+var corners = [6][4][2]int{
+	Left:  {{-1, -1}, {-1, 1}, {1, 1}, {1, -1}},
+	Right: {{-1, 1}, {-1, -1}, {1, -1}, {1, 1}},
+	Up:    {{1, -1}, {1, 1}, {-1, 1}, {-1, -1}},
+	Down:  {{1, 1}, {1, -1}, {-1, -1}, {-1, 1}},
+	Front: {{-1, -1}, {1, -1}, {1, 1}, {-1, 1}},
+	Back:  {{1, -1}, {-1, -1}, {-1, 1}, {1, 1}},
+}
+
+// AO returns ambient occlusion of the corners of face of the block at chunk position x, y, z,
+// in order of the vertices of the face, from 0 for an open corner to 3 for a corner between two blocks
+func (s *Snapshot) AO(x, y, z, face int) [4]int {
+	dir := dirs[face]
+	a := face / 2
+	u, v := (a+1)%3, (a+2)%3
+	// corners are shaded by blocks in front of the face
+	p := [3]int{x + dir[0], y + dir[1], z + dir[2]}
+	var ao [4]int
+	for i, c := range corners[face] {
+		side1, side2 := p, p
+		side1[u] += c[0]
+		side2[v] += c[1]
+		corner := side1
+		corner[v] += c[1]
+		ao[i] = occlusion(s.opaque(side1), s.opaque(side2), s.opaque(corner))
+	}
+	return ao
+}
+
+// FaceLight returns sky and block light, from 0 to 1, of the corners of face of the block at chunk position x, y, z,
+// each corner has the average light of the transparent blocks touching it in front of the face
+func (s *Snapshot) FaceLight(x, y, z, face int) [4][2]float32 {
+	dir := dirs[face]
+	a := face / 2
+	u, v := (a+1)%3, (a+2)%3
+	p := [3]int{x + dir[0], y + dir[1], z + dir[2]}
+	var light [4][2]float32
+	for i, c := range corners[face] {
+		side1, side2 := p, p
+		side1[u] += c[0]
+		side2[v] += c[1]
+		corner := side1
+		corner[v] += c[1]
+		cells := [][3]int{p, side1, side2}
+		// light does not get through the corner between two blocks
+		if !s.opaque(side1) || !s.opaque(side2) {
+			cells = append(cells, corner)
+		}
+		var sky, block, n int
+		for _, cell := range cells {
+			if s.opaque(cell) {
+				continue
+			}
+			ls, lb := s.Light(cell[0], cell[1], cell[2])
+			sky += int(ls)
+			block += int(lb)
+			n++
+		}
+		if n > 0 {
+			light[i] = [2]float32{float32(sky) / float32(n*MaxLight), float32(block) / float32(n*MaxLight)}
+		}
+	}
+	return light
+}
+
+func (s *Snapshot) opaque(p [3]int) bool {
+	return !s.At(p[0], p[1], p[2]).Transparent
+}
+
+// occlusion of a corner from the two blocks along its edges and the block on its diagonal
+func occlusion(side1, side2, corner bool) int {
+	if side1 && side2 {
+		return 3
+	}
+	n := 0
+	for _, b := range []bool{side1, side2, corner} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// shadeFace sets occlusion and light of the six vertices of a face made by AppendCube,
+// the diagonal of the quad is flipped to run between the lighter corners, so shading is symmetric
+func shadeFace(face []float32, ao [4]int, light [4][2]float32) {
+	var quad [4][VertexSize]float32
+	for i, v := range [4]int{0, 1, 2, 4} {
+		copy(quad[i][:], face[v*VertexSize:])
+		quad[i][aoOffset] = float32(ao[i]) / 3
+		quad[i][skyOffset] = light[i][0]
+		quad[i][blockOffset] = light[i][1]
+	}
+	order := [6]int{0, 1, 2, 2, 3, 0}
+	if ao[0]+ao[2] > ao[1]+ao[3] {
+		order = [6]int{1, 2, 3, 3, 0, 1}
+	}
+	for i, c := range order {
+		copy(face[i*VertexSize:], quad[c][:])
+	}
+}
@@ -0,0 +1,127 @@
+package mesher
+
+// AppendCube appends faces of a cube block at x, y, z with textures faces, no occlusion and full sky light,
+// show: left, right, up, down, front, back, bottom faces at y 0 are never shown
+func AppendCube(vertices []float32, show [6]bool, x, y, z int, faces *[6]Face) []float32 {
+	l, r := faces[Left], faces[Right]
+	u, d := faces[Up], faces[Down]
+	f, b := faces[Front], faces[Back]
+	fx, fy, fz := float32(x), float32(y), float32(z)
+	if show[Left] {
+		vertices = append(vertices, []float32{
+			// left
+			fx - 0.5, fy - 0.5, fz - 0.5, l[0][0], l[0][1], -1, 0, 0, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz + 0.5, l[1][0], l[1][1], -1, 0, 0, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz + 0.5, l[2][0], l[2][1], -1, 0, 0, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz + 0.5, l[3][0], l[3][1], -1, 0, 0, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz - 0.5, l[4][0], l[4][1], -1, 0, 0, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz - 0.5, l[5][0], l[5][1], -1, 0, 0, 0, 1, 0,
+		}...)
+	}
+	if show[Right] {
+		vertices = append(vertices, []float32{
+			// right
+			fx + 0.5, fy - 0.5, fz + 0.5, r[0][0], r[0][1], 1, 0, 0, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz - 0.5, r[1][0], r[1][1], 1, 0, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz - 0.5, r[2][0], r[2][1], 1, 0, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz - 0.5, r[3][0], r[3][1], 1, 0, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz + 0.5, r[4][0], r[4][1], 1, 0, 0, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz + 0.5, r[5][0], r[5][1], 1, 0, 0, 0, 1, 0,
+		}...)
+	}
+	if show[Up] {
+		vertices = append(vertices, []float32{
+			// top
+			fx - 0.5, fy + 0.5, fz + 0.5, u[0][0], u[0][1], 0, 1, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz + 0.5, u[1][0], u[1][1], 0, 1, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz - 0.5, u[2][0], u[2][1], 0, 1, 0, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz - 0.5, u[3][0], u[3][1], 0, 1, 0, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz - 0.5, u[4][0], u[4][1], 0, 1, 0, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz + 0.5, u[5][0], u[5][1], 0, 1, 0, 0, 1, 0,
+		}...)
+	}
+
+	if show[Down] && y != 0 {
+		vertices = append(vertices, []float32{
+			// bottom
+			fx + 0.5, fy - 0.5, fz + 0.5, d[0][0], d[0][1], 0, -1, 0, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz + 0.5, d[1][0], d[1][1], 0, -1, 0, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz - 0.5, d[2][0], d[2][1], 0, -1, 0, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz - 0.5, d[3][0], d[3][1], 0, -1, 0, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz - 0.5, d[4][0], d[4][1], 0, -1, 0, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz + 0.5, d[5][0], d[5][1], 0, -1, 0, 0, 1, 0,
+		}...)
+	}
+
+	if show[Front] {
+		vertices = append(vertices, []float32{
+			// front
+			fx - 0.5, fy - 0.5, fz + 0.5, f[0][0], f[0][1], 0, 0, 1, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz + 0.5, f[1][0], f[1][1], 0, 0, 1, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz + 0.5, f[2][0], f[2][1], 0, 0, 1, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz + 0.5, f[3][0], f[3][1], 0, 0, 1, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz + 0.5, f[4][0], f[4][1], 0, 0, 1, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz + 0.5, f[5][0], f[5][1], 0, 0, 1, 0, 1, 0,
+		}...)
+	}
+
+	if show[Back] {
+		vertices = append(vertices, []float32{
+			// back
+			fx + 0.5, fy - 0.5, fz - 0.5, b[0][0], b[0][1], 0, 0, -1, 0, 1, 0,
+			fx - 0.5, fy - 0.5, fz - 0.5, b[1][0], b[1][1], 0, 0, -1, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz - 0.5, b[2][0], b[2][1], 0, 0, -1, 0, 1, 0,
+			fx - 0.5, fy + 0.5, fz - 0.5, b[3][0], b[3][1], 0, 0, -1, 0, 1, 0,
+			fx + 0.5, fy + 0.5, fz - 0.5, b[4][0], b[4][1], 0, 0, -1, 0, 1, 0,
+			fx + 0.5, fy - 0.5, fz - 0.5, b[5][0], b[5][1], 0, 0, -1, 0, 1, 0,
+		}...)
+	}
+
+	return vertices
+}
+
+// AppendPlant appends two crossed quads of a plant block at x, y, z with textures faces
+func AppendPlant(vertices []float32, x, y, z int, faces *[6]Face) []float32 {
+	l, r := faces[Left], faces[Right]
+	f, b := faces[Front], faces[Back]
+	fx, fy, fz := float32(x), float32(y), float32(z)
+	vertices = append(vertices, []float32{
+		// left
+		fx, fy - 0.5, fz - 0.5, l[0][0], l[0][1], -1, 0, 0, 0, 1, 0,
+		fx, fy - 0.5, fz + 0.5, l[1][0], l[1][1], -1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz + 0.5, l[2][0], l[2][1], -1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz + 0.5, l[3][0], l[3][1], -1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz - 0.5, l[4][0], l[4][1], -1, 0, 0, 0, 1, 0,
+		fx, fy - 0.5, fz - 0.5, l[5][0], l[5][1], -1, 0, 0, 0, 1, 0,
+	}...)
+	vertices = append(vertices, []float32{
+		// right
+		fx, fy - 0.5, fz + 0.5, r[0][0], r[0][1], 1, 0, 0, 0, 1, 0,
+		fx, fy - 0.5, fz - 0.5, r[1][0], r[1][1], 1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz - 0.5, r[2][0], r[2][1], 1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz - 0.5, r[3][0], r[3][1], 1, 0, 0, 0, 1, 0,
+		fx, fy + 0.5, fz + 0.5, r[4][0], r[4][1], 1, 0, 0, 0, 1, 0,
+		fx, fy - 0.5, fz + 0.5, r[5][0], r[5][1], 1, 0, 0, 0, 1, 0,
+	}...)
+
+	vertices = append(vertices, []float32{
+		// front
+		fx - 0.5, fy - 0.5, fz, f[0][0], f[0][1], 0, 0, 1, 0, 1, 0,
+		fx + 0.5, fy - 0.5, fz, f[1][0], f[1][1], 0, 0, 1, 0, 1, 0,
+		fx + 0.5, fy + 0.5, fz, f[2][0], f[2][1], 0, 0, 1, 0, 1, 0,
+		fx + 0.5, fy + 0.5, fz, f[3][0], f[3][1], 0, 0, 1, 0, 1, 0,
+		fx - 0.5, fy + 0.5, fz, f[4][0], f[4][1], 0, 0, 1, 0, 1, 0,
+		fx - 0.5, fy - 0.5, fz, f[5][0], f[5][1], 0, 0, 1, 0, 1, 0,
+	}...)
+
+	vertices = append(vertices, []float32{
+		// back
+		fx + 0.5, fy - 0.5, fz, b[0][0], b[0][1], 0, 0, -1, 0, 1, 0,
+		fx - 0.5, fy - 0.5, fz, b[1][0], b[1][1], 0, 0, -1, 0, 1, 0,
+		fx - 0.5, fy + 0.5, fz, b[2][0], b[2][1], 0, 0, -1, 0, 1, 0,
+		fx - 0.5, fy + 0.5, fz, b[3][0], b[3][1], 0, 0, -1, 0, 1, 0,
+		fx + 0.5, fy + 0.5, fz, b[4][0], b[4][1], 0, 0, -1, 0, 1, 0,
+		fx + 0.5, fy - 0.5, fz, b[5][0], b[5][1], 0, 0, -1, 0, 1, 0,
+	}...)
+	return vertices
+}
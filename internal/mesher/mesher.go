@@ -0,0 +1,295 @@
+// Package mesher builds vertex data of chunks, it knows nothing of worlds, stores or GL,
+// so chunks can be meshed on any goroutine and tested without a display
+package mesher
+
+const (
+	// Width : blocks along each side of a chunk
+	Width = 32
+	// Size : blocks along each side of a snapshot, the chunk and one layer of neighbours
+	Size = Width + 2
+
+	// VertexSize : floats of a vertex, pos, tex, normal, ambient occlusion, sky and block light
+	VertexSize = 11
+
+	aoOffset    = 8
+	skyOffset   = 9
+	blockOffset = 10
+
+	// MaxLight : light of a block in full sun or next to a lamp
+	MaxLight = 15
+)
+
+// faces of a block, in order of show
+const (
+	Left = iota
+	Right
+	Up
+	Down
+	Front
+	Back
+)
+
+// dirs : offsets to the neighbour on each face
+var dirs = [6][3]int{{-1, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+
+// Shape : how a block is meshed
+type Shape int
+
+const (
+	ShapeNone Shape = iota
+	ShapeCube
+	ShapePlant
+)
+
+// Pass : render pass of a block
+type Pass int
+
+const (
+	// Opaque blocks hide what is behind them
+	Opaque Pass = iota
+	// Cutout blocks have holes where texels are magenta
+	Cutout
+	// Translucent blocks are blended with what is behind them, and drawn back to front
+	Translucent
+
+	Passes
+)
+
+// Face : texture coordinates of the six vertices of a face
+type Face [6][2]float32
+
+// Block : what the mesher needs to know about a block type
+type Block struct {
+	Shape       Shape
+	Transparent bool
+	Pass        Pass
+	// Faces : textures of left, right, up, down, front, back
+	Faces [6]Face
+}
+
+// Buckets : vertices of a chunk by render pass
+type Buckets [Passes][]float32
+
+// Faces returns number of faces in all passes
+func (b *Buckets) Faces() int {
+	n := 0
+	for _, vertices := range b {
+		n += len(vertices) / VertexSize / 6
+	}
+	return n
+}
+
+// Reset empties buckets and keeps their memory
+func (b *Buckets) Reset() {
+	for i := range b {
+		b[i] = b[i][:0]
+	}
+}
+
+// Air : block of empty cells of a snapshot
+var Air = &Block{Shape: ShapeNone, Transparent: true}
+
+// Snapshot : blocks of a chunk and of the layer around it, copied so meshing needs no locks
+type Snapshot struct {
+	// X, Y, Z : world position of the first block of the chunk
+	X, Y, Z int
+
+	blocks [Size * Size * Size]*Block
+	// sky light in the high and block light in the low 4 bits
+	light [Size * Size * Size]uint8
+}
+
+// NewSnapshot returns an empty snapshot of the chunk starting at world position x, y, z, in full sky light
+func NewSnapshot(x, y, z int) *Snapshot {
+	s := &Snapshot{X: x, Y: y, Z: z}
+	for i := range s.light {
+		s.light[i] = MaxLight << 4
+	}
+	return s
+}
+
+func index(x, y, z int) int {
+	return (x + 1) + (y+1)*Size + (z+1)*Size*Size
+}
+
+// Set sets block at chunk position x, y, z, from -1 to Width
+func (s *Snapshot) Set(x, y, z int, b *Block) {
+	s.blocks[index(x, y, z)] = b
+}
+
+// At returns block at chunk position x, y, z, from -1 to Width
+func (s *Snapshot) At(x, y, z int) *Block {
+	b := s.blocks[index(x, y, z)]
+	if b == nil {
+		return Air
+	}
+	return b
+}
+
+// SetLight sets sky and block light, from 0 to MaxLight, at chunk position x, y, z
+func (s *Snapshot) SetLight(x, y, z int, sky, block uint8) {
+	s.light[index(x, y, z)] = sky<<4 | block
+}
+
+// Light returns sky and block light at chunk position x, y, z
+func (s *Snapshot) Light(x, y, z int) (uint8, uint8) {
+	l := s.light[index(x, y, z)]
+	return l >> 4, l & 0xf
+}
+
+// visible returns whether a face of cube b next to block n is seen,
+// faces between two blocks of the same transparent type are not
+func visible(b, n *Block) bool {
+	return n.Transparent && n != b
+}
+
+func (s *Snapshot) show(b *Block, x, y, z int) [6]bool {
+	var show [6]bool
+	for d, dir := range dirs {
+		show[d] = visible(b, s.At(x+dir[0], y+dir[1], z+dir[2]))
+	}
+	return show
+}
+
+// Mesh appends faces of each block of the chunk to buckets of their pass
+func (s *Snapshot) Mesh(buckets *Buckets) {
+	for z := 0; z < Width; z++ {
+		for y := 0; y < Width; y++ {
+			for x := 0; x < Width; x++ {
+				b := s.At(x, y, z)
+				switch b.Shape {
+				case ShapePlant:
+					buckets[b.Pass] = s.appendPlant(buckets[b.Pass], b, x, y, z)
+				case ShapeCube:
+					for d, show := range s.show(b, x, y, z) {
+						if show {
+							buckets[b.Pass] = s.appendFace(buckets[b.Pass], b, x, y, z, d)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Greedy appends faces of the chunk like Mesh,
+// but faces next to each other on the same plane with the same texture become one quad
+func (s *Snapshot) Greedy(buckets *Buckets) {
+	// plants are not merged
+	for z := 0; z < Width; z++ {
+		for y := 0; y < Width; y++ {
+			for x := 0; x < Width; x++ {
+				if b := s.At(x, y, z); b.Shape == ShapePlant {
+					buckets[b.Pass] = s.appendPlant(buckets[b.Pass], b, x, y, z)
+				}
+			}
+		}
+	}
+
+	var mask [Width * Width]*Block
+	var aos [Width * Width][4]int
+	var lights [Width * Width][4][2]float32
+	for d, dir := range dirs {
+		// a is the axis of the normal, faces are merged along u and v
+		a := d / 2
+		u, v := (a+1)%3, (a+2)%3
+		for k := 0; k < Width; k++ {
+			for j := 0; j < Width; j++ {
+				for i := 0; i < Width; i++ {
+					var p [3]int
+					p[a], p[u], p[v] = k, i, j
+					b := s.At(p[0], p[1], p[2])
+					next := s.At(p[0]+dir[0], p[1]+dir[1], p[2]+dir[2])
+					// the bottom of the world is never seen
+					bottom := d == Down && s.Y+p[1] == 0
+					if b.Shape == ShapeCube && visible(b, next) && !bottom {
+						mask[i+j*Width] = b
+						aos[i+j*Width] = s.AO(p[0], p[1], p[2], d)
+						lights[i+j*Width] = s.FaceLight(p[0], p[1], p[2], d)
+					} else {
+						mask[i+j*Width] = nil
+					}
+				}
+			}
+
+			for j := 0; j < Width; j++ {
+				for i := 0; i < Width; {
+					b, ao, light := mask[i+j*Width], aos[i+j*Width], lights[i+j*Width]
+					if b == nil {
+						i++
+						continue
+					}
+					// faces of a quad share texture, pass, occlusion and light
+					same := func(i, j int) bool {
+						o := mask[i+j*Width]
+						return (o == b || (o != nil && o.Faces[d] == b.Faces[d] && o.Pass == b.Pass)) &&
+							aos[i+j*Width] == ao && lights[i+j*Width] == light
+					}
+
+					width := 1
+					for i+width < Width && same(i+width, j) {
+						width++
+					}
+					height := 1
+				grow:
+					for j+height < Width {
+						for n := 0; n < width; n++ {
+							if !same(i+n, j+height) {
+								break grow
+							}
+						}
+						height++
+					}
+					for m := 0; m < height; m++ {
+						for n := 0; n < width; n++ {
+							mask[i+n+(j+m)*Width] = nil
+						}
+					}
+
+					var p [3]int
+					p[a], p[u], p[v] = k, i, j
+					start := len(buckets[b.Pass])
+					buckets[b.Pass] = s.appendFace(buckets[b.Pass], b, p[0], p[1], p[2], d)
+					stretch(buckets[b.Pass][start:], [3]int{s.X + p[0], s.Y + p[1], s.Z + p[2]}, u, width, v, height)
+					i += width
+				}
+			}
+		}
+	}
+}
+
+// appendFace appends face d of cube b at chunk position x, y, z with ambient occlusion
+func (s *Snapshot) appendFace(vertices []float32, b *Block, x, y, z, d int) []float32 {
+	start := len(vertices)
+	var show [6]bool
+	show[d] = true
+	vertices = AppendCube(vertices, show, s.X+x, s.Y+y, s.Z+z, &b.Faces)
+	if len(vertices) > start {
+		shadeFace(vertices[start:], s.AO(x, y, z, d), s.FaceLight(x, y, z, d))
+	}
+	return vertices
+}
+
+// appendPlant appends plant b at chunk position x, y, z in the light of its block
+func (s *Snapshot) appendPlant(vertices []float32, b *Block, x, y, z int) []float32 {
+	start := len(vertices)
+	vertices = AppendPlant(vertices, s.X+x, s.Y+y, s.Z+z, &b.Faces)
+	sky, block := s.Light(x, y, z)
+	for i := start; i < len(vertices); i += VertexSize {
+		vertices[i+skyOffset] = float32(sky) / MaxLight
+		vertices[i+blockOffset] = float32(block) / MaxLight
+	}
+	return vertices
+}
+
+// stretch makes the face of the block at pos width blocks long along axis u and height blocks along axis v
+func stretch(face []float32, pos [3]int, u, width, v, height int) {
+	for i := 0; i < len(face); i += VertexSize {
+		if face[i+u] > float32(pos[u]) {
+			face[i+u] += float32(width - 1)
+		}
+		if face[i+v] > float32(pos[v]) {
+			face[i+v] += float32(height - 1)
+		}
+	}
+}
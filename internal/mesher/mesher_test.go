@@ -0,0 +1,310 @@
+package mesher
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testFaces(tile float32) [6]Face {
+	var faces [6]Face
+	for i := range faces {
+		for j := range faces[i] {
+			faces[i][j] = [2]float32{tile, float32(i)}
+		}
+	}
+	return faces
+}
+
+var (
+	stone = &Block{Shape: ShapeCube, Faces: testFaces(1)}
+	// same texture as stone, but another block
+	smooth = &Block{Shape: ShapeCube, Faces: testFaces(1)}
+	brick  = &Block{Shape: ShapeCube, Faces: testFaces(2)}
+	glass  = &Block{Shape: ShapeCube, Transparent: true, Pass: Cutout, Faces: testFaces(3)}
+	grass  = &Block{Shape: ShapePlant, Transparent: true, Pass: Cutout, Faces: testFaces(4)}
+	water  = &Block{Shape: ShapeCube, Transparent: true, Pass: Translucent, Faces: testFaces(5)}
+)
+
+// mesh returns vertices of all passes of s
+func mesh(s *Snapshot) []float32 {
+	var b Buckets
+	s.Mesh(&b)
+	return append(append(b[Opaque], b[Cutout]...), b[Translucent]...)
+}
+
+func greedy(s *Snapshot) []float32 {
+	var b Buckets
+	s.Greedy(&b)
+	return append(append(b[Opaque], b[Cutout]...), b[Translucent]...)
+}
+
+// faceArea sums area of faces by normal
+func faceArea(vertices []float32) map[[3]float32]float32 {
+	area := make(map[[3]float32]float32)
+	for i := 0; i < len(vertices); i += 3 * VertexSize {
+		var a, b [3]float32
+		for k := 0; k < 3; k++ {
+			a[k] = vertices[i+VertexSize+k] - vertices[i+k]
+			b[k] = vertices[i+2*VertexSize+k] - vertices[i+k]
+		}
+		cross := [3]float32{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+		n := [3]float32{vertices[i+5], vertices[i+6], vertices[i+7]}
+		// a triangle is half of the parallelogram
+		area[n] += (cross[0]*n[0] + cross[1]*n[1] + cross[2]*n[2]) / 2
+	}
+	return area
+}
+
+func TestSnapshot_At(t *testing.T) {
+	s := NewSnapshot(32, 0, -64)
+	assert.Equal(t, Air, s.At(-1, 5, Width))
+	s.Set(-1, 5, Width, stone)
+	assert.Equal(t, stone, s.At(-1, 5, Width))
+	assert.Equal(t, Air, s.At(0, 5, Width))
+}
+
+func TestSnapshot_Mesh(t *testing.T) {
+	s := NewSnapshot(32, 32, -64)
+	s.Set(0, 0, 0, stone)
+	s.Set(1, 0, 0, stone)
+	// hidden by its neighbour outside the chunk
+	s.Set(Width-1, 0, 0, stone)
+	s.Set(Width, 0, 0, stone)
+	s.Set(5, 5, 5, grass)
+
+	vertices := mesh(s)
+	// two cubes of 10 and 5 faces, and 4 quads of the plant
+	assert.Equal(t, (10+5+4)*6*VertexSize, len(vertices))
+	assert.Equal(t, []float32{32 - 0.5, 32 - 0.5, -64 - 0.5}, vertices[:3])
+}
+
+func TestSnapshot_GreedyFlatLayer(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	for x := 0; x < Width; x++ {
+		for z := 0; z < Width; z++ {
+			s.Set(x, 5, z, stone)
+		}
+	}
+	vertices := greedy(s)
+	// top, bottom and four sides
+	assert.Equal(t, 6*6*VertexSize, len(vertices))
+	area := faceArea(vertices)
+	assert.Equal(t, float32(Width*Width), area[[3]float32{0, 1, 0}])
+	assert.Equal(t, float32(Width*Width), area[[3]float32{0, -1, 0}])
+	assert.Equal(t, float32(Width), area[[3]float32{1, 0, 0}])
+	assert.Equal(t, float32(Width), area[[3]float32{0, 0, -1}])
+}
+
+func TestSnapshot_GreedyTextures(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(1, 5, 1, stone)
+	s.Set(2, 5, 1, smooth)
+	s.Set(3, 5, 1, brick)
+	s.Set(1, 6, 1, grass)
+
+	vertices := greedy(s)
+	// stone and smooth share a quad, brick has its own
+	top := 0
+	for i := 0; i < len(vertices); i += 6 * VertexSize {
+		if vertices[i+6] == 1 {
+			top++
+		}
+	}
+	assert.Equal(t, 2, top)
+	area := faceArea(vertices)
+	assert.Equal(t, float32(3), area[[3]float32{0, 1, 0}])
+	// and the front of the plant
+	assert.Equal(t, float32(4), area[[3]float32{0, 0, 1}])
+}
+
+func TestSnapshot_GreedyArea(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	blocks := []*Block{nil, nil, nil, stone, smooth, brick, glass, grass, water}
+	s := NewSnapshot(-32, 0, 96)
+	for z := -1; z <= Width; z++ {
+		for y := -1; y <= Width; y++ {
+			for x := -1; x <= Width; x++ {
+				s.Set(x, y, z, blocks[r.Intn(len(blocks))])
+			}
+		}
+	}
+	plain := mesh(s)
+	greedy := greedy(s)
+	assert.Equal(t, faceArea(plain), faceArea(greedy))
+	assert.True(t, len(greedy) < len(plain))
+}
+
+func TestAO_Corners(t *testing.T) {
+	// corners table follows the vertices of AppendCube
+	for d := range dirs {
+		var show [6]bool
+		show[d] = true
+		vertices := AppendCube(nil, show, 0, 1, 0, &stone.Faces)
+		a := d / 2
+		u, v := (a+1)%3, (a+2)%3
+		for i, n := range [4]int{0, 1, 2, 4} {
+			pos := vertices[n*VertexSize : n*VertexSize+3]
+			pos[1]--
+			assert.Equal(t, float32(corners[d][i][0])/2, pos[u], "face %d corner %d", d, i)
+			assert.Equal(t, float32(corners[d][i][1])/2, pos[v], "face %d corner %d", d, i)
+		}
+	}
+}
+
+func TestAO_Occlusion(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(5, 5, 5, stone)
+	assert.Equal(t, [4]int{0, 0, 0, 0}, s.AO(5, 5, 5, Up))
+
+	// block on the edge between corners 0 and 1 of the top, at +z
+	s.Set(5, 6, 6, stone)
+	assert.Equal(t, [4]int{1, 1, 0, 0}, s.AO(5, 5, 5, Up))
+	// and one on the edge of corners 1 and 2, at +x
+	s.Set(6, 6, 5, stone)
+	assert.Equal(t, [4]int{1, 3, 1, 0}, s.AO(5, 5, 5, Up))
+	// diagonal block only
+	s.Set(4, 6, 4, stone)
+	assert.Equal(t, [4]int{1, 3, 1, 1}, s.AO(5, 5, 5, Up))
+
+	// transparent blocks let light through
+	s.Set(5, 4, 4, glass)
+	s.Set(5, 4, 6, grass)
+	assert.Equal(t, [4]int{0, 0, 0, 0}, s.AO(5, 5, 5, Down))
+}
+
+func TestAO_Vertices(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(5, 5, 5, stone)
+	s.Set(4, 6, 6, stone)
+
+	vertices := mesh(s)
+	var top []float32
+	for i := 0; i < len(vertices); i += 6 * VertexSize {
+		if vertices[i+6] == 1 && vertices[i+1] == 5.5 {
+			top = vertices[i : i+6*VertexSize]
+		}
+	}
+	assert.NotNil(t, top)
+	// corner 0 at -x +z is darkened by the diagonal block,
+	// so the diagonal runs between corners 1 and 3 and the first vertex is corner 1
+	assert.Equal(t, [4]int{1, 0, 0, 0}, s.AO(5, 5, 5, Up))
+	assert.Equal(t, []float32{5.5, 5.5, 5.5}, top[:3])
+	for i, ao := range []float32{0, 0, 0, 0, 1.0 / 3, 0} {
+		assert.Equal(t, ao, top[i*VertexSize+aoOffset], "vertex %d", i)
+	}
+}
+
+func TestAO_GreedyKeepsOcclusion(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	for x := 0; x < 4; x++ {
+		s.Set(x, 5, 0, stone)
+	}
+	// a wall on the middle two blocks darkens their tops
+	s.Set(1, 6, 1, stone)
+	s.Set(2, 6, 1, stone)
+
+	vertices := greedy(s)
+	area := faceArea(vertices)
+	plain := faceArea(mesh(s))
+	assert.Equal(t, plain, area)
+	top := 0
+	for i := 0; i < len(vertices); i += 6 * VertexSize {
+		if vertices[i+6] == 1 && vertices[i+1] == 5.5 {
+			top++
+		}
+	}
+	// the two blocks next to the wall differ in occlusion at their outer corners
+	assert.Equal(t, 4, top)
+}
+
+func TestLight_FaceLight(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(5, 5, 5, stone)
+	// full sky unless set otherwise
+	assert.Equal(t, [4][2]float32{{1, 0}, {1, 0}, {1, 0}, {1, 0}}, s.FaceLight(5, 5, 5, Up))
+
+	for x := 3; x <= 7; x++ {
+		for z := 3; z <= 7; z++ {
+			s.SetLight(x, 6, z, 0, 0)
+		}
+	}
+	s.SetLight(5, 6, 5, 0, 12)
+	s.SetLight(6, 6, 5, 0, 9)
+	// a block on the +z edge keeps its light out of corners 0 and 1
+	s.Set(5, 6, 6, stone)
+	s.SetLight(5, 6, 6, MaxLight, MaxLight)
+	light := s.FaceLight(5, 5, 5, Up)
+	assert.Equal(t, [2]float32{0, float32(12+9) / 3 / MaxLight}, light[1])
+	assert.Equal(t, [2]float32{0, float32(12+9) / 4 / MaxLight}, light[2])
+	assert.Equal(t, [2]float32{0, float32(12) / 4 / MaxLight}, light[3])
+}
+
+func TestLight_Vertices(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(5, 5, 5, grass)
+	s.SetLight(5, 5, 5, 3, 6)
+	vertices := mesh(s)
+	assert.Equal(t, 4*6*VertexSize, len(vertices))
+	for i := 0; i < len(vertices); i += VertexSize {
+		assert.Equal(t, float32(3)/MaxLight, vertices[i+skyOffset])
+		assert.Equal(t, float32(6)/MaxLight, vertices[i+blockOffset])
+	}
+
+	// the light of a face is the light in front of it
+	s.Set(5, 5, 5, stone)
+	s.Set(5, 6, 5, nil)
+	for i := 0; i < len(s.light); i++ {
+		s.light[i] = 7 << 4
+	}
+	vertices = greedy(s)
+	for i := 0; i < len(vertices); i += VertexSize {
+		assert.Equal(t, float32(7)/MaxLight, vertices[i+skyOffset])
+		assert.Equal(t, float32(0), vertices[i+blockOffset])
+	}
+}
+
+func TestPass_Buckets(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	s.Set(1, 5, 1, stone)
+	s.Set(3, 5, 1, glass)
+	s.Set(5, 5, 1, grass)
+	s.Set(7, 5, 1, water)
+
+	var b Buckets
+	s.Mesh(&b)
+	assert.Equal(t, 6*6*VertexSize, len(b[Opaque]))
+	assert.Equal(t, (6+4)*6*VertexSize, len(b[Cutout]))
+	assert.Equal(t, 6*6*VertexSize, len(b[Translucent]))
+	assert.Equal(t, 6+6+4+6, b.Faces())
+
+	b.Reset()
+	assert.Equal(t, 0, b.Faces())
+	s.Greedy(&b)
+	assert.Equal(t, 6+6+4+6, b.Faces())
+}
+
+func TestPass_CullSameTransparent(t *testing.T) {
+	s := NewSnapshot(0, 0, 0)
+	// a row of glass, water and glass on top of stone
+	s.Set(1, 5, 1, glass)
+	s.Set(2, 5, 1, glass)
+	s.Set(3, 5, 1, water)
+	s.Set(4, 5, 1, water)
+	s.Set(1, 4, 1, stone)
+
+	var b Buckets
+	s.Mesh(&b)
+	// the stone top is seen through the glass
+	assert.Equal(t, 6*6*VertexSize, len(b[Opaque]))
+	// faces between the two glass and the two water blocks are culled,
+	// glass and water see each other
+	assert.Equal(t, 9*6*VertexSize, len(b[Cutout]))
+	assert.Equal(t, 10*6*VertexSize, len(b[Translucent]))
+
+	var g Buckets
+	s.Greedy(&g)
+	assert.Equal(t, faceArea(b[Cutout]), faceArea(g[Cutout]))
+	assert.Equal(t, faceArea(b[Translucent]), faceArea(g[Translucent]))
+}
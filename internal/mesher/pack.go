@@ -0,0 +1,101 @@
+package mesher
+
+import "math"
+
+const (
+	// PackedSize : bytes of a packed vertex
+	PackedSize = 8
+
+	// Columns : tiles along each side of the texture atlas
+	Columns = 16
+)
+
+// Vertex : a vertex of a chunk mesh, as packed into PackedSize bytes
+//
+//	0-2  x, y, z in half blocks from the lowest corner of the chunk, 0 to 2*Width
+//	3    face in the low 3 bits, ambient occlusion in the next 2 bits
+//	4    tile of the texture atlas, column + row*Columns
+//	5, 6 sky and block light, 0 to 255
+//	7    unused
+type Vertex struct {
+	// X, Y, Z : position relative to the center of the first block of the chunk
+	X, Y, Z    float32
+	Face       int
+	AO         int
+	Tile       int
+	Sky, Block float32
+}
+
+// Pack appends v packed to dst
+func Pack(dst []byte, v Vertex) []byte {
+	return append(dst,
+		half(v.X), half(v.Y), half(v.Z),
+		byte(v.Face)|byte(v.AO)<<3,
+		byte(v.Tile),
+		unit(v.Sky), unit(v.Block),
+		0,
+	)
+}
+
+// Unpack returns the vertex packed in the first PackedSize bytes of b
+func Unpack(b []byte) Vertex {
+	return Vertex{
+		X:     float32(b[0])/2 - 0.5,
+		Y:     float32(b[1])/2 - 0.5,
+		Z:     float32(b[2])/2 - 0.5,
+		Face:  int(b[3] & 7),
+		AO:    int(b[3] >> 3 & 3),
+		Tile:  int(b[4]),
+		Sky:   float32(b[5]) / 255,
+		Block: float32(b[6]) / 255,
+	}
+}
+
+func half(p float32) byte {
+	return byte(math.Round(float64(p+0.5) * 2))
+}
+
+func unit(f float32) byte {
+	return byte(math.Round(float64(f) * 255))
+}
+
+// PackQuads appends faces of vertices, six vertices of VertexSize floats each, as four packed vertices,
+// in the order drawn by QuadIndices. x, y, z is the world position of the first block of the chunk
+func PackQuads(dst []byte, vertices []float32, x, y, z int) []byte {
+	origin := [3]float32{float32(x), float32(y), float32(z)}
+	for i := 0; i+6*VertexSize <= len(vertices); i += 6 * VertexSize {
+		// the second triangle repeats the third and first vertex of the first one
+		for _, c := range [4]int{0, 1, 2, 4} {
+			dst = Pack(dst, vertex(vertices[i+c*VertexSize:], origin))
+		}
+	}
+	return dst
+}
+
+// vertex unpacks the floats of a vertex made by AppendCube or AppendPlant
+func vertex(f []float32, origin [3]float32) Vertex {
+	v := Vertex{
+		X:     f[0] - origin[0],
+		Y:     f[1] - origin[1],
+		Z:     f[2] - origin[2],
+		AO:    int(math.Round(float64(f[aoOffset]) * 3)),
+		Tile:  int(f[3]*Columns) + int(f[4]*Columns)*Columns,
+		Sky:   f[skyOffset],
+		Block: f[blockOffset],
+	}
+	for d, dir := range dirs {
+		if f[5] == float32(dir[0]) && f[6] == float32(dir[1]) && f[7] == float32(dir[2]) {
+			v.Face = d
+		}
+	}
+	return v
+}
+
+// QuadIndices appends indices of the two triangles of n quads of four vertices to dst
+func QuadIndices(dst []uint32, n int) []uint32 {
+	for i := 0; i < n; i++ {
+		q := uint32(i * 4)
+		dst = append(dst, q, q+1, q+2, q+2, q+3, q)
+	}
+	return dst
+}
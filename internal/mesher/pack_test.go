@@ -0,0 +1,132 @@
+package mesher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// atlasFaces returns faces of tile idx of the atlas, inset like the textures of blocks
+func atlasFaces(idx int) [6]Face {
+	m := float32(1) / Columns
+	dx, dy := float32(idx%Columns)*m, float32(idx/Columns)*m
+	n := float32(1) / 2048
+	m -= n
+	face := Face{{dx + n, dy + n}, {dx + m, dy + n}, {dx + m, dy + m}, {dx + m, dy + m}, {dx + n, dy + m}, {dx + n, dy + n}}
+	return [6]Face{face, face, face, face, face, face}
+}
+
+func TestPack_RoundTrip(t *testing.T) {
+	vertices := []Vertex{
+		{X: -0.5, Y: -0.5, Z: -0.5},
+		{X: Width - 0.5, Y: Width - 0.5, Z: Width - 0.5, Face: Back, AO: 3, Tile: 255, Sky: 1, Block: 1},
+		{X: 7, Y: 12.5, Z: 3.5, Face: Up, AO: 1, Tile: 17, Sky: 0.2, Block: 0.6},
+	}
+	var packed []byte
+	for _, v := range vertices {
+		packed = Pack(packed, v)
+	}
+	assert.Equal(t, len(vertices)*PackedSize, len(packed))
+	for i, v := range vertices {
+		assert.Equal(t, v, Unpack(packed[i*PackedSize:]))
+	}
+
+	// light keeps 256 levels
+	v := Unpack(Pack(nil, Vertex{Sky: 13.0 / 45}))
+	assert.InDelta(t, 13.0/45, v.Sky, 0.5/255)
+}
+
+func TestPack_Quads(t *testing.T) {
+	s := NewSnapshot(32, 64, -32)
+	b := &Block{Shape: ShapeCube, Faces: atlasFaces(37)}
+	s.Set(3, 4, 5, b)
+	s.SetLight(3, 5, 5, 9, 6)
+	var buckets Buckets
+	s.Mesh(&buckets)
+
+	packed := PackQuads(nil, buckets[Opaque], s.X, s.Y, s.Z)
+	assert.Equal(t, 6*4*PackedSize, len(packed))
+	faces := make(map[int]int)
+	for i := 0; i < len(packed); i += PackedSize {
+		v := Unpack(packed[i:])
+		faces[v.Face]++
+		assert.Equal(t, 37, v.Tile)
+		assert.InDelta(t, 3, v.X, 0.5)
+		assert.InDelta(t, 4, v.Y, 0.5)
+		assert.InDelta(t, 5, v.Z, 0.5)
+		if v.Face == Up {
+			assert.Equal(t, float32(4.5), v.Y)
+		}
+	}
+	assert.Equal(t, map[int]int{Left: 4, Right: 4, Up: 4, Down: 4, Front: 4, Back: 4}, faces)
+
+	// corners of the top face keep light of the block above
+	up := packed[2*4*PackedSize:]
+	for i := 0; i < 4; i++ {
+		v := Unpack(up[i*PackedSize:])
+		assert.Equal(t, Up, v.Face)
+		assert.True(t, v.Sky > 0 && v.Block > 0, "vertex %d", i)
+	}
+}
+
+func TestPack_FlippedQuad(t *testing.T) {
+	s := NewSnapshot(0, 32, 0)
+	b := &Block{Shape: ShapeCube, Faces: atlasFaces(1)}
+	s.Set(1, 1, 1, b)
+	// dark first corner of the top face, so the diagonal is flipped
+	s.Set(0, 2, 1, b)
+	s.Set(1, 2, 0, b)
+	var buckets Buckets
+	s.Mesh(&buckets)
+
+	var top []float32
+	for i := 0; i < len(buckets[Opaque]); i += 6 * VertexSize {
+		if buckets[Opaque][i+6] == 1 {
+			top = buckets[Opaque][i : i+6*VertexSize]
+		}
+	}
+	packed := PackQuads(nil, top, s.X, s.Y, s.Z)
+	// drawing the packed quad by QuadIndices gives the triangles of the float vertices
+	for i, index := range QuadIndices(nil, 1) {
+		v := Unpack(packed[index*PackedSize:])
+		assert.Equal(t, top[i*VertexSize], v.X+float32(s.X))
+		assert.Equal(t, top[i*VertexSize+1], v.Y+float32(s.Y))
+		assert.Equal(t, top[i*VertexSize+2], v.Z+float32(s.Z))
+		assert.Equal(t, int(top[i*VertexSize+aoOffset]*3+0.5), v.AO)
+	}
+}
+
+func TestPack_Plant(t *testing.T) {
+	vertices := AppendPlant(nil, 40, 0, 2, &[6]Face{})
+	packed := PackQuads(nil, vertices, 32, 0, 0)
+	assert.Equal(t, 4*4*PackedSize, len(packed))
+	v := Unpack(packed)
+	assert.Equal(t, Vertex{X: 8, Y: -0.5, Z: 1.5, Face: Left, Sky: 1}, v)
+}
+
+func TestQuadIndices(t *testing.T) {
+	assert.Equal(t, []uint32{0, 1, 2, 2, 3, 0, 4, 5, 6, 6, 7, 4}, QuadIndices(nil, 2))
+}
+
+func BenchmarkPack_Quads(b *testing.B) {
+	s := NewSnapshot(0, 0, 0)
+	stone := &Block{Shape: ShapeCube, Faces: atlasFaces(1)}
+	for x := 0; x < Width; x += 2 {
+		for y := 0; y < Width; y += 2 {
+			for z := 0; z < Width; z += 2 {
+				s.Set(x, y, z, stone)
+			}
+		}
+	}
+	var buckets Buckets
+	s.Mesh(&buckets)
+	vertices := buckets[Opaque]
+
+	var packed []byte
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packed = PackQuads(packed[:0], vertices, 0, 0, 0)
+	}
+	// float vertices take 4 bytes a float
+	b.ReportMetric(float64(len(vertices)*4)/float64(len(packed)), "x-smaller")
+}
@@ -0,0 +1,394 @@
+package internal
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	mcBlocksPath = flag.String("mcblocks", "anvil.json", "mapping of Minecraft block states to blocks")
+)
+
+// AnvilMapping : blocks of Minecraft block states, and Minecraft block states of blocks
+type AnvilMapping struct {
+	entries []anvilMappingEntry
+	// states of blocks, the first entry of each block
+	states map[BlockType]anvilState
+
+	// unmapped states import as unmappedBlock, unmapped blocks export as unmappedState
+	unmappedBlock BlockType
+	unmappedState anvilState
+}
+
+// anvilMappingEntry maps Minecraft block Minecraft to block Block,
+// only states with all of Properties match on import, and Properties are written on export
+type anvilMappingEntry struct {
+	Minecraft  string            `json:"minecraft"`
+	Properties map[string]string `json:"properties"`
+	Block      string            `json:"block"`
+
+	block BlockType
+}
+
+// matches reports whether Minecraft state s maps to e
+func (e *anvilMappingEntry) matches(s anvilState) bool {
+	if e.Minecraft != s.Name {
+		return false
+	}
+	for k, v := range e.Properties {
+		if s.Properties[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// anvilName adds the minecraft namespace to names without one
+func anvilName(name string) string {
+	if !strings.Contains(name, ":") {
+		return "minecraft:" + name
+	}
+	return name
+}
+
+// ReadAnvilMapping reads mapping json file path, block names are looked up in the loaded blocks
+func ReadAnvilMapping(path string) (*AnvilMapping, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseAnvilMapping(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return m, nil
+}
+
+// LoadAnvilMapping reads mapping of -mcblocks file
+func LoadAnvilMapping() (*AnvilMapping, error) {
+	return ReadAnvilMapping(*mcBlocksPath)
+}
+
+// parseAnvilMapping parses
+//
+//	{
+//	  "unmapped": {"minecraft": "stone", "block": "air"},
+//	  "blocks": [{"minecraft": "oak_log", "properties": {"axis": "y"}, "block": "wood"}, ...]
+//	}
+//
+// the first entry matching a state wins on import, and the first entry of a block on export
+func parseAnvilMapping(data []byte) (*AnvilMapping, error) {
+	var file struct {
+		Unmapped anvilMappingEntry   `json:"unmapped"`
+		Blocks   []anvilMappingEntry `json:"blocks"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	m := &AnvilMapping{
+		states:        make(map[BlockType]anvilState),
+		unmappedState: anvilState{Name: "minecraft:air"},
+	}
+	if file.Unmapped.Minecraft != "" {
+		m.unmappedState = anvilState{Name: anvilName(file.Unmapped.Minecraft), Properties: file.Unmapped.Properties}
+	}
+	if file.Unmapped.Block != "" {
+		w, ok := registry.Lookup(file.Unmapped.Block)
+		if !ok {
+			return nil, fmt.Errorf("unknown block %q", file.Unmapped.Block)
+		}
+		m.unmappedBlock = w
+	}
+
+	for _, e := range file.Blocks {
+		if e.Minecraft == "" {
+			return nil, fmt.Errorf("entry of block %q has no minecraft state", e.Block)
+		}
+		w, ok := registry.Lookup(e.Block)
+		if !ok {
+			return nil, fmt.Errorf("%s maps to unknown block %q", e.Minecraft, e.Block)
+		}
+		e.Minecraft, e.block = anvilName(e.Minecraft), w
+		m.entries = append(m.entries, e)
+		if _, ok := m.states[w]; !ok {
+			m.states[w] = anvilState{Name: e.Minecraft, Properties: e.Properties}
+		}
+	}
+	if _, ok := m.states[0]; !ok {
+		m.states[0] = anvilState{Name: "minecraft:air"}
+	}
+	return m, nil
+}
+
+// block returns block of Minecraft state s, ok is false if s is not mapped
+func (m *AnvilMapping) block(s anvilState) (BlockType, bool) {
+	for i := range m.entries {
+		if m.entries[i].matches(s) {
+			return m.entries[i].block, true
+		}
+	}
+	return m.unmappedBlock, false
+}
+
+// state returns Minecraft state of block w, ok is false if w is not mapped
+func (m *AnvilMapping) state(w BlockType) (anvilState, bool) {
+	if s, ok := m.states[w]; ok {
+		return s, true
+	}
+	return m.unmappedState, false
+}
+
+// AnvilStats : what an Anvil import or export did
+type AnvilStats struct {
+	Chunks int
+	// Unmapped counts blocks without a mapping, by Minecraft state on import and by block name on export
+	Unmapped map[string]int
+}
+
+func (st *AnvilStats) unmapped(name string, n int) {
+	if st.Unmapped == nil {
+		st.Unmapped = make(map[string]int)
+	}
+	st.Unmapped[name] += n
+}
+
+// parseRegionFileName returns region X, Z of file name r.X.Z.mca
+func parseRegionFileName(path string) (int, int, error) {
+	var x, z int
+	name := filepath.Base(path)
+	_, err := fmt.Sscanf(name, "r.%d.%d.mca", &x, &z)
+	if err != nil || name != regionFileName(x, z) {
+		return 0, 0, fmt.Errorf("%s is not named r.X.Z.mca", name)
+	}
+	return x, z, nil
+}
+
+func regionFileName(x, z int) string {
+	return fmt.Sprintf("r.%d.%d.mca", x, z)
+}
+
+// ImportAnvil reads Minecraft region file path into s, Minecraft block x, y, z goes to x+offset.X, y+offset.Y, z+offset.Z.
+// All blocks of sections saved in the region, air too, replace generated and edited blocks.
+// A Minecraft chunk is 16x16 blocks of any height, so blocks are gathered into chunks of s,
+// committed in batches as they fill up and merged with the parts committed before
+func (s *Store) ImportAnvil(path string, m *AnvilMapping, offset BlockID) (AnvilStats, error) {
+	var stats AnvilStats
+	rx, rz, err := parseRegionFileName(path)
+	if err != nil {
+		return stats, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return stats, err
+	}
+	region, err := parseAnvilRegion(data)
+	if err != nil {
+		return stats, fmt.Errorf("%s: %s", path, err)
+	}
+	if err := s.Flush(); err != nil {
+		return stats, err
+	}
+
+	chunks := make(map[ChunkID][]BlockType)
+	commit := func() error {
+		batch := make(map[ChunkID][]byte, len(chunks))
+		for cid, overrides := range chunks {
+			value, err := encodeOverridesDbValue(overrides)
+			if err != nil {
+				return err
+			}
+			batch[cid] = value
+		}
+		chunks = make(map[ChunkID][]BlockType)
+		_, err := s.importChunks(batch, ConflictMerge)
+		return err
+	}
+
+	for i := range region {
+		if region[i] == nil {
+			continue
+		}
+		cx, cz := rx*anvilRegionWidth+i%anvilRegionWidth, rz*anvilRegionWidth+i/anvilRegionWidth
+		root, err := region.chunk(i)
+		if err != nil {
+			return stats, fmt.Errorf("chunk %d, %d: %s", cx, cz, err)
+		}
+		chunk, err := parseAnvilChunk(root, cx, cz)
+		if err != nil {
+			return stats, fmt.Errorf("chunk %d, %d: %s", cx, cz, err)
+		}
+		for _, section := range chunk.sections {
+			importAnvilSection(chunks, chunk, &section, m, offset, &stats)
+		}
+		stats.Chunks++
+		if len(chunks) >= archiveImportBatch {
+			if err := commit(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, commit()
+}
+
+// importAnvilSection sets blocks of section of chunk c in overrides of chunks
+func importAnvilSection(chunks map[ChunkID][]BlockType, c *anvilChunk, section *anvilSection, m *AnvilMapping, offset BlockID, stats *AnvilStats) {
+	blocks := make([]BlockType, len(section.palette))
+	mapped := make([]bool, len(section.palette))
+	for i, state := range section.palette {
+		blocks[i], mapped[i] = m.block(state)
+	}
+	counts := make([]int, len(section.palette))
+
+	x0 := c.X*anvilSectionWidth + offset.X
+	y0 := section.Y*anvilSectionWidth + offset.Y
+	z0 := c.Z*anvilSectionWidth + offset.Z
+	var cid ChunkID
+	var overrides []BlockType
+	for i := 0; i < anvilSectionBlocks; i++ {
+		x, z, y := i%anvilSectionWidth, i/anvilSectionWidth%anvilSectionWidth, i/(anvilSectionWidth*anvilSectionWidth)
+		bid := BlockID{x0 + x, y0 + y, z0 + z}
+		if id := bid.ChunkID(); overrides == nil || id != cid {
+			cid = id
+			overrides = chunks[cid]
+			if overrides == nil {
+				overrides = newOverrides()
+				chunks[cid] = overrides
+			}
+		}
+		idx := section.state(i)
+		overrides[bid.ToIndex()] = blocks[idx]
+		counts[idx]++
+	}
+	for i, n := range counts {
+		if !mapped[i] && n > 0 {
+			stats.unmapped(section.palette[i].String(), n)
+		}
+	}
+}
+
+// ExportAnvil writes Minecraft chunks covering blocks x0, z0 to x1, z1 of w as region files in dir,
+// block x, y, z goes to Minecraft block x-offset.X, y-offset.Y, z-offset.Z, from y -64 to 319 which Minecraft keeps.
+// Chunks already in region files of dir are replaced, other chunks of the files are kept
+func ExportAnvil(w *World, m *AnvilMapping, dir string, offset BlockID, x0, z0, x1, z1 int) (AnvilStats, error) {
+	var stats AnvilStats
+	cx0, cz0 := floorDiv(x0-offset.X, anvilSectionWidth), floorDiv(z0-offset.Z, anvilSectionWidth)
+	cx1, cz1 := floorDiv(x1-offset.X, anvilSectionWidth), floorDiv(z1-offset.Z, anvilSectionWidth)
+	for rz := floorDiv(cz0, anvilRegionWidth); rz <= floorDiv(cz1, anvilRegionWidth); rz++ {
+		for rx := floorDiv(cx0, anvilRegionWidth); rx <= floorDiv(cx1, anvilRegionWidth); rx++ {
+			path := filepath.Join(dir, regionFileName(rx, rz))
+			region := new(anvilRegion)
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				region, err = parseAnvilRegion(data)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return stats, fmt.Errorf("%s: %s", path, err)
+			}
+
+			// gocraft chunks read for this row of Minecraft chunks and the next
+			cache := make(map[ChunkID]*Chunk)
+			for z := 0; z < anvilRegionWidth; z++ {
+				cz := rz*anvilRegionWidth + z
+				if cz < cz0 || cz > cz1 {
+					continue
+				}
+				for x := 0; x < anvilRegionWidth; x++ {
+					cx := rx*anvilRegionWidth + x
+					if cx < cx0 || cx > cx1 {
+						continue
+					}
+					chunk := exportAnvilChunk(w, cache, m, offset, cx, cz, &stats)
+					if err := region.setChunk(x+z*anvilRegionWidth, chunk.encode()); err != nil {
+						return stats, err
+					}
+					stats.Chunks++
+				}
+				next := floorDiv((cz+1)*anvilSectionWidth+offset.Z, ChunkWidth)
+				for cid := range cache {
+					if cid.Z < next {
+						delete(cache, cid)
+					}
+				}
+			}
+
+			f, err := ioutil.TempFile(dir, regionFileName(rx, rz))
+			if err != nil {
+				return stats, err
+			}
+			err = region.write(f)
+			if err == nil {
+				err = f.Chmod(0644)
+			}
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err == nil {
+				err = os.Rename(f.Name(), path)
+			}
+			if err != nil {
+				os.Remove(f.Name())
+				return stats, err
+			}
+		}
+	}
+	return stats, nil
+}
+
+// exportAnvilChunk returns Minecraft chunk cx, cz of w, sections of air only are left out
+func exportAnvilChunk(w *World, cache map[ChunkID]*Chunk, m *AnvilMapping, offset BlockID, cx, cz int, stats *AnvilStats) *anvilChunk {
+	c := &anvilChunk{X: cx, Z: cz}
+	air, _ := m.state(0)
+	for sy := anvilMinSection; sy <= anvilMaxSection; sy++ {
+		section := anvilSection{Y: sy, indexes: make([]uint16, anvilSectionBlocks)}
+		// blocks mapped to the same state share an index
+		indexes := make(map[string]uint16)
+		counts := make(map[BlockType]int)
+		x0 := cx*anvilSectionWidth + offset.X
+		y0 := sy*anvilSectionWidth + offset.Y
+		z0 := cz*anvilSectionWidth + offset.Z
+		for i := range section.indexes {
+			x, z, y := i%anvilSectionWidth, i/anvilSectionWidth%anvilSectionWidth, i/(anvilSectionWidth*anvilSectionWidth)
+			bid := BlockID{x0 + x, y0 + y, z0 + z}
+			cid := bid.ChunkID()
+			chunk, ok := cache[cid]
+			if !ok {
+				chunk = w.peekChunk(cid)
+				cache[cid] = chunk
+			}
+			var tp BlockType
+			if chunk != nil {
+				tp = chunk.Block(bid)
+			}
+			counts[tp]++
+
+			state, _ := m.state(tp)
+			key := state.String()
+			idx, ok := indexes[key]
+			if !ok {
+				idx = uint16(len(section.palette))
+				indexes[key] = idx
+				section.palette = append(section.palette, state)
+			}
+			section.indexes[i] = idx
+		}
+		for tp, n := range counts {
+			if _, mapped := m.state(tp); !mapped {
+				stats.unmapped(registry.Def(tp).Name, n)
+			}
+		}
+		if len(section.palette) == 1 {
+			if section.palette[0].String() == air.String() {
+				continue
+			}
+			section.indexes = nil
+		}
+		c.sections = append(c.sections, section)
+	}
+	return c
+}
@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// NBT tags, the binary format of Minecraft saves, all numbers are big-endian
+const (
+	nbtTagEnd byte = iota
+	nbtTagByte
+	nbtTagShort
+	nbtTagInt
+	nbtTagLong
+	nbtTagFloat
+	nbtTagDouble
+	nbtTagByteArray
+	nbtTagString
+	nbtTagList
+	nbtTagCompound
+	nbtTagIntArray
+	nbtTagLongArray
+)
+
+// nesting limit of lists and compounds, same as Minecraft
+const nbtMaxDepth = 512
+
+// nbtCompound holds values of named tags:
+// int8, int16, int32, int64, float32, float64, []byte, string, nbtList, nbtCompound, []int32, []int64
+type nbtCompound map[string]interface{}
+
+// nbtList : list tag, all items are of the type of the first one
+type nbtList []interface{}
+
+var errNBTShort = errors.New("nbt: unexpected end of data")
+
+// decodeNBT decodes the root compound of b
+func decodeNBT(b []byte) (nbtCompound, error) {
+	d := &nbtDecoder{b: b}
+	tag, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	if tag != nbtTagCompound {
+		return nil, fmt.Errorf("nbt: root tag is %d, not compound", tag)
+	}
+	if _, err := d.string(); err != nil {
+		return nil, err
+	}
+	v, err := d.payload(nbtTagCompound, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v.(nbtCompound), nil
+}
+
+type nbtDecoder struct {
+	b []byte
+}
+
+func (d *nbtDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.b) {
+		return nil, errNBTShort
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p, nil
+}
+
+func (d *nbtDecoder) byte() (byte, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return p[0], nil
+}
+
+func (d *nbtDecoder) uint16() (uint16, error) {
+	p, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(p), nil
+}
+
+func (d *nbtDecoder) uint32() (uint32, error) {
+	p, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(p), nil
+}
+
+func (d *nbtDecoder) uint64() (uint64, error) {
+	p, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(p), nil
+}
+
+func (d *nbtDecoder) string() (string, error) {
+	n, err := d.uint16()
+	if err != nil {
+		return "", err
+	}
+	p, err := d.next(int(n))
+	return string(p), err
+}
+
+// length reads length of an array or list of items of size bytes each,
+// checked against the data left so corrupt lengths fail before allocating
+func (d *nbtDecoder) length(size int) (int, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if int32(n) < 0 || int(n)*size > len(d.b) {
+		return 0, fmt.Errorf("nbt: bad length %d", int32(n))
+	}
+	return int(n), nil
+}
+
+func (d *nbtDecoder) payload(tag byte, depth int) (interface{}, error) {
+	switch tag {
+	case nbtTagByte:
+		v, err := d.byte()
+		return int8(v), err
+	case nbtTagShort:
+		v, err := d.uint16()
+		return int16(v), err
+	case nbtTagInt:
+		v, err := d.uint32()
+		return int32(v), err
+	case nbtTagLong:
+		v, err := d.uint64()
+		return int64(v), err
+	case nbtTagFloat:
+		v, err := d.uint32()
+		return math.Float32frombits(v), err
+	case nbtTagDouble:
+		v, err := d.uint64()
+		return math.Float64frombits(v), err
+	case nbtTagByteArray:
+		n, err := d.length(1)
+		if err != nil {
+			return nil, err
+		}
+		p, _ := d.next(n)
+		return append([]byte(nil), p...), nil
+	case nbtTagString:
+		return d.string()
+	case nbtTagIntArray:
+		n, err := d.length(4)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, n)
+		for i := range v {
+			x, _ := d.uint32()
+			v[i] = int32(x)
+		}
+		return v, nil
+	case nbtTagLongArray:
+		n, err := d.length(8)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int64, n)
+		for i := range v {
+			x, _ := d.uint64()
+			v[i] = int64(x)
+		}
+		return v, nil
+	}
+
+	if depth >= nbtMaxDepth {
+		return nil, errors.New("nbt: nested too deep")
+	}
+	switch tag {
+	case nbtTagList:
+		item, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		// items take a byte at least
+		n, err := d.length(1)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 && item == nbtTagEnd {
+			return nil, errors.New("nbt: list of end tags")
+		}
+		list := make(nbtList, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := d.payload(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case nbtTagCompound:
+		c := make(nbtCompound)
+		for {
+			item, err := d.byte()
+			if err != nil {
+				return nil, err
+			}
+			if item == nbtTagEnd {
+				return c, nil
+			}
+			name, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			c[name], err = d.payload(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("nbt: unknown tag %d", tag)
+}
+
+// encodeNBT encodes c as an unnamed root compound
+func encodeNBT(c nbtCompound) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(nbtTagCompound)
+	buf.Write([]byte{0, 0})
+	if err := encodeNBTPayload(buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func nbtTagOf(v interface{}) (byte, error) {
+	switch v.(type) {
+	case int8:
+		return nbtTagByte, nil
+	case int16:
+		return nbtTagShort, nil
+	case int32:
+		return nbtTagInt, nil
+	case int64:
+		return nbtTagLong, nil
+	case float32:
+		return nbtTagFloat, nil
+	case float64:
+		return nbtTagDouble, nil
+	case []byte:
+		return nbtTagByteArray, nil
+	case string:
+		return nbtTagString, nil
+	case nbtList:
+		return nbtTagList, nil
+	case nbtCompound:
+		return nbtTagCompound, nil
+	case []int32:
+		return nbtTagIntArray, nil
+	case []int64:
+		return nbtTagLongArray, nil
+	}
+	return 0, fmt.Errorf("nbt: can not encode %T", v)
+}
+
+func encodeNBTPayload(buf *bytes.Buffer, v interface{}) error {
+	var tmp [8]byte
+	putString := func(s string) {
+		binary.BigEndian.PutUint16(tmp[:], uint16(len(s)))
+		buf.Write(tmp[:2])
+		buf.WriteString(s)
+	}
+	putLength := func(n int) {
+		binary.BigEndian.PutUint32(tmp[:], uint32(n))
+		buf.Write(tmp[:4])
+	}
+
+	switch v := v.(type) {
+	case int8, int16, int32, int64, float32, float64:
+		binary.Write(buf, binary.BigEndian, v)
+	case []byte:
+		putLength(len(v))
+		buf.Write(v)
+	case string:
+		if len(v) > math.MaxUint16 {
+			return fmt.Errorf("nbt: string of %d bytes is too long", len(v))
+		}
+		putString(v)
+	case []int32:
+		putLength(len(v))
+		binary.Write(buf, binary.BigEndian, v)
+	case []int64:
+		putLength(len(v))
+		binary.Write(buf, binary.BigEndian, v)
+	case nbtList:
+		item := nbtTagEnd
+		if len(v) > 0 {
+			var err error
+			if item, err = nbtTagOf(v[0]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(item)
+		putLength(len(v))
+		for _, x := range v {
+			if tag, _ := nbtTagOf(x); tag != item {
+				return fmt.Errorf("nbt: list of %T has a %T", v[0], x)
+			}
+			if err := encodeNBTPayload(buf, x); err != nil {
+				return err
+			}
+		}
+	case nbtCompound:
+		// in order of names, so the same compound is always the same bytes
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			x := v[name]
+			tag, err := nbtTagOf(x)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			buf.WriteByte(tag)
+			putString(name)
+			if err := encodeNBTPayload(buf, x); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(nbtTagEnd)
+	default:
+		return fmt.Errorf("nbt: can not encode %T", v)
+	}
+	return nil
+}
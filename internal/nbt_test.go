@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNBT_RoundTrip(t *testing.T) {
+	root := nbtCompound{
+		"byte":   int8(-3),
+		"short":  int16(-300),
+		"int":    int32(70000),
+		"long":   int64(-1) << 40,
+		"float":  float32(1.5),
+		"double": float64(-2.25),
+		"bytes":  []byte{1, 2, 255},
+		"string": "minecraft:stone",
+		"ints":   []int32{-1, 2},
+		"longs":  []int64{-1 << 62, 3},
+		"empty":  nbtList{},
+		"list":   nbtList{nbtCompound{"Name": "a"}, nbtCompound{"Name": "b", "Properties": nbtCompound{"axis": "y"}}},
+		"nested": nbtList{nbtList{int8(1)}, nbtList{}},
+	}
+	b, err := encodeNBT(root)
+	assert.Nil(t, err)
+	decoded, err := decodeNBT(b)
+	assert.Nil(t, err)
+	assert.Equal(t, root, decoded)
+
+	// names are written in order
+	again, _ := encodeNBT(decoded)
+	assert.Equal(t, b, again)
+
+	_, err = encodeNBT(nbtCompound{"mixed": nbtList{int8(1), int16(2)}})
+	assert.NotNil(t, err)
+	_, err = encodeNBT(nbtCompound{"int": 1})
+	assert.NotNil(t, err)
+}
+
+func TestNBT_Corrupt(t *testing.T) {
+	b, err := encodeNBT(nbtCompound{"longs": []int64{1, 2, 3}, "name": "stone"})
+	assert.Nil(t, err)
+	for i := 0; i < len(b); i++ {
+		_, err := decodeNBT(b[:i])
+		assert.NotNil(t, err, "cut at %d", i)
+	}
+
+	// root is not a compound
+	_, err = decodeNBT([]byte{nbtTagString, 0, 0, 0, 1, 'a'})
+	assert.NotNil(t, err)
+	// list of a billion bytes in a few bytes
+	_, err = decodeNBT([]byte{nbtTagCompound, 0, 0, nbtTagList, 0, 1, 'l', nbtTagByte, 0x40, 0, 0, 0, 0})
+	assert.NotNil(t, err)
+	// unknown tag
+	_, err = decodeNBT([]byte{nbtTagCompound, 0, 0, 13, 0, 1, 'x', 0, 0})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"flag"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var (
+	stepUp = flag.Float64("stepup", 1, "max ledge height the player walks up, 0 to disable")
+)
+
+// physicsEpsilon : gap kept between the box and blocks, so touching faces don't count as overlap
+const physicsEpsilon = 1e-3
+
+// standingProbe : box this close above a block stands on it
+const standingProbe = 0.05
+
+// aabb : axis aligned box in world coordinates
+type aabb struct {
+	min, max mgl32.Vec3
+}
+
+func (b aabb) offset(axis int, d float32) aabb {
+	b.min[axis] += d
+	b.max[axis] += d
+	return b
+}
+
+// cells returns range of block coordinates overlapped by [min, max] on an axis
+func cells(min, max float32) (int, int) {
+	lo := int(math.Floor(float64(min + 0.5 + physicsEpsilon)))
+	hi := int(math.Floor(float64(max + 0.5 - physicsEpsilon)))
+	return lo, hi
+}
+
+// Physics : moves a player box through the world, resolving collision on each axis
+type Physics struct {
+	// Width and Height of the box, the eye (camera position) is Eye above its bottom
+	Width, Height, Eye float32
+	// StepUp is the max ledge height climbed while walking, 0 disables it
+	StepUp float32
+	// Sneak stops walking off edges while on ground
+	Sneak bool
+
+	OnGround   bool
+	HitCeiling bool
+}
+
+func NewPhysics() *Physics {
+	return &Physics{
+		Width:  0.6,
+		Height: 1.8,
+		Eye:    1.5,
+		StepUp: float32(*stepUp),
+	}
+}
+
+func (p *Physics) box(eye mgl32.Vec3) aabb {
+	min := mgl32.Vec3{eye.X() - p.Width/2, eye.Y() - p.Eye, eye.Z() - p.Width/2}
+	return aabb{min: min, max: min.Add(mgl32.Vec3{p.Width, p.Height, p.Width})}
+}
+
+// Overlaps returns whether block bid overlaps the box of eye position
+func (p *Physics) Overlaps(eye mgl32.Vec3, bid BlockID) bool {
+	b := p.box(eye)
+	id := [3]int{bid.X, bid.Y, bid.Z}
+	for i := 0; i < 3; i++ {
+		lo, hi := cells(b.min[i], b.max[i])
+		if id[i] < lo || id[i] > hi {
+			return false
+		}
+	}
+	return true
+}
+
+// Move moves eye position by delta and returns the new position,
+// the box stops at blocks, and OnGround and HitCeiling are updated
+func (p *Physics) Move(w *World, eye, delta mgl32.Vec3) mgl32.Vec3 {
+	box := p.box(eye)
+
+	dy := p.sweep(w, box, 1, delta.Y())
+	box = box.offset(1, dy)
+	p.HitCeiling = delta.Y() > 0 && dy < delta.Y()
+	p.OnGround = delta.Y() <= 0 && p.standing(w, box)
+
+	for _, axis := range []int{0, 2} {
+		d := delta[axis]
+		if d == 0 {
+			continue
+		}
+		moved := p.sweep(w, box, axis, d)
+		if moved != d && p.OnGround && p.StepUp > 0 {
+			// lift the box, move and put it down again
+			up := p.sweep(w, box, 1, p.StepUp)
+			lifted := box.offset(1, up)
+			if m := p.sweep(w, lifted, axis, d); abs(m) > abs(moved) {
+				lifted = lifted.offset(axis, m)
+				box = lifted.offset(1, p.sweep(w, lifted, 1, -up))
+				continue
+			}
+		}
+		if p.Sneak && p.OnGround {
+			moved = p.sneakClamp(w, box, axis, moved)
+		}
+		box = box.offset(axis, moved)
+	}
+
+	return mgl32.Vec3{box.min.X() + p.Width/2, box.min.Y() + p.Eye, box.min.Z() + p.Width/2}
+}
+
+// sweep returns how far box moves along axis up to d before it hits a block
+func (p *Physics) sweep(w *World, box aabb, axis int, d float32) float32 {
+	if d == 0 {
+		return 0
+	}
+	swept := box
+	if d > 0 {
+		swept.max[axis] += d
+	} else {
+		swept.min[axis] += d
+	}
+	x0, x1 := cells(swept.min.X(), swept.max.X())
+	y0, y1 := cells(swept.min.Y(), swept.max.Y())
+	z0, z1 := cells(swept.min.Z(), swept.max.Z())
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			for z := z0; z <= z1; z++ {
+				if !w.Block(BlockID{x, y, z}).IsObstacle() {
+					continue
+				}
+				// blocks already overlapping the box don't stop it, so it can get out of them
+				c := float32([3]int{x, y, z}[axis])
+				if d > 0 && c-0.5 >= box.max[axis]-physicsEpsilon {
+					d = mgl32.Clamp(c-0.5-physicsEpsilon-box.max[axis], 0, d)
+				}
+				if d < 0 && c+0.5 <= box.min[axis]+physicsEpsilon {
+					d = mgl32.Clamp(c+0.5+physicsEpsilon-box.min[axis], d, 0)
+				}
+			}
+		}
+	}
+	return d
+}
+
+// standing returns whether there is a block right under box
+func (p *Physics) standing(w *World, box aabb) bool {
+	return p.sweep(w, box, 1, -standingProbe) > -standingProbe
+}
+
+// sneakClamp limits move d along axis, so box doesn't walk off the blocks it stands on
+func (p *Physics) sneakClamp(w *World, box aabb, axis int, d float32) float32 {
+	// steps are smaller than the box, so it can't skip over a hole
+	step := p.Width / 2
+	var moved float32
+	for moved != d {
+		s := mgl32.Clamp(d-moved, -step, step)
+		if !p.standing(w, box.offset(axis, moved+s)) {
+			return moved + p.edge(w, box.offset(axis, moved), axis, s)
+		}
+		moved += s
+	}
+	return moved
+}
+
+// edge returns how far box moves along axis up to d, before it leaves the blocks under it
+func (p *Physics) edge(w *World, box aabb, axis int, d float32) float32 {
+	const margin = physicsEpsilon * 2
+	other := 2 - axis
+	a0, a1 := cells(box.min[axis]-1, box.max[axis]+1)
+	o0, o1 := cells(box.min[other], box.max[other])
+	y := int(math.Floor(float64(box.min.Y() - standingProbe + 0.5)))
+	limit := float32(0)
+	for a := a0; a <= a1; a++ {
+		for o := o0; o <= o1; o++ {
+			id := [3]int{}
+			id[axis], id[other], id[1] = a, o, y
+			if !w.Block(BlockID{id[0], id[1], id[2]}).IsObstacle() {
+				continue
+			}
+			// box stays on the block while it overlaps it by more than epsilon
+			c := float32(a)
+			if d > 0 && c+0.5-margin-box.min[axis] > limit {
+				limit = c + 0.5 - margin - box.min[axis]
+			}
+			if d < 0 && c-0.5+margin-box.max[axis] < limit {
+				limit = c - 0.5 + margin - box.max[axis]
+			}
+		}
+	}
+	if abs(limit) > abs(d) {
+		return d
+	}
+	return limit
+}
@@ -0,0 +1,130 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/cLazyZombie/gocraft/gocrafttest"
+	. "github.com/cLazyZombie/gocraft/internal"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPhysicsWorld returns world with a floor at y 200 from -5 to 5 on x and z, and extra blocks
+func newPhysicsWorld(t *testing.T, blocks ...BlockID) *World {
+	store := gocrafttest.NewStoreMock()
+	for x := -5; x <= 5; x++ {
+		for z := -5; z <= 5; z++ {
+			store.Add(BlockID{X: x, Y: 200, Z: z}, 3)
+		}
+	}
+	for _, bid := range blocks {
+		store.Add(bid, 3)
+	}
+	world := NewWorld(store, newTestGenerator(t))
+	for _, x := range []int{-1, 0} {
+		for _, z := range []int{-1, 0} {
+			world.Chunk(ChunkID{X: x, Y: 6, Z: z})
+		}
+	}
+	return world
+}
+
+// standOn returns eye position of physics standing on the floor at x, z
+func standOn(t *testing.T, world *World, p *Physics, x, z float32) mgl32.Vec3 {
+	pos := p.Move(world, mgl32.Vec3{x, 205, z}, mgl32.Vec3{0, -10, 0})
+	assert.True(t, p.OnGround)
+	return pos
+}
+
+func TestPhysics_Fall(t *testing.T) {
+	world := newPhysicsWorld(t)
+	p := NewPhysics()
+
+	pos := p.Move(world, mgl32.Vec3{0, 205, 0}, mgl32.Vec3{0, -1, 0})
+	assert.False(t, p.OnGround)
+	assert.InDelta(t, 204, pos.Y(), 1e-4)
+
+	pos = p.Move(world, pos, mgl32.Vec3{0, -10, 0})
+	assert.True(t, p.OnGround)
+	assert.InDelta(t, 200.5+p.Eye, pos.Y(), 0.01)
+}
+
+func TestPhysics_Wall(t *testing.T) {
+	world := newPhysicsWorld(t, BlockID{X: 2, Y: 201, Z: 0}, BlockID{X: 2, Y: 202, Z: 0})
+	p := NewPhysics()
+	pos := standOn(t, world, p, 0, 0)
+
+	pos = p.Move(world, pos, mgl32.Vec3{3, -0.01, 0})
+	assert.InDelta(t, 1.5-p.Width/2, pos.X(), 0.01)
+	assert.True(t, p.OnGround)
+
+	// slides along the wall
+	pos = p.Move(world, pos, mgl32.Vec3{1, -0.01, 1})
+	assert.InDelta(t, 1.5-p.Width/2, pos.X(), 0.01)
+	assert.InDelta(t, 1, pos.Z(), 1e-4)
+}
+
+func TestPhysics_StepUp(t *testing.T) {
+	ledge := []BlockID{{X: 2, Y: 201, Z: 0}, {X: 3, Y: 201, Z: 0}, {X: 4, Y: 201, Z: 0}}
+	world := newPhysicsWorld(t, ledge...)
+
+	p := NewPhysics()
+	p.StepUp = 1
+	pos := standOn(t, world, p, 0, 0)
+	pos = p.Move(world, pos, mgl32.Vec3{2, -0.01, 0})
+	assert.InDelta(t, 2, pos.X(), 1e-4)
+	assert.InDelta(t, 201.5+p.Eye, pos.Y(), 0.01)
+	assert.True(t, p.OnGround)
+
+	// can't climb without step up, or in the air
+	p.StepUp = 0
+	pos = standOn(t, world, p, 0, 0)
+	pos = p.Move(world, pos, mgl32.Vec3{2, -0.01, 0})
+	assert.InDelta(t, 1.5-p.Width/2, pos.X(), 0.01)
+
+	p.StepUp = 1
+	pos = p.Move(world, mgl32.Vec3{0, 202.2, 0}, mgl32.Vec3{2, 0.01, 0})
+	assert.False(t, p.OnGround)
+	assert.InDelta(t, 1.5-p.Width/2, pos.X(), 0.01)
+}
+
+func TestPhysics_Ceiling(t *testing.T) {
+	world := newPhysicsWorld(t, BlockID{X: 0, Y: 204, Z: 0})
+	p := NewPhysics()
+	pos := standOn(t, world, p, 0, 0)
+
+	pos = p.Move(world, pos, mgl32.Vec3{0, 3, 0})
+	assert.True(t, p.HitCeiling)
+	assert.False(t, p.OnGround)
+	assert.InDelta(t, 203.5-p.Height+p.Eye, pos.Y(), 0.01)
+}
+
+func TestPhysics_Sneak(t *testing.T) {
+	world := newPhysicsWorld(t)
+	p := NewPhysics()
+	p.Sneak = true
+	pos := standOn(t, world, p, 4, 0)
+
+	// stops at the edge of the floor
+	pos = p.Move(world, pos, mgl32.Vec3{3, -0.01, 0})
+	assert.InDelta(t, 5.5+p.Width/2, pos.X(), 0.01)
+	assert.True(t, p.OnGround)
+
+	pos = p.Move(world, pos, mgl32.Vec3{-3, -0.01, 0})
+	assert.InDelta(t, 2.5+p.Width/2, pos.X(), 0.01)
+
+	// walks off without sneak
+	p.Sneak = false
+	pos = p.Move(world, pos, mgl32.Vec3{5, -0.01, 0})
+	assert.InDelta(t, 7.5+p.Width/2, pos.X(), 0.01)
+}
+
+func TestPhysics_Overlaps(t *testing.T) {
+	p := NewPhysics()
+	eye := mgl32.Vec3{0, 202, 0}
+	assert.True(t, p.Overlaps(eye, BlockID{X: 0, Y: 201, Z: 0}))
+	assert.True(t, p.Overlaps(eye, BlockID{X: 0, Y: 202, Z: 0}))
+	assert.False(t, p.Overlaps(eye, BlockID{X: 0, Y: 203, Z: 0}))
+	assert.False(t, p.Overlaps(eye, BlockID{X: 1, Y: 201, Z: 0}))
+	assert.False(t, p.Overlaps(eye, BlockID{X: 0, Y: 200, Z: 0}))
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	"github.com/cLazyZombie/gocraft/internal/mesher"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// player block of the atlas has a face on the front
+	playerBlock     BlockType = 64
+	playerBodyBlock BlockType = 40
+
+	// remote positions arrive about 10 times a second
+	playerLerpMin = 50 * time.Millisecond
+	playerLerpMax = 500 * time.Millisecond
+)
+
+const vertexSize = mesher.VertexSize
+
+// makeBoxData appends a box from min to max with texture tex
+func makeBoxData(vertices []float32, min, max mgl32.Vec3, tex *BlockTexture) []float32 {
+	start := len(vertices)
+	// bottom face of a cube at y 0 is never shown, so make it at y 1
+	show := [...]bool{true, true, true, true, true, true}
+	vertices = makeCubeData(vertices, show, BlockID{0, 1, 0}, tex)
+
+	size := max.Sub(min)
+	center := min.Add(max).Mul(0.5)
+	for i := start; i < len(vertices); i += vertexSize {
+		vertices[i] = vertices[i]*size.X() + center.X()
+		vertices[i+1] = (vertices[i+1]-1)*size.Y() + center.Y()
+		vertices[i+2] = vertices[i+2]*size.Z() + center.Z()
+	}
+	return vertices
+}
+
+// makePlayerData appends player mesh with eye at origin, facing to +z
+func makePlayerData(vertices []float32, head, body *BlockTexture) []float32 {
+	vertices = makeBoxData(vertices, mgl32.Vec3{-0.4, -0.4, -0.4}, mgl32.Vec3{0.4, 0.4, 0.4}, head)
+	vertices = makeBoxData(vertices, mgl32.Vec3{-0.3, -1.5, -0.15}, mgl32.Vec3{0.3, -0.4, 0.15}, body)
+	return vertices
+}
+
+// playerModel returns model matrix of player p, rx is the yaw in radian like Player
+func playerModel(p Player) mgl32.Mat4 {
+	// front of the mesh is +z, look direction is (cos rx, sin rx) on x, z
+	return mgl32.Translate3D(p.Pos.X(), p.Pos.Y(), p.Pos.Z()).Mul4(mgl32.HomogRotate3DY(math.Pi/2 - p.Rx))
+}
+
+// playerTrack : moves a remote player smoothly from its previous to its latest state
+type playerTrack struct {
+	from, to Player
+	start    time.Time
+	duration time.Duration
+}
+
+func (t *playerTrack) at(now time.Time) Player {
+	f := float32(1)
+	if t.duration > 0 && now.Before(t.start.Add(t.duration)) {
+		f = float32(now.Sub(t.start)) / float32(t.duration)
+	}
+	p := t.to
+	p.Pos = t.from.Pos.Add(t.to.Pos.Sub(t.from.Pos).Mul(f))
+	p.Rx = lerpAngle(t.from.Rx, t.to.Rx, f)
+	p.Ry = lerpAngle(t.from.Ry, t.to.Ry, f)
+	return p
+}
+
+// lerpAngle interpolates radian angles the short way round
+func lerpAngle(a, b, f float32) float32 {
+	d := float32(math.Remainder(float64(b-a), 2*math.Pi))
+	return a + d*f
+}
+
+// PlayerTracker : interpolates remote players between position updates
+type PlayerTracker struct {
+	tracks map[int]*playerTrack
+}
+
+func NewPlayerTracker() *PlayerTracker {
+	return &PlayerTracker{
+		tracks: make(map[int]*playerTrack),
+	}
+}
+
+// Update sets latest states of players at now, players not in the list are removed
+func (t *PlayerTracker) Update(players []Player, now time.Time) {
+	seen := make(map[int]bool, len(players))
+	for _, p := range players {
+		seen[p.ID] = true
+		track, ok := t.tracks[p.ID]
+		if !ok {
+			t.tracks[p.ID] = &playerTrack{from: p, to: p, start: now}
+			continue
+		}
+		if p == track.to {
+			continue
+		}
+		// move from where it is now, taking as long as the last update took
+		duration := now.Sub(track.start)
+		if duration < playerLerpMin {
+			duration = playerLerpMin
+		}
+		if duration > playerLerpMax {
+			duration = playerLerpMax
+		}
+		track.from = track.at(now)
+		track.to = p
+		track.start = now
+		track.duration = duration
+	}
+	for id := range t.tracks {
+		if !seen[id] {
+			delete(t.tracks, id)
+		}
+	}
+}
+
+// Players returns interpolated players at now
+func (t *PlayerTracker) Players(now time.Time) []Player {
+	players := make([]Player, 0, len(t.tracks))
+	for _, track := range t.tracks {
+		players = append(players, track.at(now))
+	}
+	return players
+}
@@ -0,0 +1,75 @@
+//go:build !headless
+// +build !headless
+
+package internal
+
+import (
+	"time"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// PlayerRender : draws remote players of the game client
+type PlayerRender struct {
+	game    *Game
+	shader  *glhf.Shader
+	mesh    *Mesh
+	tracker *PlayerTracker
+}
+
+func NewPlayerRender(game *Game) (*PlayerRender, error) {
+	r := &PlayerRender{
+		game:    game,
+		tracker: NewPlayerTracker(),
+	}
+	var err error
+	mainthread.Call(func() {
+		r.shader, err = glhf.NewShader(glhf.AttrFormat{
+			glhf.Attr{Name: "pos", Type: glhf.Vec3},
+			glhf.Attr{Name: "tex", Type: glhf.Vec2},
+			glhf.Attr{Name: "normal", Type: glhf.Vec3},
+			glhf.Attr{Name: "ao", Type: glhf.Float},
+			glhf.Attr{Name: "skylight", Type: glhf.Float},
+			glhf.Attr{Name: "blocklight", Type: glhf.Float},
+		}, glhf.AttrFormat{
+			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
+		}, playerVertexSource, playerFragmentSource)
+		if err != nil {
+			return
+		}
+		r.mesh = NewMesh(r.shader, makePlayerData(nil, playerBlock.Texture(), playerBodyBlock.Texture()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Draw draws players, call on mainthread
+func (r *PlayerRender) Draw() {
+	client := r.game.client
+	if client == nil {
+		return
+	}
+	now := time.Now()
+	r.tracker.Update(client.Players(), now)
+	players := r.tracker.Players(now)
+	if len(players) == 0 {
+		return
+	}
+
+	width, height := r.game.win.GetSize()
+	projection := mgl32.Perspective(radian(45), float32(width)/float32(height), 0.01, ChunkWidth*float32(*renderRadius))
+	mat := projection.Mul4(r.game.camera.Matrix())
+
+	r.shader.Begin()
+	r.game.blockRender.texture.Begin()
+	for _, p := range players {
+		r.shader.SetUniformAttr(0, mat.Mul4(playerModel(p)))
+		r.mesh.Draw()
+	}
+	r.game.blockRender.texture.End()
+	r.shader.End()
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakePlayerData(t *testing.T) {
+	head := makeBlockTexture([]int{226, 224, 241, 209, 227, 225})
+	body := makeBlockTexture([]int{0})
+	vertices := makePlayerData(nil, head, body)
+	// two boxes of 6 faces
+	assert.Equal(t, 2*6*6*vertexSize, len(vertices))
+
+	min := mgl32.Vec3{100, 100, 100}
+	max := mgl32.Vec3{-100, -100, -100}
+	for i := 0; i < len(vertices); i += vertexSize {
+		for j := 0; j < 3; j++ {
+			if v := vertices[i+j]; v < min[j] {
+				min[j] = v
+			}
+			if v := vertices[i+j]; v > max[j] {
+				max[j] = v
+			}
+		}
+	}
+	assert.Equal(t, mgl32.Vec3{-0.4, -1.5, -0.4}, min)
+	assert.Equal(t, mgl32.Vec3{0.4, 0.4, 0.4}, max)
+
+	// face of the head is in front
+	front := 6 * 4 * vertexSize
+	assert.Equal(t, float32(0.4), vertices[front+2])
+	assert.Equal(t, head.Front[0][0], vertices[front+3])
+}
+
+func TestPlayerModel(t *testing.T) {
+	p := Player{Pos: mgl32.Vec3{1, 2, 3}}
+	front := playerModel(p).Mul4x1(mgl32.Vec4{0, 0, 1, 1}).Vec3()
+	assert.InDelta(t, 2, front.X(), 1e-5)
+	assert.InDelta(t, 3, front.Z(), 1e-5)
+
+	p.Rx = math.Pi / 2
+	front = playerModel(p).Mul4x1(mgl32.Vec4{0, 0, 1, 1}).Vec3()
+	assert.InDelta(t, 1, front.X(), 1e-5)
+	assert.InDelta(t, 4, front.Z(), 1e-5)
+}
+
+func TestPlayerTracker(t *testing.T) {
+	tracker := NewPlayerTracker()
+	t0 := time.Now()
+	ms := func(n int) time.Time {
+		return t0.Add(time.Duration(n) * time.Millisecond)
+	}
+
+	tracker.Update([]Player{{ID: 1, Name: "a", Rx: 3}}, t0)
+	assert.Equal(t, []Player{{ID: 1, Name: "a", Rx: 3}}, tracker.Players(t0))
+
+	// moves in the time the update took
+	tracker.Update([]Player{{ID: 1, Name: "a", Pos: mgl32.Vec3{10, 0, 0}, Rx: -3}}, ms(100))
+	assert.Equal(t, mgl32.Vec3{0, 0, 0}, tracker.Players(ms(100))[0].Pos)
+	p := tracker.Players(ms(150))[0]
+	assert.InDelta(t, 5, p.Pos.X(), 1e-4)
+	// turns the short way
+	assert.InDelta(t, math.Pi, math.Abs(float64(p.Rx)), 1e-4)
+	assert.Equal(t, mgl32.Vec3{10, 0, 0}, tracker.Players(ms(300))[0].Pos)
+
+	// a new update starts from where the player is drawn
+	tracker.Update([]Player{{ID: 1, Pos: mgl32.Vec3{20, 0, 0}}}, ms(150))
+	assert.InDelta(t, 5, tracker.Players(ms(150))[0].Pos.X(), 1e-4)
+
+	tracker.Update([]Player{{ID: 2}}, ms(200))
+	players := tracker.Players(ms(200))
+	assert.Equal(t, 1, len(players))
+	assert.Equal(t, 2, players[0].ID)
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// RayHit : block hit by a ray
+type RayHit struct {
+	Block BlockID
+	// Normal of the hit face, zero when the ray starts inside the block
+	Normal BlockID
+	// Point where the ray enters the block
+	Point mgl32.Vec3
+	Dist  float32
+}
+
+// Adjacent returns the block on the other side of the hit face
+func (h *RayHit) Adjacent() BlockID {
+	return BlockID{h.Block.X + h.Normal.X, h.Block.Y + h.Normal.Y, h.Block.Z + h.Normal.Z}
+}
+
+// Raycast walks blocks along the ray from pos to dir, and returns the first block within maxDist
+// accepted by filter, nil filter accepts all non air blocks.
+// Only loaded chunks are tested.
+func (w *World) Raycast(pos, dir mgl32.Vec3, maxDist float32, filter func(BlockType) bool) *RayHit {
+	if dir.Len() == 0 {
+		return nil
+	}
+	dir = dir.Normalize()
+
+	// blocks are centered on integer coordinates, so shift to make block borders integer
+	var (
+		origin = pos.Add(mgl32.Vec3{0.5, 0.5, 0.5})
+		cell   [3]int
+		step   [3]int
+		next   [3]float32 // distance to next border on each axis
+		delta  [3]float32 // distance between borders on each axis
+		normal [3]int
+		dist   float32
+	)
+	for i := 0; i < 3; i++ {
+		f := float32(math.Floor(float64(origin[i])))
+		cell[i] = int(f)
+		switch {
+		case dir[i] > 0:
+			step[i] = 1
+			next[i] = (f + 1 - origin[i]) / dir[i]
+			delta[i] = 1 / dir[i]
+		case dir[i] < 0:
+			step[i] = -1
+			next[i] = (origin[i] - f) / -dir[i]
+			delta[i] = -1 / dir[i]
+		default:
+			next[i] = math.MaxFloat32
+			delta[i] = math.MaxFloat32
+		}
+	}
+
+	for dist <= maxDist {
+		bid := BlockID{cell[0], cell[1], cell[2]}
+		tp := w.Block(bid)
+		if tp != 0 && (filter == nil || filter(tp)) {
+			return &RayHit{
+				Block:  bid,
+				Normal: BlockID{normal[0], normal[1], normal[2]},
+				Point:  pos.Add(dir.Mul(dist)),
+				Dist:   dist,
+			}
+		}
+
+		axis := 0
+		if next[1] < next[axis] {
+			axis = 1
+		}
+		if next[2] < next[axis] {
+			axis = 2
+		}
+		dist = next[axis]
+		next[axis] += delta[axis]
+		cell[axis] += step[axis]
+		normal = [3]int{}
+		normal[axis] = -step[axis]
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/cLazyZombie/gocraft/gocrafttest"
+	. "github.com/cLazyZombie/gocraft/internal"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRaycastWorld returns world with blocks in the sky, where classic terrain is empty
+func newRaycastWorld(t *testing.T, blocks map[BlockID]BlockType) *World {
+	store := gocrafttest.NewStoreMock()
+	for bid, w := range blocks {
+		store.Add(bid, w)
+	}
+	world := NewWorld(store, newTestGenerator(t))
+	world.Chunk(BlockID{X: 0, Y: 200, Z: 0}.ChunkID())
+	return world
+}
+
+func TestWorld_Raycast(t *testing.T) {
+	world := newRaycastWorld(t, map[BlockID]BlockType{
+		{X: 5, Y: 200, Z: 0}: 3,
+		{X: 0, Y: 195, Z: 0}: 3,
+	})
+
+	hit := world.Raycast(mgl32.Vec3{0.2, 200, 0}, mgl32.Vec3{2, 0, 0}, 8, nil)
+	if assert.NotNil(t, hit) {
+		assert.Equal(t, BlockID{X: 5, Y: 200, Z: 0}, hit.Block)
+		assert.Equal(t, BlockID{X: -1, Y: 0, Z: 0}, hit.Normal)
+		assert.Equal(t, BlockID{X: 4, Y: 200, Z: 0}, hit.Adjacent())
+		assert.InDelta(t, 4.3, hit.Dist, 1e-4)
+		assert.InDelta(t, 4.5, hit.Point.X(), 1e-4)
+	}
+
+	hit = world.Raycast(mgl32.Vec3{0, 200, 0}, mgl32.Vec3{0, -1, 0}, 8, nil)
+	if assert.NotNil(t, hit) {
+		assert.Equal(t, BlockID{X: 0, Y: 195, Z: 0}, hit.Block)
+		assert.Equal(t, BlockID{X: 0, Y: 196, Z: 0}, hit.Adjacent())
+		assert.InDelta(t, 4.5, hit.Dist, 1e-4)
+	}
+
+	// out of reach
+	assert.Nil(t, world.Raycast(mgl32.Vec3{0.2, 200, 0}, mgl32.Vec3{1, 0, 0}, 4, nil))
+	assert.Nil(t, world.Raycast(mgl32.Vec3{0, 200, 0}, mgl32.Vec3{0, 1, 0}, 8, nil))
+}
+
+func TestWorld_RaycastCorner(t *testing.T) {
+	// the ray only clips the corner of the first block
+	world := newRaycastWorld(t, map[BlockID]BlockType{
+		{X: 1, Y: 200, Z: 0}: 3,
+		{X: 3, Y: 200, Z: 3}: 3,
+	})
+	hit := world.Raycast(mgl32.Vec3{0.02, 200, 0}, mgl32.Vec3{1, 0, 1}, 8, nil)
+	if assert.NotNil(t, hit) {
+		assert.Equal(t, BlockID{X: 1, Y: 200, Z: 0}, hit.Block)
+		assert.Equal(t, BlockID{X: -1, Y: 0, Z: 0}, hit.Normal)
+	}
+}
+
+func TestWorld_RaycastFilter(t *testing.T) {
+	world := newRaycastWorld(t, map[BlockID]BlockType{
+		{X: 2, Y: 200, Z: 0}: 17,
+		{X: 4, Y: 200, Z: 0}: 3,
+	})
+	pos, dir := mgl32.Vec3{0, 200, 0}, mgl32.Vec3{1, 0, 0}
+
+	hit := world.Raycast(pos, dir, 8, nil)
+	if assert.NotNil(t, hit) {
+		assert.Equal(t, BlockID{X: 2, Y: 200, Z: 0}, hit.Block)
+	}
+	hit = world.Raycast(pos, dir, 8, func(w BlockType) bool { return !w.IsPlant() })
+	if assert.NotNil(t, hit) {
+		assert.Equal(t, BlockID{X: 4, Y: 200, Z: 0}, hit.Block)
+	}
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/cLazyZombie/gocraft/internal/mesher"
+)
+
+var (
+	blocksPath = flag.String("blocks", "blocks.json", "block definitions file")
+
+	// registry is the default until LoadBlocks, so only air is known
+	registry = NewBlockRegistry()
+)
+
+// BlockShape : how a block is rendered
+type BlockShape string
+
+const (
+	ShapeCube  BlockShape = "cube"
+	ShapePlant BlockShape = "plant"
+	ShapeNone  BlockShape = "none"
+)
+
+var meshShapes = map[BlockShape]mesher.Shape{
+	ShapeCube:  mesher.ShapeCube,
+	ShapePlant: mesher.ShapePlant,
+	ShapeNone:  mesher.ShapeNone,
+}
+
+// BlockDef : definition of a block type
+type BlockDef struct {
+	ID   BlockType `json:"id"`
+	Name string    `json:"name"`
+	// Tiles of texture on left, right, top, bottom, front, back, or one tile for all faces
+	Tiles       []int      `json:"tiles"`
+	Shape       BlockShape `json:"shape"`
+	Transparent bool       `json:"transparent"`
+	// Translucent blocks are blended by the alpha of their texture
+	Translucent bool `json:"translucent"`
+	Collide     bool `json:"collide"`
+	Placeable   bool `json:"placeable"`
+	// Light : level of light the block emits, 0 to 15
+	Light int `json:"light"`
+
+	texture *BlockTexture
+	mesh    *mesher.Block
+}
+
+// prepare builds texture and mesher block of d
+func (d *BlockDef) prepare() {
+	d.texture = makeBlockTexture(d.Tiles)
+	d.mesh = &mesher.Block{
+		Shape:       meshShapes[d.Shape],
+		Transparent: d.Transparent,
+		Pass:        mesher.Opaque,
+		Faces:       *d.texture.faces(),
+	}
+	switch {
+	case d.Translucent:
+		d.mesh.Pass = mesher.Translucent
+	case d.Transparent:
+		d.mesh.Pass = mesher.Cutout
+	}
+}
+
+// UnmarshalJSON fills unset fields with defaults of a solid cube
+func (d *BlockDef) UnmarshalJSON(b []byte) error {
+	type plain BlockDef
+	p := plain{Shape: ShapeCube, Collide: true, Placeable: true}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*d = BlockDef(p)
+	return nil
+}
+
+var (
+	airDef = &BlockDef{Name: "air", Tiles: []int{0}, Shape: ShapeNone, Transparent: true}
+	// blocks not in registry are solid cubes
+	unknownDef = &BlockDef{Name: "unknown", Tiles: []int{0}, Shape: ShapeCube, Collide: true}
+)
+
+func init() {
+	for _, d := range []*BlockDef{airDef, unknownDef} {
+		d.prepare()
+	}
+}
+
+// BlockRegistry : definitions of all block types
+type BlockRegistry struct {
+	defs  []*BlockDef // indexed by BlockType
+	items []BlockType
+}
+
+func NewBlockRegistry() *BlockRegistry {
+	return &BlockRegistry{
+		defs: []*BlockDef{airDef},
+	}
+}
+
+// Add adds block definition d
+func (r *BlockRegistry) Add(d BlockDef) error {
+	if d.ID == 0 {
+		return fmt.Errorf("block 0 is air")
+	}
+	if int(d.ID) < len(r.defs) && r.defs[d.ID] != nil {
+		return fmt.Errorf("block %d is defined twice", d.ID)
+	}
+	if len(d.Tiles) != 1 && len(d.Tiles) != 6 {
+		return fmt.Errorf("block %d has %d tiles, need 1 or 6", d.ID, len(d.Tiles))
+	}
+	for _, tile := range d.Tiles {
+		if tile < 0 || tile >= textureColums*textureColums {
+			return fmt.Errorf("block %d has bad tile %d", d.ID, tile)
+		}
+	}
+	if d.Translucent && !d.Transparent {
+		return fmt.Errorf("block %d is translucent but not transparent", d.ID)
+	}
+	if d.Light < 0 || d.Light > maxLight {
+		return fmt.Errorf("block %d has bad light %d", d.ID, d.Light)
+	}
+	switch d.Shape {
+	case ShapeCube, ShapePlant, ShapeNone:
+	default:
+		return fmt.Errorf("block %d has unknown shape %q", d.ID, d.Shape)
+	}
+
+	d.prepare()
+	for int(d.ID) >= len(r.defs) {
+		r.defs = append(r.defs, nil)
+	}
+	r.defs[d.ID] = &d
+	if d.Placeable {
+		r.items = append(r.items, d.ID)
+		sort.Slice(r.items, func(i, j int) bool { return r.items[i] < r.items[j] })
+	}
+	return nil
+}
+
+// Def returns definition of block w
+func (r *BlockRegistry) Def(w BlockType) *BlockDef {
+	if int(w) < len(r.defs) && r.defs[w] != nil {
+		return r.defs[w]
+	}
+	return unknownDef
+}
+
+// Lookup returns block named name, air is block 0
+func (r *BlockRegistry) Lookup(name string) (BlockType, bool) {
+	for w, d := range r.defs {
+		if d != nil && d.Name == name {
+			return BlockType(w), true
+		}
+	}
+	return 0, false
+}
+
+// Items returns placeable blocks in order of id
+func (r *BlockRegistry) Items() []BlockType {
+	return r.items
+}
+
+// ReadBlockRegistry reads block definitions from json file path
+func ReadBlockRegistry(path string) (*BlockRegistry, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Blocks []BlockDef `json:"blocks"`
+	}
+	err = json.Unmarshal(buf, &file)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %s", path, err)
+	}
+
+	r := NewBlockRegistry()
+	for _, d := range file.Blocks {
+		err = r.Add(d)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	if len(r.items) == 0 {
+		return nil, fmt.Errorf("%s: no placeable block", path)
+	}
+	return r, nil
+}
+
+// LoadBlocks loads block definitions from -blocks file
+func LoadBlocks() error {
+	r, err := ReadBlockRegistry(*blocksPath)
+	if err != nil {
+		return err
+	}
+	registry = r
+	return nil
+}
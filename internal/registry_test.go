@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBlockRegistry(t *testing.T) {
+	r, err := ReadBlockRegistry("../blocks.json")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	grass := r.Def(1)
+	assert.Equal(t, "grass", grass.Name)
+	assert.Equal(t, ShapeCube, grass.Shape)
+	assert.True(t, grass.Collide)
+	assert.False(t, grass.Transparent)
+	assert.Equal(t, MakeFaceTexture(32), grass.texture.Up)
+	assert.Equal(t, MakeFaceTexture(16), grass.texture.Left)
+	assert.Equal(t, MakeFaceTexture(1), r.Def(2).texture.Down)
+
+	for w := BlockType(17); w <= 31; w++ {
+		assert.Equal(t, ShapePlant, r.Def(w).Shape, "block %d", w)
+		assert.True(t, r.Def(w).Transparent)
+		assert.False(t, r.Def(w).Collide)
+	}
+	assert.True(t, r.Def(10).Transparent)
+	assert.True(t, r.Def(15).Transparent)
+	water := r.Def(65)
+	assert.Equal(t, "water", water.Name)
+	assert.True(t, water.Transparent)
+	assert.True(t, water.Translucent)
+	assert.False(t, water.Collide)
+
+	// air, and blocks not in file
+	assert.Equal(t, ShapeNone, r.Def(0).Shape)
+	assert.False(t, r.Def(0).Collide)
+	assert.Equal(t, ShapeCube, r.Def(100).Shape)
+	assert.True(t, r.Def(100).Collide)
+	assert.False(t, r.Def(100).Transparent)
+
+	items := r.Items()
+	assert.Equal(t, 57, len(items))
+	assert.Equal(t, BlockType(1), items[0])
+	assert.Equal(t, BlockType(23), items[22])
+	assert.Equal(t, BlockType(32), items[23])
+	assert.Equal(t, BlockType(64), items[55])
+	assert.Equal(t, BlockType(65), items[56])
+}
+
+func TestReadBlockRegistry_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, s := range []string{
+		`{"blocks": [{"id": 1, "tiles": [1]}, {"id": 1, "tiles": [2]}]}`,
+		`{"blocks": [{"id": 0, "tiles": [1]}]}`,
+		`{"blocks": [{"id": 1, "tiles": [1, 2]}]}`,
+		`{"blocks": [{"id": 1, "tiles": [256]}]}`,
+		`{"blocks": [{"id": 1, "tiles": [1], "shape": "stairs"}]}`,
+		`{"blocks": [{"id": 1, "tiles": [1], "placeable": false}]}`,
+		`{"blocks": [`,
+	} {
+		path := filepath.Join(dir, "blocks.json")
+		assert.Nil(t, ioutil.WriteFile(path, []byte(s), 0644))
+		_, err := ReadBlockRegistry(path)
+		assert.NotNil(t, err, s)
+	}
+
+	_, err = ReadBlockRegistry(filepath.Join(dir, "none.json"))
+	assert.NotNil(t, err)
+}
+
+func TestBlockRegistry_Custom(t *testing.T) {
+	r := NewBlockRegistry()
+	assert.Nil(t, r.Add(BlockDef{ID: 200, Name: "barrier", Tiles: []int{0}, Shape: ShapeNone, Collide: true, Placeable: true}))
+	assert.Nil(t, r.Add(BlockDef{ID: 100, Name: "marble", Tiles: []int{11}, Shape: ShapeCube, Collide: true, Placeable: true}))
+	assert.Equal(t, []BlockType{100, 200}, r.Items())
+	assert.Equal(t, ShapeNone, r.Def(200).Shape)
+	assert.Equal(t, unknownDef, r.Def(150))
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"sync"
+)
+
+// RemoteStore : IStore of a world on a Craft server.
+// Blocks saved on server are overrides of generated terrain, like blocks in Store.
+type RemoteStore struct {
+	client *Client
+
+	mutex    sync.Mutex
+	columns  map[[2]int]map[BlockID]BlockType
+	onChange func(id BlockID, w BlockType)
+}
+
+func NewRemoteStore(client *Client) *RemoteStore {
+	s := &RemoteStore{
+		client:  client,
+		columns: make(map[[2]int]map[BlockID]BlockType),
+	}
+	client.OnBlock(s.onBlock)
+	return s
+}
+
+// OnChange sets f to be called with blocks changed by other players
+func (s *RemoteStore) OnChange(f func(id BlockID, w BlockType)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onChange = f
+}
+
+func (s *RemoteStore) onBlock(id BlockID, w BlockType) {
+	cid := id.ChunkID()
+	s.mutex.Lock()
+	if column, ok := s.columns[[2]int{cid.X, cid.Z}]; ok {
+		column[id] = w
+	}
+	f := s.onChange
+	s.mutex.Unlock()
+
+	if f != nil {
+		f(id, w)
+	}
+}
+
+// column returns blocks of chunk column p, q, fetching them from server at first time
+func (s *RemoteStore) column(p, q int) (map[BlockID]BlockType, error) {
+	key := [2]int{p, q}
+	s.mutex.Lock()
+	column, ok := s.columns[key]
+	s.mutex.Unlock()
+	if ok {
+		return column, nil
+	}
+
+	blocks, err := s.client.FetchColumn(p, q)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// an other chunk of the column may have fetched it already
+	if column, ok := s.columns[key]; ok {
+		return column, nil
+	}
+	s.columns[key] = blocks
+	return blocks, nil
+}
+
+func (s *RemoteStore) RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error {
+	column, err := s.column(id.X, id.Z)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for bid, w := range column {
+		if bid.ChunkID() == id {
+			f(bid, w)
+		}
+	}
+	return nil
+}
+
+func (s *RemoteStore) UpdateBlock(id BlockID, w BlockType) error {
+	cid := id.ChunkID()
+	s.mutex.Lock()
+	if column, ok := s.columns[[2]int{cid.X, cid.Z}]; ok {
+		column[id] = w
+	}
+	s.mutex.Unlock()
+	return s.client.UpdateBlock(id, w)
+}
+
+// UpdateBlocks sends edits block by block, Craft servers have no batch update
+func (s *RemoteStore) UpdateBlocks(edits map[ChunkID]map[BlockID]BlockType) error {
+	for _, blocks := range edits {
+		for id, w := range blocks {
+			if err := s.UpdateBlock(id, w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,3 +1,6 @@
+//go:build !headless
+// +build !headless
+
 package internal
 
 import (
@@ -6,10 +9,12 @@ import (
 	"image/draw"
 	"log"
 	"os"
+	"runtime"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/cLazyZombie/gocraft/internal/mesher"
 	"github.com/faiface/glhf"
 	"github.com/faiface/mainthread"
 	"github.com/go-gl/gl/v3.3-core/gl"
@@ -17,8 +22,7 @@ import (
 )
 
 var (
-	texturePath  = flag.String("t", "texture.png", "texture file")
-	renderRadius = flag.Int("r", 6, "render radius")
+	meshWorkers = flag.Int("meshers", runtime.NumCPU(), "goroutines building chunk meshes")
 )
 
 func loadImage(fname string) ([]uint8, image.Rectangle, error) {
@@ -41,13 +45,16 @@ type BlockRender struct {
 	texture *glhf.Texture
 	game    *Game
 
-	facePool *sync.Pool
+	facePool   *sync.Pool
+	bucketPool *sync.Pool
+	packPool   *sync.Pool
+	indices    *quadIndices
 
-	meshcache sync.Map //map[Vec3]*Mesh
+	meshcache sync.Map //map[ChunkID]*ChunkMesh
 
 	stat Stat
 
-	item *Mesh
+	item *PackedMesh
 }
 
 func NewBlockRender(game *Game) (*BlockRender, error) {
@@ -60,18 +67,20 @@ func NewBlockRender(game *Game) (*BlockRender, error) {
 	}
 
 	r := &BlockRender{
-		game: game,
+		game:    game,
+		indices: new(quadIndices),
 	}
 
 	mainthread.Call(func() {
+		// four bytes each, see mesher.Vertex
 		r.shader, err = glhf.NewShader(glhf.AttrFormat{
-			glhf.Attr{Name: "pos", Type: glhf.Vec3},
-			glhf.Attr{Name: "tex", Type: glhf.Vec2},
-			glhf.Attr{Name: "normal", Type: glhf.Vec3},
+			glhf.Attr{Name: "position", Type: glhf.Int},
+			glhf.Attr{Name: "material", Type: glhf.Int},
 		}, glhf.AttrFormat{
 			glhf.Attr{Name: "matrix", Type: glhf.Mat4},
 			glhf.Attr{Name: "camera", Type: glhf.Vec3},
 			glhf.Attr{Name: "fogdis", Type: glhf.Float},
+			glhf.Attr{Name: "chunk", Type: glhf.Vec3},
 		}, blockVertexSource, blockFragmentSource)
 
 		if err != nil {
@@ -85,47 +94,60 @@ func NewBlockRender(game *Game) (*BlockRender, error) {
 	}
 	r.facePool = &sync.Pool{
 		New: func() interface{} {
-			return make([]float32, 0, r.shader.VertexFormat().Size()/4*6*6)
+			return make([]float32, 0, mesher.VertexSize*6*6)
+		},
+	}
+	r.packPool = &sync.Pool{
+		New: func() interface{} {
+			return []byte(nil)
+		},
+	}
+	r.bucketPool = &sync.Pool{
+		New: func() interface{} {
+			return new(mesher.Buckets)
 		},
 	}
 
 	return r, nil
 }
 
-func (r *BlockRender) makeChunkMesh(c *Chunk, onmainthread bool) *Mesh {
-	facedata := r.facePool.Get().([]float32)
-	defer r.facePool.Put(facedata[:0])
-
-	c.RangeBlocks(func(id BlockID, w BlockType) {
-		if w == 0 {
-			log.Panicf("unexpect 0 item type on %v", id)
-		}
-		show := [...]bool{
-			r.game.world.Block(id.Left()).IsTransparent(),
-			r.game.world.Block(id.Right()).IsTransparent(),
-			r.game.world.Block(id.Up()).IsTransparent(),
-			r.game.world.Block(id.Down()).IsTransparent(),
-			r.game.world.Block(id.Front()).IsTransparent(),
-			r.game.world.Block(id.Back()).IsTransparent(),
+func (r *BlockRender) makeChunkMesh(c *Chunk, onmainthread bool) *ChunkMesh {
+	buckets := r.bucketPool.Get().(*mesher.Buckets)
+	defer func() {
+		buckets.Reset()
+		r.bucketPool.Put(buckets)
+	}()
+
+	s := r.game.world.snapshot(c)
+	meshSnapshot(buckets, s)
+	log.Printf("chunk faces:%d", buckets.Faces())
+
+	packed := r.packPool.Get().([]byte)
+	defer func() {
+		r.packPool.Put(packed[:0])
+	}()
+	var ends [mesher.Passes]int
+	for pass, vertices := range buckets {
+		packed = mesher.PackQuads(packed, vertices, s.X, s.Y, s.Z)
+		ends[pass] = len(packed)
+	}
+
+	mesh := &ChunkMesh{
+		Id:      c.ID(),
+		Version: c.Version,
+	}
+	upload := func() {
+		start := 0
+		for pass, end := range ends {
+			mesh.passes[pass] = NewPackedMesh(r.shader, r.indices, packed[start:end])
+			start = end
 		}
-		if r.game.world.Block(id).IsPlant() {
-			facedata = makePlantData(facedata, show, id, tex.Texture(w))
-		} else {
-			facedata = makeCubeData(facedata, show, id, tex.Texture(w))
-		}
-	})
-	n := len(facedata) / (r.shader.VertexFormat().Size() / 4)
-	log.Printf("chunk faces:%d", n/6)
-	var mesh *Mesh
+	}
 	if onmainthread {
-		mesh = NewMesh(r.shader, facedata)
+		upload()
 	} else {
-		mainthread.Call(func() {
-			mesh = NewMesh(r.shader, facedata)
-		})
+		mainthread.Call(upload)
 	}
-	mesh.Version = c.Version
-	mesh.Id = c.ID()
 	return mesh
 }
 
@@ -133,15 +155,16 @@ func (r *BlockRender) makeChunkMesh(c *Chunk, onmainthread bool) *Mesh {
 func (r *BlockRender) UpdateItem(w BlockType) {
 	vertices := r.facePool.Get().([]float32)
 	defer r.facePool.Put(vertices[:0])
-	texture := tex.Texture(w)
+	texture := w.Texture()
 	show := [...]bool{true, true, true, true, true, true}
 	pos := BlockID{0, 0, 0}
-	if w.IsPlant() {
-		vertices = makePlantData(vertices, show, pos, texture)
-	} else {
+	switch w.Shape() {
+	case ShapePlant:
+		vertices = makePlantData(vertices, pos, texture)
+	case ShapeCube:
 		vertices = makeCubeData(vertices, show, pos, texture)
 	}
-	item := NewMesh(r.shader, vertices)
+	item := NewPackedMesh(r.shader, r.indices, mesher.PackQuads(nil, vertices, 0, 0, 0))
 	if r.item != nil {
 		r.item.Release()
 	}
@@ -277,7 +300,7 @@ func (r *BlockRender) updateMeshCache() {
 			added = append(added, id)
 		} else {
 			chunk := r.game.world.Chunk(id)
-			if chunk.Version != mesh.(*Mesh).Version {
+			if chunk.Version != mesh.(*ChunkMesh).Version {
 				log.Printf("update cache %v", id)
 				added = append(added, id)
 				removed = append(removed, id)
@@ -285,19 +308,15 @@ func (r *BlockRender) updateMeshCache() {
 		}
 	}
 
-	var removedMesh []*Mesh
+	var removedMesh []*ChunkMesh
 	for _, id := range removed {
 		log.Printf("remove cache %v", id)
 		mesh, _ := r.meshcache.Load(id)
 		r.meshcache.Delete(id)
-		removedMesh = append(removedMesh, mesh.(*Mesh))
+		removedMesh = append(removedMesh, mesh.(*ChunkMesh))
 	}
 
-	newChunks := r.game.world.Chunks(added)
-	for _, c := range newChunks {
-		log.Printf("add cache %v", c.ID())
-		r.meshcache.Store(c.ID(), r.makeChunkMesh(c, false))
-	}
+	r.buildMeshes(r.game.world.Chunks(added))
 
 	mainthread.CallNonBlock(func() {
 		for _, mesh := range removedMesh {
@@ -307,15 +326,37 @@ func (r *BlockRender) updateMeshCache() {
 
 }
 
+// buildMeshes makes meshes of chunks on at most meshWorkers goroutines,
+// only the upload of vertices runs on mainthread
+func (r *BlockRender) buildMeshes(chunks []*Chunk) {
+	jobs := make(chan *Chunk)
+	var wg sync.WaitGroup
+	for i := 0; i < *meshWorkers && i < len(chunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				log.Printf("add cache %v", c.ID())
+				r.meshcache.Store(c.ID(), r.makeChunkMesh(c, false))
+			}
+		}()
+	}
+	for _, c := range chunks {
+		jobs <- c
+	}
+	close(jobs)
+	wg.Wait()
+}
+
 // called on mainthread
 func (r *BlockRender) forceChunks(ids []ChunkID) {
-	var removedMesh []*Mesh
+	var removedMesh []*ChunkMesh
 	for _, id := range ids {
 		chunk := r.game.world.Chunk(id)
 		imesh, ok := r.meshcache.Load(id)
-		var mesh *Mesh
+		var mesh *ChunkMesh
 		if ok {
-			mesh = imesh.(*Mesh)
+			mesh = imesh.(*ChunkMesh)
 		}
 		if ok && chunk.Version == mesh.Version {
 			continue
@@ -367,16 +408,46 @@ func (r *BlockRender) drawChunks() {
 
 	planes := frustumPlanes(&mat)
 	r.stat = Stat{}
+	translucent := make(map[ChunkID]*ChunkMesh)
 	r.meshcache.Range(func(k, v interface{}) bool {
-		id, mesh := k.(ChunkID), v.(*Mesh)
+		id, mesh := k.(ChunkID), v.(*ChunkMesh)
 		r.stat.CacheChunks++
 		if isChunkVisiable(planes, id) {
 			r.stat.RendingChunks++
 			r.stat.Faces += mesh.Faces()
-			mesh.Draw()
+			r.shader.SetUniformAttr(3, chunkOrigin(id))
+			mesh.passes[mesher.Opaque].Draw()
+			mesh.passes[mesher.Cutout].Draw()
+			if mesh.passes[mesher.Translucent].Faces() > 0 {
+				translucent[id] = mesh
+			}
 		}
 		return true
 	})
+	r.drawTranslucent(translucent)
+}
+
+// drawTranslucent blends translucent faces of chunks over what is drawn, farthest chunks first
+func (r *BlockRender) drawTranslucent(meshes map[ChunkID]*ChunkMesh) {
+	if len(meshes) == 0 {
+		return
+	}
+	ids := make([]ChunkID, 0, len(meshes))
+	for id := range meshes {
+		ids = append(ids, id)
+	}
+	sortBackToFront(ids, r.game.camera.Pos())
+
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	// translucent faces do not hide each other
+	gl.DepthMask(false)
+	for _, id := range ids {
+		r.shader.SetUniformAttr(3, chunkOrigin(id))
+		meshes[id].passes[mesher.Translucent].Draw()
+	}
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
 }
 
 func (r *BlockRender) drawItem() {
@@ -393,6 +464,7 @@ func (r *BlockRender) drawItem() {
 	r.shader.SetUniformAttr(0, mat)
 	r.shader.SetUniformAttr(1, mgl32.Vec3{0, 0, 0})
 	r.shader.SetUniformAttr(2, float32(*renderRadius)*ChunkWidth)
+	r.shader.SetUniformAttr(3, mgl32.Vec3{0, 0, 0})
 	r.item.Draw()
 }
 
@@ -417,11 +489,30 @@ func (r *BlockRender) Stat() Stat {
 	return r.stat
 }
 
+// ChunkMesh : meshes of a chunk, one for each render pass
+type ChunkMesh struct {
+	passes  [mesher.Passes]*PackedMesh
+	Id      ChunkID
+	Version int64
+}
+
+func (m *ChunkMesh) Faces() int {
+	n := 0
+	for _, mesh := range m.passes {
+		n += mesh.Faces()
+	}
+	return n
+}
+
+func (m *ChunkMesh) Release() {
+	for _, mesh := range m.passes {
+		mesh.Release()
+	}
+}
+
 type Mesh struct {
 	vao, vbo uint32
 	faces    int
-	Id       ChunkID
-	Version  int64
 }
 
 func NewMesh(shader *glhf.Shader, data []float32) *Mesh {
@@ -439,6 +530,11 @@ func NewMesh(shader *glhf.Shader, data []float32) *Mesh {
 	offset := 0
 	for _, attr := range shader.VertexFormat() {
 		loc := gl.GetAttribLocation(shader.ID(), gl.Str(attr.Name+"\x00"))
+		if loc < 0 {
+			// attributes the shader does not read are dropped by the compiler
+			offset += attr.Type.Size()
+			continue
+		}
 		var size int32
 		switch attr.Type {
 		case glhf.Float:
@@ -487,6 +583,95 @@ func (m *Mesh) Release() {
 	}
 }
 
+// quadIndices : element buffer shared by packed meshes, two triangles for each four vertices
+type quadIndices struct {
+	ebo   uint32
+	quads int
+}
+
+// bind binds the buffer to the bound vertex array, growing it to hold at least quads, call on mainthread
+func (q *quadIndices) bind(quads int) {
+	if q.ebo == 0 {
+		gl.GenBuffers(1, &q.ebo)
+	}
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, q.ebo)
+	if quads <= q.quads {
+		return
+	}
+	// vertex arrays bound to the buffer before see the new data too
+	n := q.quads * 2
+	if n < quads {
+		n = quads
+	}
+	indices := mesher.QuadIndices(make([]uint32, 0, n*6), n)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+	q.quads = n
+}
+
+// PackedMesh : quads of vertices packed by mesher.PackQuads
+type PackedMesh struct {
+	vao, vbo uint32
+	faces    int
+}
+
+func NewPackedMesh(shader *glhf.Shader, indices *quadIndices, data []byte) *PackedMesh {
+	m := new(PackedMesh)
+	m.faces = len(data) / mesher.PackedSize / 4
+	if m.faces == 0 {
+		return m
+	}
+	gl.GenVertexArrays(1, &m.vao)
+	gl.GenBuffers(1, &m.vbo)
+	gl.BindVertexArray(m.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(data), gl.Ptr(data), gl.STATIC_DRAW)
+	indices.bind(m.faces)
+
+	offset := 0
+	for _, attr := range shader.VertexFormat() {
+		loc := gl.GetAttribLocation(shader.ID(), gl.Str(attr.Name+"\x00"))
+		if loc < 0 {
+			// attributes the shader does not read are dropped by the compiler
+			offset += attr.Type.Size()
+			continue
+		}
+		gl.VertexAttribIPointer(
+			uint32(loc),
+			4,
+			gl.UNSIGNED_BYTE,
+			mesher.PackedSize,
+			gl.PtrOffset(offset),
+		)
+		gl.EnableVertexAttribArray(uint32(loc))
+		offset += attr.Type.Size()
+	}
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	return m
+}
+
+func (m *PackedMesh) Faces() int {
+	return m.faces
+}
+
+func (m *PackedMesh) Draw() {
+	if m.vao != 0 {
+		gl.BindVertexArray(m.vao)
+		gl.DrawElements(gl.TRIANGLES, int32(m.faces)*6, gl.UNSIGNED_INT, gl.PtrOffset(0))
+		gl.BindVertexArray(0)
+	}
+}
+
+func (m *PackedMesh) Release() {
+	if m.vao != 0 {
+		gl.DeleteVertexArrays(1, &m.vao)
+		gl.DeleteBuffers(1, &m.vbo)
+		m.vao = 0
+		m.vbo = 0
+	}
+}
+
 type Lines struct {
 	vao, vbo uint32
 	shader   *glhf.Shader
@@ -506,6 +691,11 @@ func NewLines(shader *glhf.Shader, data []float32) *Lines {
 	offset := 0
 	for _, attr := range shader.VertexFormat() {
 		loc := gl.GetAttribLocation(shader.ID(), gl.Str(attr.Name+"\x00"))
+		if loc < 0 {
+			// attributes the shader does not read are dropped by the compiler
+			offset += attr.Type.Size()
+			continue
+		}
 		var size int32
 		switch attr.Type {
 		case glhf.Float:
@@ -557,6 +747,9 @@ type LineRender struct {
 	cross     *Lines
 	wireFrame *Lines
 	lastBlock BlockID
+
+	selection     *Lines
+	lastSelection Region
 }
 
 func NewLineRender(game *Game) (*LineRender, error) {
@@ -592,20 +785,20 @@ func (r *LineRender) drawCross() {
 
 func (r *LineRender) drawWireFrame(mat mgl32.Mat4) {
 	var vertices []float32
-	w := r.game
-	block, _ := w.world.HitTest(w.camera.Pos(), w.camera.Front())
-	if block == nil {
+	hit := r.game.hitBlock()
+	if hit == nil {
 		return
 	}
+	block := hit.Block
 
 	mat = mat.Mul4(mgl32.Translate3D(float32(block.X), float32(block.Y), float32(block.Z)))
 	mat = mat.Mul4(mgl32.Scale3D(1.06, 1.06, 1.06))
-	if *block == r.lastBlock {
+	if block == r.lastBlock {
 		r.wireFrame.Draw(mat)
 		return
 	}
 
-	id := *block
+	id := block
 	show := [...]bool{
 		r.game.world.Block(id.Left()).IsTransparent(),
 		r.game.world.Block(id.Right()).IsTransparent(),
@@ -618,7 +811,7 @@ func (r *LineRender) drawWireFrame(mat mgl32.Mat4) {
 	if len(vertices) == 0 {
 		return
 	}
-	r.lastBlock = *block
+	r.lastBlock = block
 	if r.wireFrame != nil {
 		r.wireFrame.Release()
 	}
@@ -627,6 +820,22 @@ func (r *LineRender) drawWireFrame(mat mgl32.Mat4) {
 	r.wireFrame.Draw(mat)
 }
 
+// drawSelection draws edges of the box selected for edits
+func (r *LineRender) drawSelection(mat mgl32.Mat4) {
+	sel, ok := r.game.selection()
+	if !ok {
+		return
+	}
+	if r.selection == nil || sel != r.lastSelection {
+		if r.selection != nil {
+			r.selection.Release()
+		}
+		r.selection = NewLines(r.shader, makeBoxEdges(sel))
+		r.lastSelection = sel
+	}
+	r.selection.Draw(mat)
+}
+
 func (r *LineRender) Draw() {
 	width, height := r.game.win.GetSize()
 	projection := mgl32.Perspective(radian(45), float32(width)/float32(height), 0.01, ChunkWidth*float32(*renderRadius))
@@ -636,9 +845,37 @@ func (r *LineRender) Draw() {
 	r.shader.Begin()
 	r.drawCross()
 	r.drawWireFrame(mat)
+	r.drawSelection(mat)
 	r.shader.End()
 }
 
+// makeBoxEdges returns lines of the twelve edges of region sel, a little outside its blocks
+func makeBoxEdges(sel Region) []float32 {
+	const pad = 0.5 + 0.03
+	lo := mgl32.Vec3{float32(sel.Min.X) - pad, float32(sel.Min.Y) - pad, float32(sel.Min.Z) - pad}
+	hi := mgl32.Vec3{float32(sel.Max.X) + pad, float32(sel.Max.Y) + pad, float32(sel.Max.Z) + pad}
+	corner := func(i int) []float32 {
+		v := lo
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) != 0 {
+				v[axis] = hi[axis]
+			}
+		}
+		return v[:]
+	}
+	var vertices []float32
+	// corners whose numbers differ by one bit share an edge
+	for i := 0; i < 8; i++ {
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) == 0 {
+				vertices = append(vertices, corner(i)...)
+				vertices = append(vertices, corner(i|1<<uint(axis))...)
+			}
+		}
+	}
+	return vertices
+}
+
 func makeCross(shader *glhf.Shader) *Lines {
 	return NewLines(shader, []float32{
 		-0.5, 0, 0, 0.5, 0, 0,
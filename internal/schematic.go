@@ -0,0 +1,326 @@
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	// schematics are Sponge schematics of version 3, which WorldEdit reads,
+	// versions 1 and 2 are read too
+	schematicVersion = 3
+	// blocks Minecraft has no state for are saved as gocraft:name
+	schematicNamespace = "gocraft:"
+	// sides are saved as shorts, and the box is kept in memory
+	schematicMaxSide   = 65535
+	schematicMaxBlocks = 1 << 24
+)
+
+// Schematic : box of blocks copied out of a world, to paste in a world,
+// block x, y, z of the box is blocks[x + z*Width + y*Width*Length]
+type Schematic struct {
+	Width, Height, Length int
+	blocks                []BlockType
+}
+
+func newSchematic(width, height, length int) (*Schematic, error) {
+	if width < 1 || height < 1 || length < 1 || width > schematicMaxSide || height > schematicMaxSide || length > schematicMaxSide {
+		return nil, fmt.Errorf("bad schematic size %dx%dx%d", width, height, length)
+	}
+	if width*height*length > schematicMaxBlocks {
+		return nil, fmt.Errorf("schematic of %dx%dx%d blocks is larger than %d blocks", width, height, length, schematicMaxBlocks)
+	}
+	return &Schematic{
+		Width:  width,
+		Height: height,
+		Length: length,
+		blocks: make([]BlockType, width*height*length),
+	}, nil
+}
+
+func (s *Schematic) index(x, y, z int) int {
+	return x + z*s.Width + y*s.Width*s.Length
+}
+
+// Block returns block x, y, z of the box
+func (s *Schematic) Block(x, y, z int) BlockType {
+	return s.blocks[s.index(x, y, z)]
+}
+
+// CopySchematic copies the box of blocks between corners a and b of w, both included
+func CopySchematic(w *World, a, b BlockID) (*Schematic, error) {
+	r := NewRegion(a, b)
+	s, err := newSchematic(r.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[ChunkID]*Chunk)
+	for y := 0; y < s.Height; y++ {
+		for z := 0; z < s.Length; z++ {
+			for x := 0; x < s.Width; x++ {
+				bid := BlockID{r.Min.X + x, r.Min.Y + y, r.Min.Z + z}
+				cid := bid.ChunkID()
+				chunk, ok := chunks[cid]
+				if !ok {
+					chunk = w.peekChunk(cid)
+					if chunk == nil {
+						return nil, fmt.Errorf("read chunk %v failed", cid)
+					}
+					chunks[cid] = chunk
+				}
+				s.blocks[s.index(x, y, z)] = chunk.Block(bid)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Rotate returns s turned by quarter turns clockwise seen from above, east goes south
+func (s *Schematic) Rotate(turns int) *Schematic {
+	turns = (turns%4 + 4) % 4
+	r := s
+	for i := 0; i < turns; i++ {
+		t := &Schematic{Width: r.Length, Height: r.Height, Length: r.Width, blocks: make([]BlockType, len(r.blocks))}
+		for y := 0; y < r.Height; y++ {
+			for z := 0; z < r.Length; z++ {
+				for x := 0; x < r.Width; x++ {
+					// north side goes east
+					t.blocks[t.index(r.Length-1-z, y, x)] = r.Block(x, y, z)
+				}
+			}
+		}
+		r = t
+	}
+	return r
+}
+
+// Mirror returns s flipped east to west
+func (s *Schematic) Mirror() *Schematic {
+	m := &Schematic{Width: s.Width, Height: s.Height, Length: s.Length, blocks: make([]BlockType, len(s.blocks))}
+	for y := 0; y < s.Height; y++ {
+		for z := 0; z < s.Length; z++ {
+			for x := 0; x < s.Width; x++ {
+				m.blocks[m.index(s.Width-1-x, y, z)] = s.Block(x, y, z)
+			}
+		}
+	}
+	return m
+}
+
+// Paste sets blocks of w in the box whose lowest corner is at to the blocks of s, air too unless skipAir is set.
+// Edits are saved like region edits, it returns the number of blocks changed
+func (s *Schematic) Paste(w *World, at BlockID, skipAir bool) (int, error) {
+	r := Region{at, BlockID{at.X + s.Width - 1, at.Y + s.Height - 1, at.Z + s.Length - 1}}
+	return w.editParts(r, func(id BlockID, old BlockType) BlockType {
+		tp := s.Block(id.X-at.X, id.Y-at.Y, id.Z-at.Z)
+		if tp == 0 && skipAir {
+			return old
+		}
+		return tp
+	})
+}
+
+// LoadSchematicMapping returns mapping of -mcblocks file for schematics,
+// or nil if it can not be read, then all blocks are saved by their names
+func LoadSchematicMapping() *AnvilMapping {
+	m, err := LoadAnvilMapping()
+	if err != nil {
+		log.Printf("schematic blocks are saved by name, load minecraft block mapping error:%s", err)
+		return nil
+	}
+	return m
+}
+
+// schematicState returns name of block w in schematics, its Minecraft state if m maps it
+func schematicState(m *AnvilMapping, w BlockType) string {
+	if m != nil {
+		if s, ok := m.state(w); ok {
+			return s.String()
+		}
+	}
+	if w == 0 {
+		return "minecraft:air"
+	}
+	return schematicNamespace + registry.Def(w).Name
+}
+
+// schematicBlock returns block of state in schematics, ok is false if it is not known
+func schematicBlock(m *AnvilMapping, state string) (BlockType, bool, error) {
+	if strings.HasPrefix(state, schematicNamespace) {
+		w, ok := registry.Lookup(strings.TrimPrefix(state, schematicNamespace))
+		return w, ok, nil
+	}
+	s, err := parseAnvilStateString(state)
+	if err != nil {
+		return 0, false, err
+	}
+	if m != nil {
+		w, ok := m.block(s)
+		return w, ok, nil
+	}
+	return 0, s.Name == "minecraft:air", nil
+}
+
+// Write writes s as a gzipped Sponge schematic, m maps blocks to Minecraft states, it can be nil
+func (s *Schematic) Write(w io.Writer, m *AnvilMapping) error {
+	palette := make(nbtCompound)
+	indexes := make(map[BlockType]int32)
+	data := make([]byte, 0, len(s.blocks))
+	var tmp [binary.MaxVarintLen32]byte
+	for _, tp := range s.blocks {
+		idx, ok := indexes[tp]
+		if !ok {
+			name := schematicState(m, tp)
+			if v, ok := palette[name]; ok {
+				// blocks of the same state
+				idx = v.(int32)
+			} else {
+				idx = int32(len(palette))
+				palette[name] = idx
+			}
+			indexes[tp] = idx
+		}
+		n := binary.PutUvarint(tmp[:], uint64(idx))
+		data = append(data, tmp[:n]...)
+	}
+
+	b, err := encodeNBT(nbtCompound{
+		"Schematic": nbtCompound{
+			"Version":     int32(schematicVersion),
+			"DataVersion": int32(anvilDataVersion),
+			"Width":       int16(uint16(s.Width)),
+			"Height":      int16(uint16(s.Height)),
+			"Length":      int16(uint16(s.Length)),
+			"Offset":      []int32{0, 0, 0},
+			"Blocks": nbtCompound{
+				"Palette": palette,
+				"Data":    data,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSchematic reads a gzipped Sponge schematic, m maps Minecraft states to blocks, it can be nil.
+// It returns counts of the states which are not known, they are the unmapped block of m or air
+func ReadSchematic(r io.Reader, m *AnvilMapping) (*Schematic, map[string]int, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := decodeNBT(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// version 3 keeps all under Schematic and blocks under Blocks
+	if v, ok := root["Schematic"].(nbtCompound); ok {
+		root = v
+	}
+	palette, _ := root["Palette"].(nbtCompound)
+	data, _ := root["BlockData"].([]byte)
+	if blocks, ok := root["Blocks"].(nbtCompound); ok {
+		palette, _ = blocks["Palette"].(nbtCompound)
+		data, _ = blocks["Data"].([]byte)
+	}
+	if palette == nil {
+		return nil, nil, errors.New("schematic has no block palette")
+	}
+
+	var side [3]int
+	for i, name := range []string{"Width", "Height", "Length"} {
+		v, ok := root[name].(int16)
+		if !ok {
+			return nil, nil, fmt.Errorf("schematic has no %s", name)
+		}
+		side[i] = int(uint16(v))
+	}
+	s, err := newSchematic(side[0], side[1], side[2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks := make(map[int]BlockType, len(palette))
+	names := make(map[int]string)
+	for state, v := range palette {
+		idx, ok := nbtInt(v)
+		if !ok {
+			return nil, nil, fmt.Errorf("palette index of %s is not a number", state)
+		}
+		w, known, err := schematicBlock(m, state)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !known {
+			names[idx] = state
+			if m != nil {
+				w = m.unmappedBlock
+			}
+		}
+		blocks[idx] = w
+	}
+
+	unmapped := make(map[string]int)
+	for i := range s.blocks {
+		idx, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("block data ends at block %d of %d", i, len(s.blocks))
+		}
+		data = data[n:]
+		w, ok := blocks[int(idx)]
+		if !ok {
+			return nil, nil, fmt.Errorf("block %d has index %d which is not in the palette", i, idx)
+		}
+		s.blocks[i] = w
+		if name, ok := names[int(idx)]; ok {
+			unmapped[name]++
+		}
+	}
+	if len(data) != 0 {
+		return nil, nil, fmt.Errorf("%d bytes after block data", len(data))
+	}
+	return s, unmapped, nil
+}
+
+// WriteSchematicFile writes s to file path
+func WriteSchematicFile(path string, s *Schematic, m *AnvilMapping) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = s.Write(f, m)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadSchematicFile reads schematic file path
+func ReadSchematicFile(path string, m *AnvilMapping) (*Schematic, map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return ReadSchematic(bufio.NewReader(f), m)
+}
@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSchematic returns a schematic of the given size whose blocks are f of x, y, z
+func testSchematic(t *testing.T, width, height, length int, f func(x, y, z int) BlockType) *Schematic {
+	s, err := newSchematic(width, height, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < height; y++ {
+		for z := 0; z < length; z++ {
+			for x := 0; x < width; x++ {
+				s.blocks[s.index(x, y, z)] = f(x, y, z)
+			}
+		}
+	}
+	return s
+}
+
+// gzipNBT returns root as a gzipped NBT file
+func gzipNBT(t *testing.T, root nbtCompound) []byte {
+	b, err := encodeNBT(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestSchematic_Copy(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	w := NewWorld(store, &flatGenerator{})
+	brick := lookupBlock(t, "brick")
+	assert.Nil(t, w.UpdateBlock(BlockID{-1, 10, 17}, brick))
+	assert.Nil(t, w.UpdateBlock(BlockID{0, 9, 16}, 0))
+
+	// corners in any order, across chunk borders
+	s, err := CopySchematic(w, BlockID{1, 11, 16}, BlockID{-2, 8, 18})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []int{4, 4, 3}, []int{s.Width, s.Height, s.Length})
+	for y := 0; y < 4; y++ {
+		for z := 0; z < 3; z++ {
+			for x := 0; x < 4; x++ {
+				bid := BlockID{x - 2, y + 8, z + 16}
+				want := BlockType(0)
+				switch {
+				case bid == BlockID{-1, 10, 17}:
+					want = brick
+				case bid == BlockID{0, 9, 16}:
+				case bid.Y < 10:
+					want = stoneBlock
+				}
+				assert.Equal(t, want, s.Block(x, y, z), "block %v", bid)
+			}
+		}
+	}
+
+	// copying does not load chunks
+	_, loaded := w.loadChunk(BlockID{0, 8, 16}.ChunkID())
+	assert.False(t, loaded)
+
+	_, err = CopySchematic(w, BlockID{0, 0, 0}, BlockID{schematicMaxSide, 0, 0})
+	assert.NotNil(t, err)
+	_, err = CopySchematic(w, BlockID{0, 0, 0}, BlockID{1 << 10, 1 << 10, 1 << 10})
+	assert.NotNil(t, err)
+}
+
+func TestSchematic_RotateMirror(t *testing.T) {
+	// block numbers say where they are
+	s := testSchematic(t, 3, 2, 2, func(x, y, z int) BlockType {
+		return BlockType(1 + x + z*3 + y*6)
+	})
+
+	r := s.Rotate(1)
+	assert.Equal(t, []int{2, 2, 3}, []int{r.Width, r.Height, r.Length})
+	// north west corner goes north east, east goes south
+	assert.Equal(t, s.Block(0, 0, 0), r.Block(1, 0, 0))
+	assert.Equal(t, s.Block(2, 0, 0), r.Block(1, 0, 2))
+	assert.Equal(t, s.Block(0, 1, 1), r.Block(0, 1, 0))
+	assert.Equal(t, s.Block(2, 1, 1), r.Block(0, 1, 2))
+
+	assert.Equal(t, s.Rotate(2), r.Rotate(1))
+	assert.Equal(t, s.Rotate(-1), s.Rotate(3))
+	assert.Equal(t, s, s.Rotate(4))
+	assert.Equal(t, s, s.Rotate(0))
+	// half a turn is mirroring both ways
+	h := s.Rotate(2)
+	assert.Equal(t, s.Block(0, 1, 0), h.Block(2, 1, 1))
+
+	m := s.Mirror()
+	assert.Equal(t, []int{3, 2, 2}, []int{m.Width, m.Height, m.Length})
+	assert.Equal(t, s.Block(0, 1, 1), m.Block(2, 1, 1))
+	assert.Equal(t, s.Block(1, 0, 0), m.Block(1, 0, 0))
+	assert.Equal(t, s, m.Mirror())
+}
+
+func TestSchematic_RoundTrip(t *testing.T) {
+	stone, grass, color := lookupBlock(t, "stone"), lookupBlock(t, "grass"), lookupBlock(t, "color_05")
+	// enough blocks for indexes of two bytes
+	s := testSchematic(t, 20, 3, 10, func(x, y, z int) BlockType {
+		switch {
+		case x == 19 && z == 9:
+			return color
+		case y == 0:
+			return stone
+		case y == 1 && x%2 == 0:
+			return grass
+		case y == 2 && x < 10:
+			return BlockType(x % 8)
+		}
+		return 0
+	})
+
+	for _, m := range []*AnvilMapping{nil, readTestAnvilMapping(t)} {
+		var buf bytes.Buffer
+		assert.Nil(t, s.Write(&buf, m))
+		read, unmapped, err := ReadSchematic(&buf, m)
+		if assert.Nil(t, err) {
+			assert.Equal(t, s, read)
+			assert.Equal(t, 0, len(unmapped))
+		}
+	}
+
+	// mapped blocks are saved as Minecraft states, the others by name
+	var buf bytes.Buffer
+	assert.Nil(t, s.Write(&buf, readTestAnvilMapping(t)))
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	raw.ReadFrom(zr)
+	root, err := decodeNBT(raw.Bytes())
+	if !assert.Nil(t, err) {
+		return
+	}
+	schematic := root["Schematic"].(nbtCompound)
+	assert.Equal(t, int32(schematicVersion), schematic["Version"])
+	assert.Equal(t, []interface{}{int16(20), int16(3), int16(10)}, []interface{}{schematic["Width"], schematic["Height"], schematic["Length"]})
+	palette := schematic["Blocks"].(nbtCompound)["Palette"].(nbtCompound)
+	assert.Contains(t, palette, "minecraft:stone")
+	assert.Contains(t, palette, "minecraft:air")
+	assert.Contains(t, palette, "gocraft:color_05")
+}
+
+func TestSchematic_ReadVersion2(t *testing.T) {
+	m := readTestAnvilMapping(t)
+	stone, unmapped := lookupBlock(t, "stone"), m.unmappedBlock
+	data := gzipNBT(t, nbtCompound{
+		"Version":    int32(2),
+		"Width":      int16(2),
+		"Height":     int16(1),
+		"Length":     int16(2),
+		"PaletteMax": int32(3),
+		"Palette": nbtCompound{
+			"minecraft:air":         int32(0),
+			"minecraft:stone":       int32(1),
+			"minecraft:diamond_ore": int32(2),
+		},
+		"BlockData": []byte{1, 0, 2, 2},
+	})
+
+	s, counts, err := ReadSchematic(bytes.NewReader(data), m)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []BlockType{stone, 0, unmapped, unmapped}, s.blocks)
+	assert.Equal(t, map[string]int{"minecraft:diamond_ore": 2}, counts)
+
+	// without a mapping only air is known
+	s, counts, err = ReadSchematic(bytes.NewReader(data), nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []BlockType{0, 0, 0, 0}, s.blocks)
+		assert.Equal(t, 3, counts["minecraft:stone"]+counts["minecraft:diamond_ore"])
+	}
+}
+
+func TestSchematic_ReadErrors(t *testing.T) {
+	schematic := func(width int16, data []byte, palette nbtCompound) []byte {
+		return gzipNBT(t, nbtCompound{"Schematic": nbtCompound{
+			"Version": int32(3),
+			"Width":   width,
+			"Height":  int16(1),
+			"Length":  int16(1),
+			"Blocks":  nbtCompound{"Palette": palette, "Data": data},
+		}})
+	}
+	air := nbtCompound{"minecraft:air": int32(0)}
+	for name, data := range map[string][]byte{
+		"not gzip":       []byte("schematic"),
+		"no size":        gzipNBT(t, nbtCompound{"Palette": air, "BlockData": []byte{0}}),
+		"no palette":     gzipNBT(t, nbtCompound{"Width": int16(1), "Height": int16(1), "Length": int16(1)}),
+		"empty":          schematic(0, nil, air),
+		"data too short": schematic(2, []byte{0}, air),
+		"data too long":  schematic(1, []byte{0, 0}, air),
+		"bad varint":     schematic(1, []byte{0x80}, air),
+		"bad index":      schematic(1, []byte{1}, air),
+		"bad state":      schematic(1, []byte{0}, nbtCompound{"minecraft:air[": int32(0)}),
+		"bad palette":    schematic(1, []byte{0}, nbtCompound{"minecraft:air": "0"}),
+	} {
+		_, _, err := ReadSchematic(bytes.NewReader(data), nil)
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestSchematic_Paste(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	w := NewWorld(store, &flatGenerator{})
+	brick := lookupBlock(t, "brick")
+	// a brick, two air blocks and a stone on top
+	s := testSchematic(t, 1, 4, 1, func(x, y, z int) BlockType {
+		return []BlockType{brick, 0, 0, stoneBlock}[y]
+	})
+
+	at := BlockID{15, 8, -1}
+	n, err := s.Paste(w, at, false)
+	assert.Nil(t, err)
+	// y 10 was air already
+	assert.Equal(t, 3, n)
+	assert.Equal(t, map[BlockID]BlockType{
+		{15, 8, -1}:  brick,
+		{15, 9, -1}:  0,
+		{15, 11, -1}: stoneBlock,
+	}, storeOverrides(t, store))
+
+	// pasting again changes nothing
+	n, err = s.Paste(w, at, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// air is kept with skipAir, loaded chunks see the paste
+	c := w.Chunk(BlockID{16, 8, 0}.ChunkID())
+	version := c.Version
+	n, err = s.Paste(w, BlockID{16, 7, 0}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, brick, w.Block(BlockID{16, 7, 0}))
+	assert.Equal(t, stoneBlock, w.Block(BlockID{16, 8, 0}))
+	assert.Equal(t, stoneBlock, w.Block(BlockID{16, 10, 0}))
+	assert.NotEqual(t, version, c.Version)
+}
+
+func TestSchematic_PasteInParts(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	w := NewWorld(store, &flatGenerator{})
+	// longer than an edit can be
+	s := testSchematic(t, editMaxSide+100, 1, 1, func(x, y, z int) BlockType {
+		return stoneBlock
+	})
+	at := BlockID{-50, 20, 3}
+	n, err := s.Paste(w, at, false)
+	assert.Nil(t, err)
+	assert.Equal(t, s.Width, n)
+	assert.Equal(t, s.Width, len(storeOverrides(t, store)))
+	for _, x := range []int{-51, -50, -33, -32, -1, 0, editMaxSide + 49, editMaxSide + 50} {
+		id := BlockID{x, 20, 3}
+		tp := stoneBlock
+		if x < at.X || x >= at.X+s.Width {
+			tp = 0
+		}
+		assert.Equal(t, tp, w.Chunk(id.ChunkID()).Block(id), x)
+	}
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// messages queued for a connection, connections which can't keep up are dropped
+	serverSendBuffer = 4096
+
+	// Craft world is 256 blocks high, so a chunk column is chunks from y 0 to 7
+	serverColumnChunks = 8
+)
+
+// Server : serves a world to Craft protocol clients
+type Server struct {
+	world *World
+	spawn BlockID
+
+	mutex   sync.Mutex
+	conns   map[int]*serverConn
+	nextID  int
+	ln      net.Listener
+	closing bool
+}
+
+// serverConn : connected player
+type serverConn struct {
+	id   int
+	name string
+	pos  string // x,y,z,rx,ry
+
+	conn  net.Conn
+	sendc chan string
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewServer(world *World) *Server {
+	s := &Server{
+		world:  world,
+		conns:  make(map[int]*serverConn),
+		nextID: 1,
+	}
+	// spawn on top of the highest block at 0, 0
+	s.spawn = BlockID{0, serverColumnChunks * ChunkWidth, 0}
+	for y := serverColumnChunks*ChunkWidth - 1; y >= 0; y-- {
+		bid := BlockID{0, y, 0}
+		if chunk := world.Chunk(bid.ChunkID()); chunk != nil && chunk.Block(bid) != 0 {
+			s.spawn = BlockID{0, y + 2, 0}
+			break
+		}
+	}
+	return s
+}
+
+// ListenAndServe listens on tcp addr and serves clients until Close
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves clients connecting to ln until Close
+func (s *Server) Serve(ln net.Listener) error {
+	s.mutex.Lock()
+	s.ln = ln
+	s.mutex.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closing := s.closing
+			s.mutex.Unlock()
+			if closing {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops listening and disconnects all clients
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closing = true
+	ln := s.ln
+	var conns []*serverConn
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mutex.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+	if ln == nil {
+		return nil
+	}
+	return ln.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := s.join(conn)
+	go c.writeLoop()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			s.command(c, line)
+		}
+	}
+	s.leave(c)
+}
+
+func (s *Server) join(conn net.Conn) *serverConn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := &serverConn{
+		id:    s.nextID,
+		conn:  conn,
+		sendc: make(chan string, serverSendBuffer),
+		done:  make(chan struct{}),
+	}
+	s.nextID++
+	c.name = fmt.Sprintf("guest%d", c.id)
+	c.pos = fmt.Sprintf("%d,%d,%d,0,0", s.spawn.X, s.spawn.Y, s.spawn.Z)
+
+	c.send(fmt.Sprintf("U,%d,%s", c.id, c.pos))
+	// gocraft clients generate the same terrain as server, Craft clients ignore it
+	c.send(fmt.Sprintf("G,%s,%d", s.world.Generator().Name(), s.world.Generator().Seed()))
+	for _, other := range s.conns {
+		c.send(fmt.Sprintf("N,%d,%s", other.id, other.name))
+		c.send(fmt.Sprintf("P,%d,%s", other.id, other.pos))
+	}
+	s.conns[c.id] = c
+	s.broadcast(c, fmt.Sprintf("N,%d,%s", c.id, c.name))
+	s.broadcast(c, fmt.Sprintf("P,%d,%s", c.id, c.pos))
+	log.Printf("%s joined from %s", c.name, conn.RemoteAddr())
+	return c
+}
+
+func (s *Server) leave(c *serverConn) {
+	c.close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, c.id)
+	s.broadcast(c, fmt.Sprintf("D,%d", c.id))
+	log.Printf("%s left", c.name)
+}
+
+// Players returns connected players
+func (s *Server) Players() []Player {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var players []Player
+	for _, c := range s.conns {
+		pos := strings.Split(c.pos, ",")
+		players = append(players, Player{
+			ID:   c.id,
+			Name: c.name,
+			Pos:  mgl32.Vec3{atof(pos[0]), atof(pos[1]), atof(pos[2])},
+			Rx:   atof(pos[3]) - math.Pi/2,
+			Ry:   atof(pos[4]),
+		})
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	return players
+}
+
+// broadcast sends msg to all connections except from, must be called with lock
+func (s *Server) broadcast(from *serverConn, msg string) {
+	for _, c := range s.conns {
+		if c != from {
+			c.send(msg)
+		}
+	}
+}
+
+func (s *Server) command(c *serverConn, line string) {
+	args := strings.Split(line, ",")
+	switch args[0] {
+	case "A":
+		// A,name,token : token is not checked
+		if len(args) < 2 || args[1] == "" {
+			return
+		}
+		s.mutex.Lock()
+		c.name = args[1]
+		s.broadcast(c, fmt.Sprintf("N,%d,%s", c.id, c.name))
+		s.mutex.Unlock()
+	case "C":
+		// C,p,q,key
+		if len(args) < 3 {
+			return
+		}
+		p, err1 := strconv.Atoi(args[1])
+		q, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		s.sendColumn(c, p, q)
+	case "B":
+		// B,x,y,z,w
+		if len(args) < 5 {
+			return
+		}
+		var v [4]int
+		for i := range v {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return
+			}
+			v[i] = n
+		}
+		bid, w := BlockID{v[0], v[1], v[2]}, v[3]
+		if bid.Y < 0 || bid.Y >= serverColumnChunks*ChunkWidth || w < 0 || w > 0xffff {
+			return
+		}
+		err := s.world.UpdateBlock(bid, BlockType(w))
+		if err != nil {
+			log.Printf("update block %v error:%s", bid, err)
+			return
+		}
+		cid := bid.ChunkID()
+		s.mutex.Lock()
+		s.broadcast(c, fmt.Sprintf("B,%d,%d,%d,%d,%d,%d", cid.X, cid.Z, bid.X, bid.Y, bid.Z, w))
+		s.broadcast(c, fmt.Sprintf("R,%d,%d", cid.X, cid.Z))
+		s.mutex.Unlock()
+	case "P":
+		// P,x,y,z,rx,ry
+		if len(args) < 6 {
+			return
+		}
+		for _, a := range args[1:6] {
+			if _, err := strconv.ParseFloat(a, 32); err != nil {
+				return
+			}
+		}
+		s.mutex.Lock()
+		c.pos = strings.Join(args[1:6], ",")
+		s.broadcast(c, fmt.Sprintf("P,%d,%s", c.id, c.pos))
+		s.mutex.Unlock()
+	case "T":
+		// T,text
+		text := strings.TrimPrefix(line, "T,")
+		s.mutex.Lock()
+		s.broadcast(nil, fmt.Sprintf("T,%s> %s", c.name, text))
+		s.mutex.Unlock()
+	}
+}
+
+// sendColumn sends blocks saved in chunk column p, q, then R to end it
+func (s *Server) sendColumn(c *serverConn, p, q int) {
+	for y := 0; y < serverColumnChunks; y++ {
+		err := s.world.store.RangeBlocks(ChunkID{p, y, q}, func(bid BlockID, w BlockType) {
+			c.sendWait(fmt.Sprintf("B,%d,%d,%d,%d,%d,%d", p, q, bid.X, bid.Y, bid.Z, w))
+		})
+		if err != nil {
+			log.Printf("fetch chunk(%v) from db error:%s", ChunkID{p, y, q}, err)
+		}
+	}
+	c.sendWait(fmt.Sprintf("R,%d,%d", p, q))
+}
+
+// send queues msg, a connection with full queue is closed
+func (c *serverConn) send(msg string) {
+	select {
+	case c.sendc <- msg:
+	case <-c.done:
+	default:
+		log.Printf("%s is too slow, disconnect", c.name)
+		c.close()
+	}
+}
+
+// sendWait queues msg, waiting for room in the queue.
+// Only used on the reading goroutine of c, so a slow client only waits for itself.
+func (c *serverConn) sendWait(msg string) {
+	select {
+	case c.sendc <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *serverConn) writeLoop() {
+	w := bufio.NewWriter(c.conn)
+	for {
+		select {
+		case msg := <-c.sendc:
+			w.WriteString(msg)
+			w.WriteByte('\n')
+			// flush when there is nothing more to send
+			if len(c.sendc) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *serverConn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*Server, *Store, string, func()) {
+	store, cleanup := newTestStore(t)
+	gen, err := NewGenerator("biome", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(NewWorld(store, gen))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(ln)
+	}()
+	return server, store, ln.Addr().String(), func() {
+		server.Close()
+		assert.Nil(t, <-done)
+		cleanup()
+	}
+}
+
+func dialTestServer(t *testing.T, addr string) *Client {
+	client, err := NewClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server has registered the client once it has said hello
+	_, _, ok := client.Generator()
+	assert.True(t, ok)
+	return client
+}
+
+func TestServer_Generator(t *testing.T) {
+	_, _, addr, cleanup := newTestServer(t)
+	defer cleanup()
+
+	client := dialTestServer(t, addr)
+	defer client.Close()
+	name, seed, ok := client.Generator()
+	assert.True(t, ok)
+	assert.Equal(t, "biome", name)
+	assert.Equal(t, int64(9), seed)
+}
+
+func TestServer_Blocks(t *testing.T) {
+	_, store, addr, cleanup := newTestServer(t)
+	defer cleanup()
+
+	a := dialTestServer(t, addr)
+	defer a.Close()
+	b := dialTestServer(t, addr)
+	defer b.Close()
+
+	changed := make(chan BlockID, 1)
+	b.OnBlock(func(id BlockID, w BlockType) {
+		assert.Equal(t, BlockType(4), w)
+		changed <- id
+	})
+
+	bid := BlockID{40, 70, -3}
+	assert.Nil(t, a.UpdateBlock(bid, 4))
+	select {
+	case id := <-changed:
+		assert.Equal(t, bid, id)
+	case <-time.After(time.Second):
+		t.Fatal("block is not broadcast")
+	}
+
+	// saved in store, and served to new fetches
+	saved := make(map[BlockID]BlockType)
+	store.RangeBlocks(bid.ChunkID(), func(id BlockID, w BlockType) {
+		saved[id] = w
+	})
+	assert.Equal(t, map[BlockID]BlockType{bid: 4}, saved)
+
+	cid := bid.ChunkID()
+	blocks, err := a.FetchColumn(cid.X, cid.Z)
+	assert.Nil(t, err)
+	assert.Equal(t, map[BlockID]BlockType{bid: 4}, blocks)
+
+	// out of the world
+	assert.Nil(t, a.UpdateBlock(BlockID{1, -1, 1}, 4))
+	blocks, err = a.FetchColumn(0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, blocks)
+}
+
+func TestServer_Players(t *testing.T) {
+	server, _, addr, cleanup := newTestServer(t)
+	defer cleanup()
+
+	a := dialTestServer(t, addr)
+	defer a.Close()
+	b := dialTestServer(t, addr)
+
+	assert.Nil(t, b.send("A,bob,token"))
+	assert.Nil(t, b.UpdatePosition(mgl32.Vec3{1, 50, 2}, 0, 0))
+	assert.Nil(t, b.Talk("hello"))
+	assert.Eventually(t, func() bool {
+		players := a.Players()
+		return len(players) == 1 && players[0].Name == "bob" &&
+			players[0].Pos == mgl32.Vec3{1, 50, 2} && len(a.Chat()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"bob> hello"}, a.Chat())
+	players := server.Players()
+	assert.Equal(t, 2, len(players))
+	assert.Equal(t, "bob", players[1].Name)
+	assert.Equal(t, mgl32.Vec3{1, 50, 2}, players[1].Pos)
+
+	// players who joined before are told to new clients
+	c := dialTestServer(t, addr)
+	defer c.Close()
+	assert.Eventually(t, func() bool {
+		return len(c.Players()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	b.Close()
+	assert.Eventually(t, func() bool {
+		return len(a.Players()) == 1 && len(c.Players()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -4,26 +4,52 @@ var (
 	blockVertexSource = `
 #version 330 core
 
-in vec3 pos;
-in vec2 tex;
-in vec3 normal;
+// packed by mesher.Pack
+in uvec4 position;
+in uvec4 material;
 
 uniform mat4 matrix;
 uniform vec3 camera;
 uniform float fogdis;
+uniform vec3 chunk;
 
-out vec2 Tex;
+flat out vec2 Tile;
+out vec2 Local;
+out float occlusion;
+out float light;
 out float diff;
 out float fog_factor;
 
 const vec3 lightdir = normalize(vec3(-1, 1, -1));
+const vec3 normals[6] = vec3[6](
+    vec3(-1, 0, 0), vec3(1, 0, 0),
+    vec3(0, 1, 0), vec3(0, -1, 0),
+    vec3(0, 0, 1), vec3(0, 0, -1)
+);
+const float tile_size = 1.0 / 16;
 
 void main() {
+    // positions are in half blocks from the corner of the chunk
+    vec3 pos = chunk + vec3(position.xyz) * 0.5 - 0.5;
+    vec3 normal = normals[position.w & 7u];
     gl_Position = matrix *  vec4(pos, 1.0);
 
+    // position on the face in blocks, tiles of merged faces repeat every block
+    if (normal.x != 0) {
+        Local = vec2(-normal.x * pos.z, pos.y);
+    } else if (normal.z != 0) {
+        Local = vec2(normal.z * pos.x, pos.y);
+    } else {
+        Local = vec2(normal.y * pos.x, -pos.z);
+    }
+    Local += 0.5;
+
     float camera_distance = distance(pos, camera);
     fog_factor = pow(clamp(camera_distance/fogdis, 0, 1), 4);
-    Tex = tex;
+    Tile = vec2(material.x % 16u, material.x / 16u) * tile_size;
+    occlusion = float(position.w >> 3 & 3u) / 3;
+    // each level of light is 20% darker than the one above
+    light = pow(0.8, (1 - float(max(material.y, material.z)) / 255) * 15);
     diff = max(0, dot(normal, lightdir));
 }
 `
@@ -31,7 +57,10 @@ void main() {
 	blockFragmentSource = `
 #version 330 core
 
-in vec2 Tex;
+flat in vec2 Tile;
+in vec2 Local;
+in float occlusion;
+in float light;
 in float diff;
 in float fog_factor;
 uniform sampler2D tex;
@@ -39,9 +68,13 @@ uniform sampler2D tex;
 out vec4 FragColor;
 
 const vec3 sky_color = vec3(0.57, 0.71, 0.77);
+const float tile_size = 1.0 / 16;
+const float tile_inset = 1.0 / 2048;
 
 void main() {
-    vec3 color = vec3(texture(tex, vec2(Tex.x, 1-Tex.y)));
+    vec2 uv = Tile + tile_inset + fract(Local) * (tile_size - 2 * tile_inset);
+    vec4 texel = texture(tex, vec2(uv.x, 1-uv.y));
+    vec3 color = texel.rgb;
     if (color == vec3(1,0,1)) {
         discard;
     }
@@ -51,9 +84,10 @@ void main() {
     }
     vec3 ambient = 0.5 * vec3(1, 1, 1);
     vec3 diffcolor = df * 0.5 * vec3(1,1,1);
-    color = (ambient + diffcolor) * color;
+    color = (ambient + diffcolor) * color * (1 - occlusion * 0.5) * (0.05 + 0.95 * light);
     color = mix(color, sky_color, fog_factor);
-    FragColor = vec4(color, 1);
+    // alpha only counts in the blended pass of translucent blocks
+    FragColor = vec4(color, texel.a);
 }
 `
 	lineVertexSource = `
@@ -83,20 +117,26 @@ void main() {
 in vec3 pos;
 in vec2 tex;
 in vec3 normal;
+in float ao;
+in float skylight;
+in float blocklight;
 
 uniform mat4 matrix;
 
 out vec2 Tex;
+out float occlusion;
 
 void main() {
     gl_Position = matrix *  vec4(pos, 1.0);
     Tex = tex;
+    occlusion = ao;
 }
 `
 	playerFragmentSource = `
 #version 330 core
 
 in vec2 Tex;
+in float occlusion;
 uniform sampler2D tex;
 
 out vec4 FragColor;
@@ -106,7 +146,7 @@ void main() {
     if (color == vec3(1,0,1)) {
         discard;
     }
-    FragColor = vec4(color, 1);
+    FragColor = vec4(color * (1 - occlusion * 0.5), 1);
 }
 `
 )
@@ -3,8 +3,14 @@ package internal
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-gl/mathgl/mgl32"
@@ -15,11 +21,23 @@ var (
 )
 
 var (
-	//blockBucket  = []byte("block")
 	chunkBucket  = []byte("chunk")
 	cameraBucket = []byte("camera")
+	worldBucket  = []byte("world")
+
+	generatorKey = []byte("generator")
+	seedKey      = []byte("seed")
 
 	GlobalStore *Store
+
+	errStoreClosed = errors.New("store closed")
+)
+
+var (
+	// block edits are committed every storeFlushInterval,
+	// or as soon as storeFlushBlocks blocks are waiting
+	storeFlushInterval = time.Second
+	storeFlushBlocks   = 1024
 )
 
 func InitStore() error {
@@ -31,59 +49,279 @@ func InitStore() error {
 	return err
 }
 
+// InitReadOnlyStore opens the -db file as GlobalStore for reading only, the file is not created or changed
+func InitReadOnlyStore() error {
+	if *dbpath == "" {
+		return errors.New("no -db file")
+	}
+	var err error
+	GlobalStore, err = NewReadOnlyStore(*dbpath)
+	return err
+}
+
+// IStore : saved player edits over generated terrain
 type IStore interface {
-	ChunkBlocks(cid ChunkID) ([]BlockType, error)
+	// RangeBlocks calls f with every overridden block of chunk id, w can be 0 for removed block
+	RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error
+	UpdateBlock(bid BlockID, w BlockType) error
+	// UpdateBlocks saves edits of many chunks at once
+	UpdateBlocks(edits map[ChunkID]map[BlockID]BlockType) error
 }
 
+// Store : bolt db with a write-behind queue for block edits
 type Store struct {
 	db *bolt.DB
+
+	// commitLock makes commits one at a time, so newer edits are committed last
+	commitLock sync.Mutex
+
+	mutex    sync.Mutex
+	pending  map[ChunkID]map[BlockID]BlockType // waiting for next flush
+	flushing map[ChunkID]map[BlockID]BlockType // being committed, readers see it until it is done
+	npending int
+	commits  int // number of commits started and finished, readers read again if it changed while they read
+	closed   bool
+
+	flushc chan struct{}
+	closec chan struct{}
+	done   chan struct{}
+	errc   chan error
 }
 
 func NewStore(p string) (*Store, error) {
-	db, err := bolt.Open(p, 0666, nil)
+	return openStore(p, false)
+}
+
+// NewReadOnlyStore opens db p, which must exist, for reading only, its edits fail to commit
+func NewReadOnlyStore(p string) (*Store, error) {
+	return openStore(p, true)
+}
+
+func openStore(p string, readOnly bool) (*Store, error) {
+	// bolt creates missing files even to read them
+	if readOnly {
+		if _, err := os.Stat(p); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(p, 0666, &bolt.Options{ReadOnly: readOnly})
 	if err != nil {
 		return nil, err
 	}
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(chunkBucket)
-		if err != nil {
+	if readOnly {
+		err = db.View(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{chunkBucket, cameraBucket, worldBucket} {
+				if tx.Bucket(name) == nil {
+					return fmt.Errorf("%s has no %s bucket, play it once to create it", p, name)
+				}
+			}
+			return nil
+		})
+	} else {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(chunkBucket)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucketIfNotExists(cameraBucket)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucketIfNotExists(worldBucket)
 			return err
-		}
-		_, err = tx.CreateBucketIfNotExists(cameraBucket)
-		return err
-	})
+		})
+	}
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	db.NoSync = true
-	return &Store{
-		db: db,
-	}, nil
+	s := &Store{
+		db:      db,
+		pending: make(map[ChunkID]map[BlockID]BlockType),
+		flushc:  make(chan struct{}, 1),
+		closec:  make(chan struct{}),
+		done:    make(chan struct{}),
+		errc:    make(chan error, 16),
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+// UpdateBlock queues the edit, it is committed later by the write loop
+func (s *Store) UpdateBlock(bid BlockID, w BlockType) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return errStoreClosed
+	}
+	s.queueBlock(bid, w)
+	full := s.npending >= storeFlushBlocks
+	s.mutex.Unlock()
+
+	if full {
+		select {
+		case s.flushc <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// called with s.mutex locked
+func (s *Store) queueBlock(bid BlockID, w BlockType) {
+	cid := bid.ChunkID()
+	blocks, ok := s.pending[cid]
+	if !ok {
+		blocks = make(map[BlockID]BlockType)
+		s.pending[cid] = blocks
+	}
+	if _, ok := blocks[bid]; !ok {
+		s.npending++
+	}
+	blocks[bid] = w
+}
+
+// Errors reports errors of background writes, errors are dropped if nobody reads them
+func (s *Store) Errors() <-chan error {
+	return s.errc
+}
+
+func (s *Store) writeLoop() {
+	defer close(s.done)
+	tick := time.NewTicker(storeFlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-s.flushc:
+		case <-s.closec:
+			return
+		}
+		if err := s.Flush(); err != nil {
+			select {
+			case s.errc <- err:
+			default:
+				log.Printf("store write error:%s", err)
+			}
+		}
+	}
 }
 
-func (s *Store) UpdateChunk(cid ChunkID, blocks []BlockType) error {
+// Flush commits all queued block edits in one transaction
+func (s *Store) Flush() error {
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+
+	s.mutex.Lock()
+	batch, n := s.pending, s.npending
+	if n == 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.flushing = batch
+	s.commits++
+	s.pending = make(map[ChunkID]map[BlockID]BlockType)
+	s.npending = 0
+	s.mutex.Unlock()
+
+	err := s.putBlocks(batch)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushing = nil
+	s.commits++
+	if err != nil {
+		s.requeue(batch)
+		return err
+	}
+	log.Printf("flush %d blocks in %d chunks", n, len(batch))
+	return nil
+}
+
+// UpdateBlocks commits edits of many chunks in one transaction, without waiting for the write loop.
+// Queued edits of the same blocks are older, they are dropped
+func (s *Store) UpdateBlocks(edits map[ChunkID]map[BlockID]BlockType) error {
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return errStoreClosed
+	}
+	dropped := make(map[ChunkID]map[BlockID]BlockType)
+	for cid, blocks := range edits {
+		queued, ok := s.pending[cid]
+		if !ok {
+			continue
+		}
+		for bid := range blocks {
+			if w, ok := queued[bid]; ok {
+				if dropped[cid] == nil {
+					dropped[cid] = make(map[BlockID]BlockType)
+				}
+				dropped[cid][bid] = w
+				delete(queued, bid)
+				s.npending--
+			}
+		}
+		if len(queued) == 0 {
+			delete(s.pending, cid)
+		}
+	}
+	s.flushing = edits
+	s.commits++
+	s.mutex.Unlock()
+
+	err := s.putBlocks(edits)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushing = nil
+	s.commits++
+	if err != nil {
+		s.requeue(dropped)
+	}
+	return err
+}
+
+// putBlocks commits edits in one transaction
+func (s *Store) putBlocks(edits map[ChunkID]map[BlockID]BlockType) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		log.Printf("put chunk[%d]", cid)
 		bkt := tx.Bucket(chunkBucket)
-		key := encodeChunkDbKey(cid)
-		value, err := encodeChunkDbValue(blocks)
-		if err != nil {
-			return err
+		for cid, blocks := range edits {
+			key := encodeChunkDbKey(cid)
+			overrides, err := chunkOverrides(bkt.Get(key))
+			if err != nil {
+				return fmt.Errorf("chunk %v:%s", cid, err)
+			}
+			for bid, w := range blocks {
+				overrides[bid.ToIndex()] = w
+			}
+			value, err := encodeOverridesDbValue(overrides)
+			if err != nil {
+				return err
+			}
+			if err := bkt.Put(key, value); err != nil {
+				return err
+			}
 		}
-		return bkt.Put(key, value)
+		return nil
 	})
 }
 
-// func (s *Store) UpdateBlock(bid BlockID, w BlockType) error {
-// 	return s.db.Update(func(tx *bolt.Tx) error {
-// 		log.Printf("put %v -> %d", bid, w)
-// 		bkt := tx.Bucket(blockBucket)
-// 		cid := bid.ChunkID()
-// 		key := encodeBlockDbKey(cid, bid)
-// 		value := encodeBlockDbValue(w)
-// 		return bkt.Put(key, value)
-// 	})
-// }
+// requeue queues edits which were not committed, newer edits of the same block win,
+// called with s.mutex locked
+func (s *Store) requeue(edits map[ChunkID]map[BlockID]BlockType) {
+	for cid, blocks := range edits {
+		for bid, w := range blocks {
+			if _, ok := s.pending[cid][bid]; !ok {
+				s.queueBlock(bid, w)
+			}
+		}
+	}
+}
 
 func (s *Store) UpdateCamera(pos mgl32.Vec3, rx, ry float32) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
@@ -97,8 +335,15 @@ func (s *Store) UpdateCamera(pos mgl32.Vec3, rx, ry float32) error {
 }
 
 func (s *Store) GetCamera() (mgl32.Vec3, float32, float32) {
-	var pos = mgl32.Vec3{0, 16, 0}
-	var rx, ry float32
+	pos, rx, ry, ok := s.camera()
+	if !ok {
+		return mgl32.Vec3{0, 16, 0}, 0, 0
+	}
+	return pos, rx, ry
+}
+
+// camera returns the saved camera, ok is false if it was never saved
+func (s *Store) camera() (pos mgl32.Vec3, rx, ry float32, ok bool) {
 	s.db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(cameraBucket)
 		value := bkt.Get(cameraBucket)
@@ -109,52 +354,185 @@ func (s *Store) GetCamera() (mgl32.Vec3, float32, float32) {
 		binary.Read(buf, binary.LittleEndian, &pos)
 		binary.Read(buf, binary.LittleEndian, &rx)
 		binary.Read(buf, binary.LittleEndian, &ry)
+		ok = true
 		return nil
 	})
-	return pos, rx, ry
+	return
 }
 
-func (s *Store) ChunkBlocks(cid ChunkID) ([]BlockType, error) {
-	var blocks []BlockType
-	err := s.db.View(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(chunkBucket)
-		key := encodeChunkDbKey(cid)
-		value := bkt.Get(key)
-		if value == nil {
+// GeneratorMeta returns the generator name and seed of the world, ok is false if not saved
+func (s *Store) GeneratorMeta() (name string, seed int64, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(worldBucket)
+		n, sd := bkt.Get(generatorKey), bkt.Get(seedKey)
+		if n == nil || sd == nil {
 			return nil
 		}
+		if len(sd) != 8 {
+			return fmt.Errorf("bad seed length:%d", len(sd))
+		}
+		name, seed, ok = string(n), int64(binary.LittleEndian.Uint64(sd)), true
+		return nil
+	})
+	return
+}
+
+func (s *Store) SaveGeneratorMeta(name string, seed int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(worldBucket)
+		sd := make([]byte, 8)
+		binary.LittleEndian.PutUint64(sd, uint64(seed))
+		err := bkt.Put(generatorKey, []byte(name))
+		if err != nil {
+			return err
+		}
+		return bkt.Put(seedKey, sd)
+	})
+}
 
-		blocks = decodeChunkDbValue(value)
+// HasChunks reports whether any chunk is saved
+func (s *Store) HasChunks() (bool, error) {
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(chunkBucket).Cursor().First()
+		ok = k != nil
 		return nil
 	})
+	return ok, err
+}
 
-	if err != nil {
-		return nil, err
+// RangeBlocks reads saved edits of chunk id with queued ones over them, without waiting for commits
+func (s *Store) RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error {
+	var (
+		queued    []map[BlockID]BlockType
+		overrides []BlockType
+	)
+	for {
+		queued = queued[:0]
+		s.mutex.Lock()
+		commits := s.commits
+		for _, m := range []map[ChunkID]map[BlockID]BlockType{s.flushing, s.pending} {
+			if blocks, ok := m[id]; ok {
+				copied := make(map[BlockID]BlockType, len(blocks))
+				for bid, w := range blocks {
+					copied[bid] = w
+				}
+				queued = append(queued, copied)
+			}
+		}
+		s.mutex.Unlock()
+
+		overrides = nil
+		err := s.db.View(func(tx *bolt.Tx) error {
+			bkt := tx.Bucket(chunkBucket)
+			value := bkt.Get(encodeChunkDbKey(id))
+			if value == nil {
+				return nil
+			}
+
+			var err error
+			overrides, err = decodeOverridesDbValue(value)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// edits queued when they were copied may be older than the db, if a commit started or ended since
+		s.mutex.Lock()
+		done := commits == s.commits
+		s.mutex.Unlock()
+		if done {
+			break
+		}
 	}
 
-	return blocks, nil
+	if len(queued) != 0 && len(overrides) == 0 {
+		overrides = newOverrides()
+	}
+	for _, blocks := range queued {
+		for bid, w := range blocks {
+			overrides[bid.ToIndex()] = w
+		}
+	}
+	rangeOverrides(id, overrides, f)
+	return nil
 }
 
-// func (s *Store) RangeBlocks(id ChunkID, f func(bid BlockID, w BlockType)) error {
-// 	return s.db.View(func(tx *bolt.Tx) error {
-// 		bkt := tx.Bucket(blockBucket)
-// 		startkey := encodeBlockDbKey(id, BlockID{0, 0, 0})
-// 		iter := bkt.Cursor()
-// 		for k, v := iter.Seek(startkey); k != nil; k, v = iter.Next() {
-// 			cid, bid := decodeBlockDbKey(k)
-// 			if cid != id {
-// 				break
-// 			}
-// 			w := decodeBlockDbValue(v)
-// 			f(bid, w)
-// 		}
-// 		return nil
-// 	})
-// }
+// MigrateChunks converts full chunk records written by old versions
+// into overrides of the blocks generated by gen
+func (s *Store) MigrateChunks(gen func(ChunkID) []BlockType) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(chunkBucket)
+		var keys [][]byte
+		err := bkt.ForEach(func(k, v []byte) error {
+			if len(v) > 0 && v[0] != chunkFormatOverrides {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			cid := decodeChunkDbKey(k)
+			blocks, err := decodeChunkDbValue(bkt.Get(k))
+			if err != nil {
+				return fmt.Errorf("migrate chunk %v:%s", cid, err)
+			}
+			if len(blocks) == 0 {
+				blocks = make([]BlockType, chunkBlockCount)
+			}
+
+			generated := gen(cid)
+			overrides := newOverrides()
+			changed := 0
+			for i, w := range blocks {
+				if w != generated[i] {
+					overrides[i] = w
+					changed++
+				}
+			}
+
+			log.Printf("migrate chunk %v, %d blocks changed", cid, changed)
+			if changed == 0 {
+				if err := bkt.Delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := encodeOverridesDbValue(overrides)
+			if err != nil {
+				return err
+			}
+			if err := bkt.Put(k, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-func (s *Store) Close() {
+// Close commits all queued edits and closes db
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return errStoreClosed
+	}
+	s.closed = true
+	s.mutex.Unlock()
+
+	close(s.closec)
+	<-s.done
+	err := s.Flush()
+	close(s.errc)
 	s.db.Sync()
-	s.db.Close()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func encodeChunkDbKey(cid ChunkID) []byte {
@@ -163,13 +541,6 @@ func encodeChunkDbKey(cid ChunkID) []byte {
 	return buf.Bytes()
 }
 
-// func encodeBlockDbKey(cid ChunkID, bid BlockID) []byte {
-// 	buf := new(bytes.Buffer)
-// 	binary.Write(buf, binary.LittleEndian, [...]int32{int32(cid.X), int32(cid.Z)})
-// 	binary.Write(buf, binary.LittleEndian, [...]int32{int32(bid.X), int32(bid.Y), int32(bid.Z)})
-// 	return buf.Bytes()
-// }
-
 func decodeChunkDbKey(b []byte) ChunkID {
 	if len(b) != 4*3 {
 		log.Panicf("abd db key length:%d", len(b))
@@ -182,78 +553,195 @@ func decodeChunkDbKey(b []byte) ChunkID {
 	return cid
 }
 
-// func decodeBlockDbKey(b []byte) (ChunkID, BlockID) {
-// 	if len(b) != 4*5 {
-// 		log.Panicf("bad db key length:%d", len(b))
-// 	}
-// 	buf := bytes.NewBuffer(b)
-// 	var arr [5]int32
-// 	binary.Read(buf, binary.LittleEndian, &arr)
+// first byte of a chunk value is the format version
+const (
+	chunkFormatEmpty   = 0 // chunk without any block
+	chunkFormatRaw     = 1 // raw little-endian blocks, 2 bytes per block
+	chunkFormatPalette = 2 // block palette + run-length encoded palette indexes
 
-// 	cid := ChunkID{int(arr[0]), 0, int(arr[1])}
-// 	bid := BlockID{int(arr[2]), int(arr[3]), int(arr[4])}
-// 	if bid.ChunkID() != cid {
-// 		log.Panicf("bad db key: cid:%v, bid:%v", cid, bid)
-// 	}
-// 	return cid, bid
-// }
+	// same as chunkFormatPalette, but blocks are overrides of generated blocks
+	chunkFormatOverrides = 3
+)
 
-func encodeChunkDbValue(blocks []BlockType) ([]byte, error) {
-	// first byte of value indicate emptyness of chunk (0 == empty, other = has block)
+// noOverride marks a block which keeps the generated value
+const noOverride BlockType = math.MaxUint16
+
+const chunkBlockCount = ChunkWidth * ChunkWidth * ChunkWidth
 
+func encodeChunkDbValue(blocks []BlockType) ([]byte, error) {
 	if len(blocks) == 0 {
-		return []byte{0}, nil
+		return []byte{chunkFormatEmpty}, nil
 	}
+	return encodePaletteValue(chunkFormatPalette, blocks)
+}
 
-	value := make([]byte, 0, (ChunkWidth*ChunkWidth*ChunkWidth)*2+1)
-	buff := bytes.NewBuffer(value)
-	err := buff.WriteByte(1)
-	if err != nil {
-		return nil, err
+func encodeOverridesDbValue(overrides []BlockType) ([]byte, error) {
+	return encodePaletteValue(chunkFormatOverrides, overrides)
+}
+
+// encodePaletteValue encodes blocks as
+// [version][palette size][palette blocks...][run length, palette index]...
+// all numbers after version are uvarints.
+func encodePaletteValue(version byte, blocks []BlockType) ([]byte, error) {
+	if len(blocks) != chunkBlockCount {
+		return nil, fmt.Errorf("bad chunk block count:%d", len(blocks))
 	}
 
-	err = binary.Write(buff, binary.LittleEndian, blocks)
-	if err != nil {
-		return nil, err
+	var palette []BlockType
+	index := make(map[BlockType]uint64)
+	for _, w := range blocks {
+		if _, ok := index[w]; !ok {
+			index[w] = uint64(len(palette))
+			palette = append(palette, w)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(version)
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) {
+		n := binary.PutUvarint(tmp[:], x)
+		buf.Write(tmp[:n])
 	}
 
-	return buff.Bytes(), nil
+	putUvarint(uint64(len(palette)))
+	for _, w := range palette {
+		putUvarint(uint64(w))
+	}
+
+	for i := 0; i < len(blocks); {
+		j := i + 1
+		for j < len(blocks) && blocks[j] == blocks[i] {
+			j++
+		}
+		putUvarint(uint64(j - i))
+		putUvarint(index[blocks[i]])
+		i = j
+	}
+	return buf.Bytes(), nil
 }
 
-// func encodeBlockDbValue(w BlockType) []byte {
-// 	value := make([]byte, 2)
-// 	binary.LittleEndian.PutUint16(value, uint16(w))
-// 	return value
-// }
+// decodeChunkDbValue decodes full chunk written by old versions
+func decodeChunkDbValue(b []byte) ([]BlockType, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty chunk value")
+	}
+
+	switch b[0] {
+	case chunkFormatEmpty:
+		return nil, nil
+	case chunkFormatRaw:
+		return decodeRawChunk(b[1:])
+	case chunkFormatPalette:
+		return decodePaletteChunk(b[1:])
+	default:
+		return nil, fmt.Errorf("unknown chunk format version:%d", b[0])
+	}
+}
 
-func decodeChunkDbValue(b []byte) []BlockType {
+func decodeOverridesDbValue(b []byte) ([]BlockType, error) {
 	if len(b) == 0 {
-		log.Panic("len(b) == 0")
+		return nil, errors.New("empty chunk value")
 	}
+	if b[0] != chunkFormatOverrides {
+		return nil, fmt.Errorf("chunk format version %d is not overrides", b[0])
+	}
+	return decodePaletteChunk(b[1:])
+}
 
-	buff := bytes.NewBuffer(b)
-	header, err := buff.ReadByte()
+func decodeRawChunk(b []byte) ([]BlockType, error) {
+	if len(b) != chunkBlockCount*2 {
+		return nil, fmt.Errorf("raw chunk len[%d] is different from expected", len(b))
+	}
+
+	bts := make([]BlockType, chunkBlockCount)
+	err := binary.Read(bytes.NewReader(b), binary.LittleEndian, bts)
 	if err != nil {
-		log.Panicf("error. %s", err.Error())
+		return nil, err
 	}
+	return bts, nil
+}
 
-	if header == 0 {
-		return nil
+func decodePaletteChunk(b []byte) ([]BlockType, error) {
+	r := bytes.NewReader(b)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read palette size:%s", err)
+	}
+	if n == 0 || n > chunkBlockCount {
+		return nil, fmt.Errorf("bad palette size:%d", n)
 	}
 
-	if len(b) != (ChunkWidth*ChunkWidth*ChunkWidth)*2+1 {
-		log.Panicf("slice len[%d] is different from expected", len(b))
+	palette := make([]BlockType, n)
+	for i := range palette {
+		w, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read palette:%s", err)
+		}
+		if w > math.MaxUint16 {
+			return nil, fmt.Errorf("bad palette block:%d", w)
+		}
+		palette[i] = BlockType(w)
 	}
 
-	bts := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
-	binary.Read(buff, binary.LittleEndian, bts)
+	bts := make([]BlockType, chunkBlockCount)
+	for i := 0; i < len(bts); {
+		run, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read run length:%s", err)
+		}
+		idx, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read palette index:%s", err)
+		}
+		if run == 0 || run > uint64(len(bts)-i) {
+			return nil, fmt.Errorf("bad run length:%d at %d", run, i)
+		}
+		if idx >= n {
+			return nil, fmt.Errorf("bad palette index:%d", idx)
+		}
+		w := palette[idx]
+		for end := i + int(run); i < end; i++ {
+			bts[i] = w
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes in chunk value", r.Len())
+	}
+
+	return bts, nil
+}
+
+func newOverrides() []BlockType {
+	overrides := make([]BlockType, chunkBlockCount)
+	for i := range overrides {
+		overrides[i] = noOverride
+	}
+	return overrides
+}
 
-	return bts
+// chunkOverrides decodes a chunk record value, nil value means no override
+func chunkOverrides(value []byte) ([]BlockType, error) {
+	if value == nil {
+		return newOverrides(), nil
+	}
+	return decodeOverridesDbValue(value)
 }
 
-func decodeBlockDbValue(b []byte) BlockType {
-	if len(b) != 2 {
-		log.Panicf("bad db value length:%d", len(b))
+func rangeOverrides(id ChunkID, overrides []BlockType, f func(bid BlockID, w BlockType)) {
+	if len(overrides) == 0 {
+		return
+	}
+	sx, sy, sz := id.X*ChunkWidth, id.Y*ChunkWidth, id.Z*ChunkWidth
+	for z := 0; z < ChunkWidth; z++ {
+		for y := 0; y < ChunkWidth; y++ {
+			for x := 0; x < ChunkWidth; x++ {
+				bid := BlockID{x + sx, y + sy, z + sz}
+				w := overrides[bid.ToIndex()]
+				if w != noOverride {
+					f(bid, w)
+				}
+			}
+		}
 	}
-	return BlockType(binary.LittleEndian.Uint16(b))
 }
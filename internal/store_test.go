@@ -1,7 +1,13 @@
 package internal
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,9 +30,373 @@ func TestStore_Encode_Decode_ChunkValue(t *testing.T) {
 
 	b, err := encodeChunkDbValue(blocks)
 	assert.Nil(t, err)
-	assert.Equal(t, ChunkWidth*ChunkWidth*ChunkWidth*2+1, len(b))
-	assert.Equal(t, []byte{1, 1, 0, 2, 0}, b[:5])
+	assert.Equal(t, byte(chunkFormatPalette), b[0])
+	assert.True(t, len(b) < 32, "encoded len %d", len(b))
+
+	decoded, err := decodeChunkDbValue(b)
+	assert.Nil(t, err)
+	assert.Equal(t, blocks, decoded)
+}
+
+func TestStore_Encode_Decode_EmptyChunkValue(t *testing.T) {
+	b, err := encodeChunkDbValue(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{chunkFormatEmpty}, b)
+
+	decoded, err := decodeChunkDbValue(b)
+	assert.Nil(t, err)
+	assert.Nil(t, decoded)
+}
+
+func TestStore_Encode_Decode_GeneratedChunkValue(t *testing.T) {
+	blocks := classicTestChunk(ChunkID{0, 0, 0})
+
+	b, err := encodeChunkDbValue(blocks)
+	assert.Nil(t, err)
+	assert.True(t, len(b) < len(blocks), "encoded len %d", len(b))
 
-	decoded := decodeChunkDbValue(b)
+	decoded, err := decodeChunkDbValue(b)
+	assert.Nil(t, err)
 	assert.Equal(t, blocks, decoded)
 }
+
+func TestStore_Decode_RawChunkValue(t *testing.T) {
+	blocks := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+	blocks[0] = 1
+	blocks[1] = 2
+	blocks[len(blocks)-1] = 9
+
+	b := make([]byte, 1, ChunkWidth*ChunkWidth*ChunkWidth*2+1)
+	b[0] = chunkFormatRaw
+	for _, w := range blocks {
+		b = append(b, byte(w), byte(w>>8))
+	}
+
+	decoded, err := decodeChunkDbValue(b)
+	assert.Nil(t, err)
+	assert.Equal(t, blocks, decoded)
+
+	_, err = decodeChunkDbValue(b[:len(b)-1])
+	assert.NotNil(t, err)
+}
+
+func TestStore_Decode_BadChunkValue(t *testing.T) {
+	_, err := decodeChunkDbValue(nil)
+	assert.NotNil(t, err)
+
+	_, err = decodeChunkDbValue([]byte{99})
+	assert.NotNil(t, err)
+
+	// palette with one block, but runs do not cover the chunk
+	_, err = decodeChunkDbValue([]byte{chunkFormatPalette, 1, 0, 1, 0})
+	assert.NotNil(t, err)
+
+	// palette index out of range
+	_, err = decodeChunkDbValue([]byte{chunkFormatPalette, 1, 0, 0x80, 0x80, 0x02, 1})
+	assert.NotNil(t, err)
+}
+
+func TestStore_Encode_Decode_OverridesValue(t *testing.T) {
+	overrides := newOverrides()
+	overrides[5] = 0
+	overrides[6] = 3
+
+	b, err := encodeOverridesDbValue(overrides)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(chunkFormatOverrides), b[0])
+
+	decoded, err := decodeOverridesDbValue(b)
+	assert.Nil(t, err)
+	assert.Equal(t, overrides, decoded)
+
+	full, err := encodeChunkDbValue(overrides)
+	assert.Nil(t, err)
+	_, err = decodeOverridesDbValue(full)
+	assert.NotNil(t, err)
+}
+
+func newTestStore(t testing.TB) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func rangeStoreBlocks(t *testing.T, store IStore, cid ChunkID) map[BlockID]BlockType {
+	blocks := make(map[BlockID]BlockType)
+	err := store.RangeBlocks(cid, func(bid BlockID, w BlockType) {
+		blocks[bid] = w
+	})
+	assert.Nil(t, err)
+	return blocks
+}
+
+func TestStore_UpdateBlock(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	cid := ChunkID{-1, 0, 2}
+	a := BlockID{-1, 3, 64}
+	b := BlockID{-32, 31, 95}
+	assert.Equal(t, cid, a.ChunkID())
+	assert.Equal(t, cid, b.ChunkID())
+	assert.Empty(t, rangeStoreBlocks(t, store, cid))
+
+	assert.Nil(t, store.UpdateBlock(a, 7))
+	assert.Nil(t, store.UpdateBlock(b, 1))
+	assert.Nil(t, store.UpdateBlock(b, 0))
+	assert.Equal(t, 2, store.npending)
+	assert.Equal(t, map[BlockID]BlockType{a: 7, b: 0}, rangeStoreBlocks(t, store, cid))
+
+	assert.Nil(t, store.Flush())
+	assert.Equal(t, 0, store.npending)
+	assert.Equal(t, map[BlockID]BlockType{a: 7, b: 0}, rangeStoreBlocks(t, store, cid))
+	assert.Empty(t, rangeStoreBlocks(t, store, ChunkID{0, 0, 2}))
+
+	// queued edits overlay committed ones
+	assert.Nil(t, store.UpdateBlock(a, 8))
+	assert.Equal(t, map[BlockID]BlockType{a: 8, b: 0}, rangeStoreBlocks(t, store, cid))
+}
+
+func TestStore_FlushOnSize(t *testing.T) {
+	interval, size := storeFlushInterval, storeFlushBlocks
+	storeFlushInterval, storeFlushBlocks = time.Hour, 4
+	defer func() {
+		storeFlushInterval, storeFlushBlocks = interval, size
+	}()
+
+	store, done := newTestStore(t)
+	defer done()
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, store.UpdateBlock(BlockID{i, 0, 0}, 1))
+	}
+
+	committed := func() bool {
+		var ok bool
+		store.db.View(func(tx *bolt.Tx) error {
+			ok = tx.Bucket(chunkBucket).Get(encodeChunkDbKey(ChunkID{0, 0, 0})) != nil
+			return nil
+		})
+		return ok
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !committed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, committed())
+}
+
+func TestStore_CloseFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "test.db")
+
+	store, err := NewStore(p)
+	assert.Nil(t, err)
+	bid := BlockID{1, 2, 3}
+	assert.Nil(t, store.UpdateBlock(bid, 4))
+	assert.Nil(t, store.Close())
+	assert.Equal(t, errStoreClosed, store.UpdateBlock(bid, 5))
+
+	store, err = NewStore(p)
+	assert.Nil(t, err)
+	defer store.Close()
+	assert.Equal(t, map[BlockID]BlockType{bid: 4}, rangeStoreBlocks(t, store, bid.ChunkID()))
+}
+
+func TestStore_ReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "test.db")
+
+	// the file is not created
+	_, err = NewReadOnlyStore(p)
+	assert.NotNil(t, err)
+	_, err = os.Stat(p)
+	assert.True(t, os.IsNotExist(err))
+
+	store, err := NewStore(p)
+	assert.Nil(t, err)
+	bid := BlockID{1, 2, 3}
+	assert.Nil(t, store.UpdateBlock(bid, 4))
+	assert.Nil(t, store.Close())
+	info, err := os.Stat(p)
+	assert.Nil(t, err)
+
+	store, err = NewReadOnlyStore(p)
+	assert.Nil(t, err)
+	assert.Equal(t, map[BlockID]BlockType{bid: 4}, rangeStoreBlocks(t, store, bid.ChunkID()))
+	assert.NotNil(t, store.SaveGeneratorMeta("flat", 1))
+	assert.Nil(t, store.UpdateBlock(bid, 5))
+	assert.NotNil(t, store.Flush())
+	store.Close()
+	after, err := os.Stat(p)
+	assert.Nil(t, err)
+	assert.Equal(t, info.ModTime(), after.ModTime())
+}
+
+func TestStore_WriteError(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	// broken record makes the commit of this chunk fail
+	bid := BlockID{1, 2, 3}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).Put(encodeChunkDbKey(bid.ChunkID()), []byte{99})
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.UpdateBlock(bid, 4))
+	assert.NotNil(t, store.Flush())
+	// failed edits stay queued
+	assert.Equal(t, 1, store.npending)
+
+	store.flushc <- struct{}{}
+	select {
+	case err := <-store.Errors():
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write error is not reported")
+	}
+}
+
+func TestStore_UpdateBlocks(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	a, b, c := BlockID{1, 2, 3}, BlockID{1, 2, 4}, BlockID{-40, 2, 3}
+	assert.Nil(t, store.UpdateBlock(a, 4))
+	assert.Nil(t, store.UpdateBlock(b, 5))
+	assert.Nil(t, store.UpdateBlocks(map[ChunkID]map[BlockID]BlockType{
+		a.ChunkID(): {a: 6},
+		c.ChunkID(): {c: 0},
+	}))
+	// committed at once, the queued edit of a is older
+	assert.Equal(t, 1, store.npending)
+	assert.Nil(t, store.Flush())
+	assert.Equal(t, map[BlockID]BlockType{a: 6, b: 5}, rangeStoreBlocks(t, store, a.ChunkID()))
+	assert.Equal(t, map[BlockID]BlockType{c: 0}, rangeStoreBlocks(t, store, c.ChunkID()))
+
+	// nothing is committed if a chunk fails, dropped edits are queued again
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(chunkBucket).Put(encodeChunkDbKey(c.ChunkID()), []byte{99})
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, store.UpdateBlock(a, 7))
+	assert.NotNil(t, store.UpdateBlocks(map[ChunkID]map[BlockID]BlockType{
+		a.ChunkID(): {a: 8, b: 8},
+		c.ChunkID(): {c: 8},
+	}))
+	assert.Equal(t, map[BlockID]BlockType{a: 7}, store.pending[a.ChunkID()])
+	assert.Equal(t, 1, store.npending)
+}
+
+func TestStore_ReadDuringCommit(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	a, b := BlockID{1, 2, 3}, BlockID{1, 2, 4}
+	assert.Nil(t, store.UpdateBlock(a, 4))
+	assert.Nil(t, store.Flush())
+	assert.Nil(t, store.UpdateBlock(b, 6))
+
+	// a commit holding the db, readers see its edits without waiting for it
+	tx, err := store.db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.mutex.Lock()
+	store.flushing = map[ChunkID]map[BlockID]BlockType{a.ChunkID(): {a: 5}}
+	store.commits++
+	store.mutex.Unlock()
+	read := make(chan map[BlockID]BlockType)
+	go func() {
+		read <- rangeStoreBlocks(t, store, a.ChunkID())
+	}()
+	select {
+	case blocks := <-read:
+		assert.Equal(t, map[BlockID]BlockType{a: 5, b: 6}, blocks)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read waits for the commit")
+	}
+	tx.Rollback()
+	store.mutex.Lock()
+	store.flushing = nil
+	store.commits++
+	store.mutex.Unlock()
+
+	// nothing to flush leaves nothing being committed
+	assert.Nil(t, store.Flush())
+	assert.Nil(t, store.Flush())
+	assert.Nil(t, store.flushing)
+	assert.Equal(t, map[BlockID]BlockType{a: 4, b: 6}, rangeStoreBlocks(t, store, a.ChunkID()))
+}
+
+func TestStore_MigrateChunks(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	changed, same := ChunkID{0, 0, 0}, ChunkID{1, 0, 0}
+	blocks := classicTestChunk(changed)
+	edit := BlockID{3, 4, 5}
+	blocks[edit.ToIndex()] = 42
+	legacy := make([]byte, 1, len(blocks)*2+1)
+	legacy[0] = chunkFormatRaw
+	for _, w := range blocks {
+		legacy = append(legacy, byte(w), byte(w>>8))
+	}
+	unchanged, err := encodeChunkDbValue(classicTestChunk(same))
+	assert.Nil(t, err)
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(chunkBucket)
+		bkt.Put(encodeChunkDbKey(changed), legacy)
+		return bkt.Put(encodeChunkDbKey(same), unchanged)
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.MigrateChunks(classicTestChunk))
+	assert.Equal(t, map[BlockID]BlockType{edit: 42}, rangeStoreBlocks(t, store, changed))
+	assert.Empty(t, rangeStoreBlocks(t, store, same))
+
+	// migrated records are left alone
+	assert.Nil(t, store.MigrateChunks(classicTestChunk))
+	assert.Equal(t, map[BlockID]BlockType{edit: 42}, rangeStoreBlocks(t, store, changed))
+}
+
+func classicTestChunk(cid ChunkID) []BlockType {
+	gen, _ := NewGenerator(classicGeneratorName, 0)
+	return gen.Chunk(cid)
+}
+
+func TestStore_GeneratorMeta(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+
+	_, _, ok, err := store.GeneratorMeta()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, store.SaveGeneratorMeta("classic", -42))
+	name, seed, ok, err := store.GeneratorMeta()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "classic", name)
+	assert.Equal(t, int64(-42), seed)
+}
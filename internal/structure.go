@@ -0,0 +1,224 @@
+package internal
+
+// blocks used by structures
+const (
+	brickBlock  BlockType = 4
+	plankBlock  BlockType = 8
+	cobbleBlock BlockType = 11
+)
+
+// structure : feature on the terrain, like a tree.
+// It is placed by every chunk it touches, so it can span chunk borders,
+// but must stay within one chunk column of its origin.
+type structure interface {
+	place(w *chunkWriter)
+}
+
+// chunkWriter writes blocks at world positions into a chunk, positions outside the chunk are ignored
+type chunkWriter struct {
+	cid ChunkID
+	m   []BlockType
+}
+
+func (w *chunkWriter) index(x, y, z int) (int, bool) {
+	bid := BlockID{x, y, z}
+	if bid.ChunkID() != w.cid {
+		return 0, false
+	}
+	return bid.ToIndex(), true
+}
+
+func (w *chunkWriter) set(x, y, z int, b BlockType) {
+	if i, ok := w.index(x, y, z); ok {
+		w.m[i] = b
+	}
+}
+
+// fill sets block only in air or plant
+func (w *chunkWriter) fill(x, y, z int, b BlockType) {
+	if i, ok := w.index(x, y, z); ok && (w.m[i] == 0 || w.m[i].IsPlant()) {
+		w.m[i] = b
+	}
+}
+
+// placeStructures writes structures of this and neighbour chunk columns into m
+func (g *biomeGenerator) placeStructures(cid ChunkID, m []BlockType) {
+	w := &chunkWriter{cid: cid, m: m}
+	for ox := -1; ox <= 1; ox++ {
+		for oz := -1; oz <= 1; oz++ {
+			for _, s := range g.structures(cid.X+ox, cid.Z+oz) {
+				s.place(w)
+			}
+		}
+	}
+}
+
+// structures returns structures whose origin is in chunk column p, q,
+// they only depend on seed and column, so all chunks agree on them
+func (g *biomeGenerator) structures(p, q int) []structure {
+	var ss []structure
+	cols := g.chunkColumns(p, q)
+	for dz := 0; dz < ChunkWidth; dz++ {
+		for dx := 0; dx < ChunkWidth; dx++ {
+			x, z := p*ChunkWidth+dx, q*ChunkWidth+dz
+			col := cols[dx+dz*ChunkWidth]
+			desc := &biomes[col.biome]
+			r := hashFloat(g.seed+10, x, 0, z)
+			if r >= desc.trees+desc.boulders {
+				continue
+			}
+
+			h := col.surfaceHeight()
+			if g.ravine(x, h, z, h) {
+				continue
+			}
+			seed := int64(hash3(g.seed+11, x, h, z))
+			if r < desc.trees {
+				if surface, _ := columnBlocks(col); surface == grassBlock || surface == snowBlock {
+					ss = append(ss, newTree(x, h+1, z, desc.pines, seed))
+				}
+			} else {
+				ss = append(ss, &boulder{x: x, y: h, z: z, radius: 2 + int(hashFloat(seed, 0, 0, 0)*3), seed: seed})
+			}
+		}
+	}
+
+	// at most one ruin in a chunk column
+	if hashFloat(g.seed+12, p, 0, q) < ruinChance {
+		seed := int64(hash3(g.seed+13, p, 0, q))
+		dx, dz := int(hashFloat(seed, 0, 0, 0)*ChunkWidth), int(hashFloat(seed, 1, 0, 0)*ChunkWidth)
+		col := cols[dx+dz*ChunkWidth]
+		if col.biome != BiomeMountains && col.height > seaLevel {
+			ss = append(ss, &ruin{
+				x:     p*ChunkWidth + dx,
+				y:     col.height,
+				z:     q*ChunkWidth + dz,
+				width: 7 + int(hashFloat(seed, 2, 0, 0)*7),
+				depth: 7 + int(hashFloat(seed, 3, 0, 0)*7),
+				seed:  seed,
+			})
+		}
+	}
+	return ss
+}
+
+// tree : wood trunk with round leaves, or a cone of leaves for pines
+type tree struct {
+	x, y, z int // bottom of trunk
+	height  int
+	radius  int
+	pine    bool
+	seed    int64
+}
+
+func newTree(x, y, z int, pine bool, seed int64) *tree {
+	t := &tree{x: x, y: y, z: z, pine: pine, seed: seed}
+	if pine {
+		t.height = 7 + int(hashFloat(seed, 0, 0, 0)*4)
+		t.radius = 3
+	} else {
+		t.height = 4 + int(hashFloat(seed, 0, 0, 0)*3)
+		t.radius = 2 + int(hashFloat(seed, 1, 0, 0)*2)
+	}
+	return t
+}
+
+func (t *tree) place(w *chunkWriter) {
+	top := t.y + t.height
+	if t.pine {
+		// leaves from 3 blocks above ground, radius shrinks to the top
+		for y := t.y + 3; y <= top; y++ {
+			r := t.radius * (top - y + 1) / (top - t.y - 2)
+			for ox := -r; ox <= r; ox++ {
+				for oz := -r; oz <= r; oz++ {
+					if ox*ox+oz*oz <= r*r {
+						w.fill(t.x+ox, y, t.z+oz, leavesBlock)
+					}
+				}
+			}
+		}
+	} else {
+		r := t.radius
+		cy := top - 1
+		for ox := -r; ox <= r; ox++ {
+			for oy := -r; oy <= r; oy++ {
+				for oz := -r; oz <= r; oz++ {
+					d := ox*ox + oy*oy + oz*oz
+					// ragged border
+					if d < r*r || (d <= r*r+1 && hashFloat(t.seed, ox, oy, oz) < 0.5) {
+						w.fill(t.x+ox, cy+oy, t.z+oz, leavesBlock)
+					}
+				}
+			}
+		}
+	}
+	for y := t.y; y < top; y++ {
+		w.set(t.x, y, t.z, woodBlock)
+	}
+}
+
+// boulder : flattened ball of stone sunk into the ground
+type boulder struct {
+	x, y, z int
+	radius  int
+	seed    int64
+}
+
+func (b *boulder) place(w *chunkWriter) {
+	r := b.radius
+	for ox := -r; ox <= r; ox++ {
+		for oy := -r; oy <= r; oy++ {
+			for oz := -r; oz <= r; oz++ {
+				// half height
+				if ox*ox+4*oy*oy+oz*oz > r*r {
+					continue
+				}
+				block := cobbleBlock
+				if hashFloat(b.seed, ox, oy, oz) < 0.3 {
+					block = stoneBlock
+				}
+				w.set(b.x+ox, b.y+oy, b.z+oz, block)
+			}
+		}
+	}
+}
+
+// one of ruinChance chunk columns has a ruin
+const ruinChance = 1.0 / 24
+
+// ruin : floor and broken walls of an old building
+type ruin struct {
+	x, y, z      int // corner at floor level
+	width, depth int
+	seed         int64
+}
+
+func (r *ruin) place(w *chunkWriter) {
+	const wallHeight = 4
+	for x := r.x; x < r.x+r.width; x++ {
+		for z := r.z; z < r.z+r.depth; z++ {
+			// foundation down to the ground, floor, and clear the inside
+			for y := r.y - 3; y < r.y; y++ {
+				w.fill(x, y, z, cobbleBlock)
+			}
+			w.set(x, r.y, z, plankBlock)
+			for y := r.y + 1; y <= r.y+wallHeight; y++ {
+				w.set(x, y, z, 0)
+			}
+
+			wall := x == r.x || x == r.x+r.width-1 || z == r.z || z == r.z+r.depth-1
+			if !wall {
+				continue
+			}
+			w.set(x, r.y, z, cobbleBlock)
+			height := int(hashFloat(r.seed, x, 0, z) * (wallHeight + 1))
+			for y := r.y + 1; y <= r.y+height; y++ {
+				block := brickBlock
+				if hashFloat(r.seed, x, y, z) < 0.35 {
+					block = cobbleBlock
+				}
+				w.set(x, y, z, block)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBiomeGenerator_TreeAcrossBorder(t *testing.T) {
+	gen := newBiomeGenerator(3).(*biomeGenerator)
+
+	// find a tree whose leaves cross the border of its chunk
+	var tr *tree
+	for p := 0; p < 64 && tr == nil; p++ {
+		for _, s := range gen.structures(p, 0) {
+			if s, ok := s.(*tree); ok {
+				dx := s.x - p*ChunkWidth
+				if !s.pine && dx+s.radius >= ChunkWidth {
+					tr = s
+					break
+				}
+			}
+		}
+	}
+	if !assert.NotNil(t, tr, "no tree on a chunk border") {
+		return
+	}
+
+	block := func(x, y, z int) BlockType {
+		bid := BlockID{x, y, z}
+		return gen.Chunk(bid.ChunkID())[bid.ToIndex()]
+	}
+	// whole trunk of wood, standing on the ground
+	for y := tr.y; y < tr.y+tr.height; y++ {
+		assert.Equal(t, woodBlock, block(tr.x, y, tr.z), "trunk at y %d", y)
+	}
+	assert.NotEqual(t, BlockType(0), block(tr.x, tr.y-1, tr.z))
+	// leaves continue in the neighbour chunk
+	top := tr.y + tr.height - 1
+	assert.Equal(t, leavesBlock, block(tr.x+1, top, tr.z))
+	assert.Equal(t, leavesBlock, block(tr.x+tr.radius-1, top, tr.z))
+	assert.NotEqual(t, BlockID{tr.x, 0, tr.z}.ChunkID(), BlockID{tr.x + tr.radius, 0, tr.z}.ChunkID())
+}
+
+func TestChunkWriter(t *testing.T) {
+	cid := ChunkID{1, 0, -1}
+	w := &chunkWriter{cid: cid, m: make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)}
+	in := BlockID{ChunkWidth, 3, -1}
+	w.set(in.X, in.Y, in.Z, brickBlock)
+	// outside of the chunk is ignored
+	w.set(ChunkWidth-1, 3, -1, brickBlock)
+	assert.Equal(t, brickBlock, w.m[in.ToIndex()])
+	assert.Equal(t, 1, func() (n int) {
+		for _, b := range w.m {
+			if b != 0 {
+				n++
+			}
+		}
+		return n
+	}())
+
+	// fill keeps solid blocks and replaces plants
+	w.fill(in.X, in.Y, in.Z, leavesBlock)
+	assert.Equal(t, brickBlock, w.m[in.ToIndex()])
+	w.m[in.ToIndex()] = tallGrass
+	w.fill(in.X, in.Y, in.Z, leavesBlock)
+	assert.Equal(t, leavesBlock, w.m[in.ToIndex()])
+}
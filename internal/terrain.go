@@ -0,0 +1,254 @@
+package internal
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// blocks used by generators
+const (
+	grassBlock  BlockType = 1
+	sandBlock   BlockType = 2
+	stoneBlock  BlockType = 3
+	woodBlock   BlockType = 5
+	dirtBlock   BlockType = 7
+	snowBlock   BlockType = 9
+	bottomBlock BlockType = 13
+	leavesBlock BlockType = 15
+	cloudBlock  BlockType = 16
+	tallGrass   BlockType = 17
+)
+
+const (
+	biomeGeneratorName = "biome"
+
+	// columns at or below sea level become sand beaches
+	seaLevel = 12
+)
+
+func init() {
+	RegisterGenerator(biomeGeneratorName, newBiomeGenerator)
+}
+
+// biomeGenerator : terrain shaped by temperature, humidity and mountain noise fields
+type biomeGenerator struct {
+	seed int64
+
+	height      *Noise
+	temperature *Noise
+	humidity    *Noise
+	mountain    *Noise
+	cloud       *Noise
+	tunnelA     *Noise
+	tunnelB     *Noise
+	cavern      *Noise
+	ravineLine  *Noise
+	ravineMask  *Noise
+
+	columns *lru.Cache // map[[2]int]*terrainColumns
+}
+
+func newBiomeGenerator(seed int64) Generator {
+	columns, _ := lru.New(1024)
+	return &biomeGenerator{
+		seed:        seed,
+		height:      NewNoise(seed),
+		temperature: NewNoise(seed + 1),
+		humidity:    NewNoise(seed + 2),
+		mountain:    NewNoise(seed + 3),
+		cloud:       NewNoise(seed + 4),
+		tunnelA:     NewNoise(seed + 5),
+		tunnelB:     NewNoise(seed + 6),
+		cavern:      NewNoise(seed + 7),
+		ravineLine:  NewNoise(seed + 8),
+		ravineMask:  NewNoise(seed + 9),
+		columns:     columns,
+	}
+}
+
+func (g *biomeGenerator) Name() string {
+	return biomeGeneratorName
+}
+
+func (g *biomeGenerator) Seed() int64 {
+	return g.seed
+}
+
+type terrainColumn struct {
+	height int // y of the surface block
+	biome  Biome
+}
+
+// terrainColumns : columns of a chunk, indexed by dx + dz*ChunkWidth
+type terrainColumns [ChunkWidth * ChunkWidth]terrainColumn
+
+func (g *biomeGenerator) Biome(x, z int) Biome {
+	cid := BlockID{x, 0, z}.ChunkID()
+	if cols, ok := g.columns.Get([2]int{cid.X, cid.Z}); ok {
+		return cols.(*terrainColumns)[x-cid.X*ChunkWidth+(z-cid.Z*ChunkWidth)*ChunkWidth].biome
+	}
+	return g.climate(x, z)
+}
+
+func (g *biomeGenerator) chunkColumns(p, q int) *terrainColumns {
+	key := [2]int{p, q}
+	if cols, ok := g.columns.Get(key); ok {
+		return cols.(*terrainColumns)
+	}
+	cols := new(terrainColumns)
+	for dz := 0; dz < ChunkWidth; dz++ {
+		for dx := 0; dx < ChunkWidth; dx++ {
+			cols[dx+dz*ChunkWidth] = g.column(p*ChunkWidth+dx, q*ChunkWidth+dz)
+		}
+	}
+	g.columns.Add(key, cols)
+	return cols
+}
+
+func (g *biomeGenerator) climate(x, z int) Biome {
+	fx, fz := float32(x), float32(z)
+	t := g.temperature.noise2(fx*0.0015, fz*0.0015, 2, 0.5, 2)
+	h := g.humidity.noise2(fx*0.0015, fz*0.0015, 2, 0.5, 2)
+	m := g.mountain.noise2(fx*0.002, fz*0.002, 3, 0.5, 2)
+	return pickBiome(t, h, m)
+}
+
+func (g *biomeGenerator) column(x, z int) terrainColumn {
+	// blend height of neighbour biomes, so borders are slopes instead of cliffs
+	const step = 8
+	var base, amplitude float32
+	for ox := -1; ox <= 1; ox++ {
+		for oz := -1; oz <= 1; oz++ {
+			desc := &biomes[g.climate(x+ox*step, z+oz*step)]
+			base += desc.base
+			amplitude += desc.amplitude
+		}
+	}
+	base, amplitude = base/9, amplitude/9
+
+	n := g.height.noise2(float32(x)*0.01, float32(z)*0.01, 4, 0.5, 2)
+	// noise gathers around 0.5, stretch it to use the whole amplitude
+	n = clamp((n-0.5)*2+0.5, 0, 1)
+	return terrainColumn{
+		height: int(base + amplitude*n),
+		biome:  g.climate(x, z),
+	}
+}
+
+// columnBlocks returns surface and filler block of a column
+func columnBlocks(col terrainColumn) (BlockType, BlockType) {
+	desc := &biomes[col.biome]
+	surface, filler := desc.surface, desc.filler
+	switch {
+	case col.height <= seaLevel:
+		surface, filler = sandBlock, sandBlock
+	case desc.snowLine != 0 && col.height >= desc.snowLine:
+		surface, filler = snowBlock, stoneBlock
+	case desc.rockLine != 0 && col.height >= desc.rockLine:
+		surface, filler = stoneBlock, stoneBlock
+	}
+	return surface, filler
+}
+
+// surfaceHeight returns y of surface block, low columns are raised to sea level beach
+func (col terrainColumn) surfaceHeight() int {
+	if col.height < seaLevel {
+		return seaLevel
+	}
+	return col.height
+}
+
+func (g *biomeGenerator) Chunk(cid ChunkID) []BlockType {
+	m := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
+	cols := g.chunkColumns(cid.X, cid.Z)
+	startY, endY := cid.Y*ChunkWidth, (cid.Y+1)*ChunkWidth-1
+
+	// layers: surface, filler, stone and bottom
+	maxHeight := seaLevel
+	for dz := 0; dz < ChunkWidth; dz++ {
+		for dx := 0; dx < ChunkWidth; dx++ {
+			x, z := cid.X*ChunkWidth+dx, cid.Z*ChunkWidth+dz
+			col := cols[dx+dz*ChunkWidth]
+			h := col.surfaceHeight()
+			if h > maxHeight {
+				maxHeight = h
+			}
+			depth := biomes[col.biome].fillerDepth
+			surface, filler := columnBlocks(col)
+			for y := startY; y <= endY && y <= h; y++ {
+				w := stoneBlock
+				switch {
+				case y < 0:
+					continue
+				case y == 0:
+					w = bottomBlock
+				case y == h:
+					w = surface
+				case y > h-depth:
+					w = filler
+				}
+				m[BlockID{x, y, z}.ToIndex()] = w
+			}
+		}
+	}
+
+	// ores and caves
+	if startY <= maxHeight && endY >= 0 {
+		g.placeOres(cid, m)
+		carver := g.newCaveCarver(cid)
+		for dz := 0; dz < ChunkWidth; dz++ {
+			for dx := 0; dx < ChunkWidth; dx++ {
+				h := cols[dx+dz*ChunkWidth].surfaceHeight()
+				for dy := 0; dy < ChunkWidth && startY+dy <= h; dy++ {
+					if carver.carved(dx, dy, dz, h) {
+						x, z := cid.X*ChunkWidth+dx, cid.Z*ChunkWidth+dz
+						m[BlockID{x, startY + dy, z}.ToIndex()] = 0
+					}
+				}
+			}
+		}
+	}
+
+	// surface of the chunk below decides plants on the bottom layer
+	var below *caveCarver
+	surfaceCarved := func(dx, dz, h int) bool {
+		if h >= startY {
+			return m[BlockID{cid.X*ChunkWidth + dx, h, cid.Z*ChunkWidth + dz}.ToIndex()] == 0
+		}
+		if below == nil {
+			below = g.newCaveCarver(cid.Down())
+		}
+		return below.carved(dx, h-startY+ChunkWidth, dz, h)
+	}
+
+	for dz := 0; dz < ChunkWidth; dz++ {
+		for dx := 0; dx < ChunkWidth; dx++ {
+			x, z := cid.X*ChunkWidth+dx, cid.Z*ChunkWidth+dz
+			col := cols[dx+dz*ChunkWidth]
+			h := col.surfaceHeight()
+			desc := &biomes[col.biome]
+			surface, _ := columnBlocks(col)
+
+			// plants
+			if h+1 >= startY && h+1 <= endY && surface != stoneBlock &&
+				hashFloat(g.seed, x, 0, z) < desc.plants && !surfaceCarved(dx, dz, h) {
+				i := hash3(g.seed+1, x, 0, z) % uint64(len(desc.plantTypes))
+				m[BlockID{x, h + 1, z}.ToIndex()] = desc.plantTypes[i]
+			}
+		}
+	}
+
+	g.placeStructures(cid, m)
+
+	for dz := 0; dz < ChunkWidth; dz++ {
+		for dx := 0; dx < ChunkWidth; dx++ {
+			x, z := cid.X*ChunkWidth+dx, cid.Z*ChunkWidth+dz
+			// cloud
+			for y := 80; y < 88; y++ {
+				if y >= startY && y <= endY && g.cloud.noise3(float32(x)*0.01, float32(y)*0.1, float32(z)*0.01, 8, 0.5, 2) > 0.69 {
+					m[BlockID{x, y, z}.ToIndex()] = cloudBlock
+				}
+			}
+		}
+	}
+	return m
+}
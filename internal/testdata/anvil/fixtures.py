@@ -0,0 +1,115 @@
+#!/usr/bin/env python3
+# Writes the Minecraft region files of anvil_test.go with an encoder of its own,
+# so the reader is not only checked against the writer it ships with.
+import gzip, struct, zlib
+
+BYTE, INT, LONG, STRING, LIST, COMPOUND, LONG_ARRAY = 1, 3, 4, 8, 9, 10, 12
+
+class Byte(int): pass
+class Int(int): pass
+class Long(int): pass
+class Longs(list): pass
+
+def tag(v):
+    return {Byte: BYTE, Int: INT, Long: LONG, Longs: LONG_ARRAY, str: STRING, list: LIST, dict: COMPOUND}[type(v)]
+
+def payload(v):
+    t = tag(v)
+    if t == BYTE: return struct.pack('>b', v)
+    if t == INT: return struct.pack('>i', v)
+    if t == LONG: return struct.pack('>q', v)
+    if t == STRING:
+        b = v.encode()
+        return struct.pack('>H', len(b)) + b
+    if t == LONG_ARRAY: return struct.pack('>i', len(v)) + b''.join(struct.pack('>q', x) for x in v)
+    if t == LIST: return struct.pack('>bi', tag(v[0]) if v else 0, len(v)) + b''.join(payload(x) for x in v)
+    return b''.join(struct.pack('>b', tag(x)) + payload(k) + payload(x) for k, x in v.items()) + b'\0'
+
+def nbt(root):
+    return struct.pack('>b', COMPOUND) + payload('') + payload(root)
+
+def signed(x):
+    return x - (1 << 64) if x >= 1 << 63 else x
+
+def pack(indexes, n, span):
+    bits = max(4, (n - 1).bit_length())
+    if span:
+        total = 0
+        for i, v in enumerate(indexes):
+            total |= v << (i * bits)
+        count = (len(indexes) * bits + 63) // 64
+        return Longs(signed((total >> (64 * i)) & ((1 << 64) - 1)) for i in range(count))
+    per = 64 // bits
+    longs = [0] * ((len(indexes) + per - 1) // per)
+    for i, v in enumerate(indexes):
+        longs[i // per] |= v << (i % per * bits)
+    return Longs(signed(x) for x in longs)
+
+def section(f):
+    # index (y*16+z)*16+x
+    return [f(i % 16, i // 256, i // 16 % 16) for i in range(4096)]
+
+def palette(*states):
+    out = []
+    for s in states:
+        name, _, props = s.partition('[')
+        e = {'Name': 'minecraft:' + name}
+        if props:
+            e['Properties'] = dict(p.split('=') for p in props.rstrip(']').split(','))
+        out.append(e)
+    return out
+
+def region(path, chunks):
+    # chunks: {(x, z) in region: (compression, root)}
+    header, times, body, sector = bytearray(4096), bytearray(4096), b'', 2
+    for (x, z), (kind, root) in sorted(chunks.items()):
+        data = nbt(root)
+        data = {1: lambda b: gzip.compress(b, mtime=0), 2: zlib.compress, 3: lambda b: b}[kind](data)
+        record = struct.pack('>ib', len(data) + 1, kind) + data
+        record += b'\0' * (-len(record) % 4096)
+        n = len(record) // 4096
+        struct.pack_into('>I', header, (x + z * 32) * 4, sector << 8 | n)
+        struct.pack_into('>I', times, (x + z * 32) * 4, 1700000000)
+        body += record
+        sector += n
+    with open(path, 'wb') as f:
+        f.write(bytes(header) + bytes(times) + body)
+
+SEVENTEEN = ['air', 'stone', 'dirt', 'sand', 'bricks', 'oak_planks', 'cobblestone', 'glass', 'glowstone', 'deepslate',
+             'chest', 'oak_leaves', 'snow_block', 'smooth_stone', 'grass_block', 'white_wool', 'diamond_ore']
+
+def layers(x, y, z):
+    if y == 0: return 1
+    if (x, y, z) == (5, 1, 7): return 2
+    if (x, y, z) == (6, 1, 7): return 3
+    if (x, y, z) == (2, 2, 3): return 4
+    return 0
+
+# Minecraft 1.20: chunks 1, -1 and 0, -32
+region('r.0.-1.mca', {
+    (1, 31): (2, {'DataVersion': Int(3465), 'xPos': Int(1), 'zPos': Int(-1), 'yPos': Int(-4), 'Status': 'minecraft:full', 'sections': [
+        {'Y': Byte(3), 'block_states': {'palette': palette('stone')}},
+        {'Y': Byte(4), 'block_states': {
+            'palette': palette('air', 'stone', 'oak_log[axis=y]', 'oak_log[axis=x]', 'diamond_block'),
+            'data': pack(section(layers), 5, False)}},
+        {'Y': Byte(5), 'block_states': {'palette': palette('air')}},
+    ]}),
+    (0, 0): (1, {'DataVersion': Int(3465), 'xPos': Int(0), 'zPos': Int(-32), 'sections': [
+        {'Y': Byte(-4), 'block_states': {
+            'palette': palette(*SEVENTEEN),
+            'data': pack(section(lambda x, y, z: (x + 3 * y + 5 * z) % 17), 17, False)}},
+    ]}),
+})
+
+# Minecraft 1.14, indexes span longs: chunk -1, 0. Minecraft 1.16: chunk -2, 0
+region('r.-1.0.mca', {
+    (31, 0): (3, {'DataVersion': Int(1976), 'Level': {'xPos': Int(-1), 'zPos': Int(0), 'Sections': [
+        {'Y': Byte(-1), 'SkyLight': [Byte(0)]},
+        {'Y': Byte(0), 'Palette': palette(*SEVENTEEN),
+         'BlockStates': pack(section(lambda x, y, z: (2 * x + y + 7 * z) % 17), 17, True)},
+    ]}}),
+    (30, 0): (2, {'DataVersion': Int(2586), 'Level': {'xPos': Int(-2), 'zPos': Int(0), 'Sections': [
+        {'Y': Byte(1), 'Palette': palette(*SEVENTEEN[:5]),
+         'BlockStates': pack(section(lambda x, y, z: (x + y + z) % 5), 5, False)},
+    ]}}),
+})
@@ -3,32 +3,21 @@ package internal
 type BlockType uint16
 
 func (bt BlockType) IsPlant() bool {
-	if bt >= 17 && bt <= 31 {
-		return true
-	}
-	return false
+	return registry.Def(bt).Shape == ShapePlant
 }
 
 func (bt BlockType) IsTransparent() bool {
-	if bt.IsPlant() {
-		return true
-	}
-	switch bt {
-	case 0, 10, 15:
-		return true
-	default:
-		return false
-	}
+	return registry.Def(bt).Transparent
 }
 
 func (bt BlockType) IsObstacle() bool {
-	if bt.IsPlant() {
-		return false
-	}
-	switch bt {
-	case 0:
-		return false
-	default:
-		return true
-	}
+	return registry.Def(bt).Collide
+}
+
+func (bt BlockType) Shape() BlockShape {
+	return registry.Def(bt).Shape
+}
+
+func (bt BlockType) Texture() *BlockTexture {
+	return registry.Def(bt).texture
 }
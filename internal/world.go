@@ -1,28 +1,46 @@
 package internal
 
 import (
+	"flag"
 	"log"
 	"sync"
 
-	"github.com/go-gl/mathgl/mgl32"
 	lru "github.com/hashicorp/golang-lru"
 )
 
+var (
+	// also sizes the chunk cache of World
+	renderRadius = flag.Int("r", 6, "render radius")
+)
+
 type World struct {
 	mutex  sync.Mutex
 	chunks *lru.Cache // map[ChunkID]*Chunk
 	store  IStore
+	gen    Generator
+
+	lightOn    bool
+	lightMutex sync.Mutex // guards light maps of chunks, and their blocks if light is on
+
+	editMutex sync.Mutex
+	edits     map[ChunkID]int64 // number of edits of each chunk, loaded or not
 }
 
-func NewWorld(store IStore) *World {
+func NewWorld(store IStore, gen Generator) *World {
 	m := (*renderRadius) * (*renderRadius) * (*renderRadius) * 4
 	chunks, _ := lru.New(m)
 	return &World{
 		chunks: chunks,
 		store:  store,
+		gen:    gen,
+		edits:  make(map[ChunkID]int64),
 	}
 }
 
+func (w *World) Generator() Generator {
+	return w.gen
+}
+
 func (w *World) loadChunk(id ChunkID) (*Chunk, bool) {
 	chunk, ok := w.chunks.Get(id)
 	if !ok {
@@ -35,60 +53,6 @@ func (w *World) storeChunk(id ChunkID, chunk *Chunk) {
 	w.chunks.Add(id, chunk)
 }
 
-func (w *World) Collide(pos mgl32.Vec3) (mgl32.Vec3, bool) {
-	x, y, z := pos.X(), pos.Y(), pos.Z()
-	nx, ny, nz := round(pos.X()), round(pos.Y()), round(pos.Z())
-	const pad = 0.25
-
-	head := BlockID{int(nx), int(ny), int(nz)}
-	foot := head.Down()
-
-	stop := false
-	for _, b := range []BlockID{foot, head} {
-		if w.Block(b.Left()).IsObstacle() && x < nx && nx-x > pad {
-			x = nx - pad
-		}
-		if w.Block(b.Right()).IsObstacle() && x > nx && x-nx > pad {
-			x = nx + pad
-		}
-		if w.Block(b.Down()).IsObstacle() && y < ny && ny-y > pad {
-			y = ny - pad
-			stop = true
-		}
-		if w.Block(b.Up()).IsObstacle() && y > ny && y-ny > pad {
-			y = ny + pad
-			stop = true
-		}
-		if w.Block(b.Back()).IsObstacle() && z < nz && nz-z > pad {
-			z = nz - pad
-		}
-		if w.Block(b.Front()).IsObstacle() && z > nz && z-nz > pad {
-			z = nz + pad
-		}
-	}
-	return mgl32.Vec3{x, y, z}, stop
-}
-
-func (w *World) HitTest(pos mgl32.Vec3, vec mgl32.Vec3) (*BlockID, *BlockID) {
-	var (
-		maxLen = float32(8.0)
-		step   = float32(0.125)
-
-		block, prev BlockID
-		pprev       *BlockID
-	)
-
-	for len := float32(0); len < maxLen; len += step {
-		block = NearBlock(pos.Add(vec.Mul(len)))
-		if prev != block && w.HasBlock(block) {
-			return &block, pprev
-		}
-		prev = block
-		pprev = &prev
-	}
-	return nil, nil
-}
-
 func (w *World) Block(id BlockID) BlockType {
 	chunk := w.BlockChunk(id)
 	if chunk == nil {
@@ -116,23 +80,85 @@ func (w *World) Chunk(cid ChunkID) *Chunk {
 	if ok {
 		return p
 	}
-	chunk := NewChunk(cid)
+	chunk := w.readChunk(cid)
+	if chunk == nil {
+		return nil
+	}
+	if w.lightOn {
+		return w.lightChunk(chunk)
+	}
+	w.storeChunk(cid, chunk)
+	return chunk
+}
 
-	// check chunk is saved
-	blocks, err := w.store.ChunkBlocks(cid)
+// readChunk returns generated chunk cid with saved edits on it
+func (w *World) readChunk(cid ChunkID) *Chunk {
+	chunk := NewChunk(cid)
+	blocks := w.gen.Chunk(cid)
+	err := w.store.RangeBlocks(cid, func(bid BlockID, tp BlockType) {
+		blocks[bid.ToIndex()] = tp
+	})
 	if err != nil {
 		log.Printf("fetch chunk(%v) from db error:%s", cid, err)
 		return nil
 	}
+	chunk.SetBlocks(blocks)
+	return chunk
+}
+
+// peekChunk returns chunk cid if it is loaded, or reads it without loading it,
+// so tools looking at the whole world do not push chunks of players out of the cache
+func (w *World) peekChunk(cid ChunkID) *Chunk {
+	if p, ok := w.chunks.Peek(cid); ok {
+		return p.(*Chunk)
+	}
+	return w.readChunk(cid)
+}
+
+func (w *World) edited(cid ChunkID) {
+	w.editMutex.Lock()
+	w.edits[cid]++
+	w.editMutex.Unlock()
+}
+
+// editVersion returns number of blocks of chunk cid changed since w was made,
+// unlike Chunk.Version it counts edits of chunks which are not loaded, and is kept when chunks are loaded again
+func (w *World) editVersion(cid ChunkID) int64 {
+	w.editMutex.Lock()
+	defer w.editMutex.Unlock()
+	return w.edits[cid]
+}
 
-	// not saved, then create raw map
-	if blocks == nil {
-		blocks = makeChunkMap(cid)
+// UpdateBlock sets block id to tp and saves the edit to store
+func (w *World) UpdateBlock(id BlockID, tp BlockType) error {
+	chunk := w.BlockChunk(id)
+	if chunk != nil {
+		w.addBlock(chunk, id, tp)
 	}
+	err := w.store.UpdateBlock(id, tp)
+	// counted once the edit can be read
+	w.edited(id.ChunkID())
+	return err
+}
 
-	chunk.SetBlocks(blocks)
-	w.storeChunk(cid, chunk)
-	return chunk
+// SetBlock sets block id of loaded chunk to tp without saving it, for blocks changed by other players
+func (w *World) SetBlock(id BlockID, tp BlockType) {
+	chunk := w.BlockChunk(id)
+	if chunk == nil {
+		return
+	}
+	w.addBlock(chunk, id, tp)
+	w.edited(id.ChunkID())
+
+	// faces of neighbour chunks may be shown or hidden
+	cid := id.ChunkID()
+	for _, neighbor := range []BlockID{id.Left(), id.Right(), id.Front(), id.Back(), id.Up(), id.Down()} {
+		if ncid := neighbor.ChunkID(); ncid != cid {
+			if chunk, ok := w.loadChunk(ncid); ok {
+				chunk.UpdateVersion()
+			}
+		}
+	}
 }
 
 func (w *World) Chunks(cids []ChunkID) []*Chunk {
@@ -151,85 +177,3 @@ func (w *World) Chunks(cids []ChunkID) []*Chunk {
 	}
 	return chunks
 }
-
-func makeChunkMap(cid ChunkID) []BlockType {
-	const (
-		grassBlock = 1
-		sandBlock  = 2
-		grass      = 17
-		leaves     = 15
-		wood       = 5
-	)
-	m := make([]BlockType, ChunkWidth*ChunkWidth*ChunkWidth)
-	startY, endY := cid.Y*ChunkWidth, (cid.Y+1)*ChunkWidth-1
-	p, q := cid.X, cid.Z
-	for dx := 0; dx < ChunkWidth; dx++ {
-		for dz := 0; dz < ChunkWidth; dz++ {
-			x, z := p*ChunkWidth+dx, q*ChunkWidth+dz
-			f := noise2(float32(x)*0.01, float32(z)*0.01, 4, 0.5, 2)
-			g := noise2(float32(-x)*0.01, float32(-z)*0.01, 2, 0.9, 2)
-			mh := int(g*32 + 16)
-			h := int(f * float32(mh))
-			var w BlockType = grassBlock
-			if h <= 12 {
-				h = 12
-				w = sandBlock
-			}
-
-			// grass and sand
-			for y := 0; y < h; y++ {
-				if y >= startY && y <= endY {
-					m[BlockID{x, y, z}.ToIndex()] = w
-				}
-			}
-
-			// flowers
-			if h >= startY && h <= endY {
-				if w == grassBlock {
-					if noise2(-float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2) > 0.6 {
-						m[BlockID{x, h, z}.ToIndex()] = grass
-					}
-					if noise2(float32(x)*0.05, float32(-z)*0.05, 4, 0.8, 2) > 0.7 {
-						w := BlockType(18 + int(noise2(float32(x)*0.1, float32(z)*0.1, 4, 0.8, 2)*7))
-						m[BlockID{x, h, z}.ToIndex()] = w
-					}
-				}
-			}
-
-			// tree
-			if w == 1 {
-				ok := true
-				if dx-4 < 0 || dz-4 < 0 ||
-					dx+4 > ChunkWidth || dz+4 > ChunkWidth {
-					ok = false
-				}
-				if ok && noise2(float32(x), float32(z), 6, 0.5, 2) > 0.79 {
-					for y := h + 3; y < h+8; y++ {
-						for ox := -3; ox <= 3; ox++ {
-							for oz := -3; oz <= 3; oz++ {
-								d := ox*ox + oz*oz + (y-h-4)*(y-h-4)
-								if d < 11 {
-									if y >= startY && y <= endY {
-										m[BlockID{x + ox, y, z + oz}.ToIndex()] = leaves
-									}
-								}
-							}
-						}
-					}
-					for y := h; y < h+7; y++ {
-						if y >= startY && y <= endY {
-						}
-					}
-				}
-			}
-
-			// cloud
-			for y := 64; y < 72; y++ {
-				if y >= startY && y <= endY && noise3(float32(x)*0.01, float32(y)*0.1, float32(z)*0.01, 8, 0.5, 2) > 0.69 {
-					m[BlockID{x, y, z}.ToIndex()] = 16
-				}
-			}
-		}
-	}
-	return m
-}
@@ -11,7 +11,47 @@ import (
 func TestWorld_Init(t *testing.T) {
 	assert.True(t, true, "true")
 	store := &gocrafttest.StoreMock{}
-	world := NewWorld(store)
+	world := NewWorld(store, newTestGenerator(t))
 
 	assert.NotNil(t, world, "not nil")
 }
+
+func TestWorld_ChunkWithOverrides(t *testing.T) {
+	store := gocrafttest.NewStoreMock()
+	world := NewWorld(store, newTestGenerator(t))
+
+	ground := BlockID{X: 0, Y: 0, Z: 0}
+	sky := BlockID{X: 1, Y: 30, Z: 1}
+	assert.NotEqual(t, BlockType(0), world.Chunk(ground.ChunkID()).Block(ground))
+	assert.Equal(t, BlockType(0), world.Chunk(sky.ChunkID()).Block(sky))
+
+	store.Add(ground, 0)
+	store.Add(sky, 5)
+	world = NewWorld(store, newTestGenerator(t))
+	assert.Equal(t, BlockType(0), world.Chunk(ground.ChunkID()).Block(ground))
+	assert.Equal(t, BlockType(5), world.Chunk(sky.ChunkID()).Block(sky))
+}
+
+func TestWorld_UpdateBlock(t *testing.T) {
+	store := gocrafttest.NewStoreMock()
+	world := NewWorld(store, newTestGenerator(t))
+
+	bid := BlockID{X: 1, Y: 30, Z: 1}
+	chunk := world.Chunk(bid.ChunkID())
+	assert.Nil(t, world.UpdateBlock(bid, 3))
+	assert.Equal(t, BlockType(3), chunk.Block(bid))
+
+	saved := make(map[BlockID]BlockType)
+	store.RangeBlocks(bid.ChunkID(), func(id BlockID, w BlockType) {
+		saved[id] = w
+	})
+	assert.Equal(t, map[BlockID]BlockType{bid: 3}, saved)
+}
+
+func newTestGenerator(t *testing.T) Generator {
+	gen, err := NewGenerator("classic", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"sync"
+
+	_ "image/png"
+)
+
+var (
+	mapTop = flag.Int("maptop", 128, "highest block drawn on maps")
+)
+
+// MapColors : color of each block type seen from above
+type MapColors struct {
+	blocks  []color.RGBA // indexed by BlockType
+	unknown color.RGBA
+}
+
+// LoadMapColors reads the texture atlas of -t file
+func LoadMapColors() (*MapColors, error) {
+	f, err := os.Open(*texturePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	atlas, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapColors(atlas), nil
+}
+
+// NewMapColors averages the tile of each registered block seen from above in atlas,
+// the top of cubes and the side of plants, magenta texels are holes and left out
+func NewMapColors(atlas image.Image) *MapColors {
+	c := &MapColors{
+		blocks:  make([]color.RGBA, len(registry.defs)),
+		unknown: tileColor(atlas, unknownDef.mapTile()),
+	}
+	for i := range c.blocks {
+		def := registry.Def(BlockType(i))
+		if def.Shape != ShapeNone {
+			c.blocks[i] = tileColor(atlas, def.mapTile())
+		}
+	}
+	return c
+}
+
+// Color returns color of block w
+func (c *MapColors) Color(w BlockType) color.RGBA {
+	if int(w) < len(c.blocks) {
+		return c.blocks[w]
+	}
+	return c.unknown
+}
+
+// mapTile returns tile of d seen from above
+func (d *BlockDef) mapTile() int {
+	if len(d.Tiles) == 1 {
+		return d.Tiles[0]
+	}
+	if d.Shape == ShapePlant {
+		// front
+		return d.Tiles[4]
+	}
+	// top
+	return d.Tiles[2]
+}
+
+// tileColor averages texels of tile idx of atlas, row 0 of tiles is at the bottom of the image
+func tileColor(atlas image.Image, idx int) color.RGBA {
+	b := atlas.Bounds()
+	w, h := b.Dx()/textureColums, b.Dy()/textureColums
+	x0 := b.Min.X + idx%textureColums*w
+	y0 := b.Max.Y - (idx/textureColums+1)*h
+	var r, g, bl, n uint32
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			c := color.RGBAModel.Convert(atlas.At(x, y)).(color.RGBA)
+			if c.R == 255 && c.G == 0 && c.B == 255 {
+				continue
+			}
+			r += uint32(c.R)
+			g += uint32(c.G)
+			bl += uint32(c.B)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+}
+
+// RenderMap draws columns x0 to x1 and z0 to z1 of w seen from above, one pixel a column,
+// x grows to the right and z downwards. Each column has the color of its top block below -maptop,
+// brighter on high ground and on slopes facing north, empty columns are transparent
+func RenderMap(w *World, colors *MapColors, x0, z0, x1, z1 int) *image.RGBA {
+	return sampleMap(w, x0, z0, x1, z1).image(colors)
+}
+
+// mapRegion : top blocks of the columns of a region
+type mapRegion struct {
+	x0, z0, x1, z1 int
+
+	heights []int // -1 for empty columns
+	tops    []BlockType
+	// edit versions of chunks when the region was sampled, 0 is left out
+	versions map[ChunkID]int64
+}
+
+// sampleMap finds top blocks of columns x0 to x1 and z0 to z1 of w, chunks not loaded are read without loading them
+func sampleMap(w *World, x0, z0, x1, z1 int) *mapRegion {
+	width, depth := x1-x0+1, z1-z0+1
+	r := &mapRegion{
+		x0: x0, z0: z0, x1: x1, z1: z1,
+		heights:  make([]int, width*depth),
+		tops:     make([]BlockType, width*depth),
+		versions: make(map[ChunkID]int64),
+	}
+	for i := range r.heights {
+		r.heights[i] = -1
+	}
+
+	top := BlockID{0, *mapTop - 1, 0}.ChunkID().Y
+	for cz := (BlockID{0, 0, z0}).ChunkID().Z; cz <= (BlockID{0, 0, z1}).ChunkID().Z; cz++ {
+		for cx := (BlockID{x0, 0, 0}).ChunkID().X; cx <= (BlockID{x1, 0, 0}).ChunkID().X; cx++ {
+			// chunks of the column are read at once, then searched from the top
+			chunks := make([]*Chunk, top+1)
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			for cy := top; cy >= 0; cy-- {
+				wg.Add(1)
+				go func(cy int) {
+					defer wg.Done()
+					cid := ChunkID{cx, cy, cz}
+					// an edit while the chunk is read makes the region stale
+					version := w.editVersion(cid)
+					chunks[cy] = w.peekChunk(cid)
+					if version != 0 {
+						mutex.Lock()
+						r.versions[cid] = version
+						mutex.Unlock()
+					}
+				}(cy)
+			}
+			wg.Wait()
+			for cy := top; cy >= 0; cy-- {
+				if chunks[cy] != nil {
+					r.sample(chunks[cy])
+				}
+			}
+		}
+	}
+	return r
+}
+
+// sample fills top blocks of columns in the region not found in chunks above c
+func (r *mapRegion) sample(c *Chunk) {
+	width := r.x1 - r.x0 + 1
+	id := c.ID()
+	for z := id.Z * ChunkWidth; z < (id.Z+1)*ChunkWidth; z++ {
+		for x := id.X * ChunkWidth; x < (id.X+1)*ChunkWidth; x++ {
+			if x < r.x0 || x > r.x1 || z < r.z0 || z > r.z1 {
+				continue
+			}
+			i := (x - r.x0) + (z-r.z0)*width
+			if r.heights[i] >= 0 {
+				continue
+			}
+			for y := (id.Y+1)*ChunkWidth - 1; y >= id.Y*ChunkWidth; y-- {
+				if y >= *mapTop {
+					continue
+				}
+				if tp := c.Block(BlockID{x, y, z}); tp != 0 {
+					r.heights[i], r.tops[i] = y, tp
+					break
+				}
+			}
+		}
+	}
+}
+
+// image draws the region with colors
+func (r *mapRegion) image(colors *MapColors) *image.RGBA {
+	width, depth := r.x1-r.x0+1, r.z1-r.z0+1
+	img := image.NewRGBA(image.Rect(0, 0, width, depth))
+	for z := 0; z < depth; z++ {
+		for x := 0; x < width; x++ {
+			h := r.heights[x+z*width]
+			if h < 0 {
+				continue
+			}
+			// neighbour to the north, or the column itself on the first row
+			north := h
+			if z > 0 && r.heights[x+(z-1)*width] >= 0 {
+				north = r.heights[x+(z-1)*width]
+			}
+			img.SetRGBA(x, z, shade(colors.Color(r.tops[x+z*width]), h, north))
+		}
+	}
+	return img
+}
+
+// stale returns whether a block of the region has been edited since the region was sampled
+func (r *mapRegion) stale(w *World) bool {
+	top := BlockID{0, *mapTop - 1, 0}.ChunkID().Y
+	for cz := (BlockID{0, 0, r.z0}).ChunkID().Z; cz <= (BlockID{0, 0, r.z1}).ChunkID().Z; cz++ {
+		for cx := (BlockID{r.x0, 0, 0}).ChunkID().X; cx <= (BlockID{r.x1, 0, 0}).ChunkID().X; cx++ {
+			for cy := 0; cy <= top; cy++ {
+				cid := ChunkID{cx, cy, cz}
+				if w.editVersion(cid) != r.versions[cid] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// shade darkens low ground and slopes facing south, h is height of the column and north of the one north of it
+func shade(c color.RGBA, h, north int) color.RGBA {
+	f := 0.7 + 0.5*float32(h)/float32(*mapTop)
+	switch {
+	case h > north:
+		f *= 1.15
+	case h < north:
+		f *= 0.85
+	}
+	scale := func(v uint8) uint8 {
+		s := float32(v) * f
+		if s > 255 {
+			return 255
+		}
+		return uint8(s)
+	}
+	return color.RGBA{scale(c.R), scale(c.G), scale(c.B), c.A}
+}
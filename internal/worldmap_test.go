@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	magenta = color.RGBA{255, 0, 255, 255}
+	red     = color.RGBA{200, 0, 0, 255}
+	blue    = color.RGBA{0, 0, 200, 255}
+)
+
+// testAtlas returns atlas of 2x2 texel tiles, tile idx is filled with colors[idx] if it is set
+func testAtlas(colors map[int]color.RGBA) *image.RGBA {
+	const size = 2 * textureColums
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for idx, c := range colors {
+		// row 0 of tiles is at the bottom
+		x, y := idx%textureColums*2, size-2-idx/textureColums*2
+		img.SetRGBA(x, y, c)
+		img.SetRGBA(x+1, y, c)
+		img.SetRGBA(x, y+1, c)
+		img.SetRGBA(x+1, y+1, c)
+	}
+	return img
+}
+
+func TestMap_TileColor(t *testing.T) {
+	img := testAtlas(map[int]color.RGBA{1: red, 17: blue})
+	assert.Equal(t, red, tileColor(img, 1))
+	assert.Equal(t, blue, tileColor(img, 17))
+
+	// holes are left out
+	img.SetRGBA(2, 2*textureColums-1, magenta)
+	assert.Equal(t, red, tileColor(img, 1))
+}
+
+func TestMap_BlockColors(t *testing.T) {
+	grass := registry.Def(grassBlock)
+	colors := NewMapColors(testAtlas(map[int]color.RGBA{grass.Tiles[2]: red, grass.Tiles[0]: blue}))
+	// grass is seen from the top
+	assert.Equal(t, red, colors.Color(grassBlock))
+	assert.Equal(t, color.RGBA{}, colors.Color(0))
+	assert.Equal(t, colors.Color(BlockType(len(registry.defs))), colors.Color(BlockType(len(registry.defs)+1)))
+}
+
+func TestMap_Render(t *testing.T) {
+	store, done := newTestStore(t)
+	defer done()
+	w := NewWorld(store, &flatGenerator{})
+	stone, brick := registry.Def(stoneBlock), registry.Def(brickBlock)
+	colors := NewMapColors(testAtlas(map[int]color.RGBA{stone.mapTile(): red, brick.mapTile(): blue}))
+	assert.Nil(t, w.UpdateBlock(BlockID{33, 40, 2}, brickBlock))
+
+	img := RenderMap(w, colors, 30, 0, 35, 4)
+	assert.Equal(t, image.Rect(0, 0, 6, 5), img.Bounds())
+
+	flat := img.RGBAAt(0, 0)
+	assert.Equal(t, shade(red, 9, 9), flat)
+	assert.Equal(t, flat, img.RGBAAt(5, 4))
+	// the brick column across the chunk border is higher than the ground north of it, the one south lower
+	assert.Equal(t, shade(blue, 40, 9), img.RGBAAt(3, 2))
+	assert.True(t, img.RGBAAt(3, 2).B > shade(blue, 9, 9).B)
+	assert.True(t, img.RGBAAt(3, 3).R < flat.R)
+}
@@ -2,54 +2,142 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
-	"time"
-
-	_ "image/png"
+	"os"
+	"os/signal"
+	"strings"
 
 	"net/http"
 	_ "net/http/pprof"
 
 	. "github.com/cLazyZombie/gocraft/internal"
-	"github.com/faiface/mainthread"
 )
 
 var (
-	pprofPort = flag.String("pprof", "", "http pprof port")
+	pprofPort  = flag.String("pprof", "", "http pprof port")
+	webMap     = flag.Bool("webmap", false, "serve a map of the world at /map/ on the -pprof port")
+	listenAddr = flag.String("listen", ":4080", "server listen address")
 )
 
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [play|server|map|export|import|mcimport|mcexport|copy|paste] [flags] [args]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	flag.Parse()
+
+	// first argument which is not a flag is the command
+	cmd, args := "play", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
+
 	go func() {
 		if *pprofPort != "" {
 			log.Fatal(http.ListenAndServe(*pprofPort, nil))
 		}
 	}()
-	mainthread.Run(run)
+
+	switch cmd {
+	case "play":
+		play()
+	case "server":
+		serve()
+	case "map":
+		drawMap()
+	case "export":
+		exitOnError(exportWorld())
+	case "import":
+		exitOnError(importWorld())
+	case "mcimport":
+		importMinecraft()
+	case "mcexport":
+		exportMinecraft()
+	case "copy":
+		copyBlocks()
+	case "paste":
+		pasteBlocks()
+	default:
+		usage()
+		os.Exit(2)
+	}
 }
 
-func run() {
-	err := LoadTextureDesc()
+// exitOnError exits with err if it is not nil, commands return it once the store is closed
+func exitOnError(err error) {
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+// openWorld opens world of -db file, GlobalStore should be closed after use
+func openWorld() (*World, error) {
+	err := InitStore()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for err := range GlobalStore.Errors() {
+			log.Printf("save blocks error:%s", err)
+		}
+	}()
 
-	err = InitStore()
+	gen, err := OpenGenerator(GlobalStore)
+	if err != nil {
+		GlobalStore.Close()
+		return nil, err
+	}
+	log.Printf("generator %s, seed %d", gen.Name(), gen.Seed())
+	return NewWorld(GlobalStore, gen), nil
+}
+
+func serve() {
+	err := LoadBlocks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	world, err := openWorld()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer GlobalStore.Close()
 
-	game, err := NewGame(800, 600)
+	server := NewServer(world)
+	serveMap(world, server.Players)
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		log.Printf("shutting down")
+		server.Close()
+	}()
+
+	log.Printf("listen on %s", *listenAddr)
+	err = server.ListenAndServe(*listenAddr)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
 	}
-	game.Camera().Restore(GlobalStore.GetCamera())
-	tick := time.Tick(time.Second / 60)
-	for !game.ShouldClose() {
-		<-tick
-		game.Update()
+}
+
+// serveMap serves map of world at /map/ of the pprof server if -webmap is set,
+// players returns players shown on the map
+func serveMap(world *World, players func() []Player) {
+	if !*webMap {
+		return
+	}
+	if *pprofPort == "" {
+		log.Printf("-webmap needs -pprof port")
+		return
+	}
+	colors, err := LoadMapColors()
+	if err != nil {
+		log.Printf("load map colors error:%s", err)
+		return
 	}
-	GlobalStore.UpdateCamera(game.Camera().State())
+	http.Handle("/map/", http.StripPrefix("/map", NewMapServer(world, colors, players)))
+	log.Printf("map on http://%s/map/", *pprofPort)
 }
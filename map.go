@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+)
+
+var (
+	mapRegion = flag.String("region", "-256,-256,255,255", "region x0,z0,x1,z1 in blocks of map and mcexport")
+	mapOutput = flag.String("o", "map.png", "map image file")
+)
+
+// parseRegion parses x0,z0,x1,z1, corners may be given in any order
+func parseRegion(s string) (x0, z0, x1, z1 int, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("bad region %q, need x0,z0,x1,z1", s)
+	}
+	var v [4]int
+	for i, part := range parts {
+		v[i], err = strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("bad region %q: %s", s, err)
+		}
+	}
+	x0, z0, x1, z1 = v[0], v[1], v[2], v[3]
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if z0 > z1 {
+		z0, z1 = z1, z0
+	}
+	return x0, z0, x1, z1, nil
+}
+
+// drawMap writes the map of -region of the world in -db to -o
+func drawMap() {
+	x0, z0, x1, z1, err := parseRegion(*mapRegion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = LoadBlocks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	colors, err := LoadMapColors()
+	if err != nil {
+		log.Fatal(err)
+	}
+	world, err := openWorld()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer GlobalStore.Close()
+
+	img := RenderMap(world, colors, x0, z0, x1, z1)
+	f, err := os.Create(*mapOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("map of %d,%d to %d,%d written to %s", x0, z0, x1, z1, *mapOutput)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+)
+
+var (
+	mcOffset = flag.String("mcoffset", "0,-50,0", "x,y,z added to Minecraft blocks, the default puts Minecraft's sea level on ours")
+)
+
+// parseBlockID parses x,y,z
+func parseBlockID(s string) (BlockID, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return BlockID{}, fmt.Errorf("bad block %q, need x,y,z", s)
+	}
+	var v [3]int
+	for i, part := range parts {
+		var err error
+		v[i], err = strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return BlockID{}, fmt.Errorf("bad block %q: %s", s, err)
+		}
+	}
+	return BlockID{X: v[0], Y: v[1], Z: v[2]}, nil
+}
+
+// loadAnvil loads blocks, the mapping of Minecraft blocks and -mcoffset
+func loadAnvil() (*AnvilMapping, BlockID) {
+	offset, err := parseBlockID(*mcOffset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := LoadBlocks(); err != nil {
+		log.Fatal(err)
+	}
+	m, err := LoadAnvilMapping()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m, offset
+}
+
+// regionFiles returns region files of the arguments, a directory stands for its .mca files,
+// or those of its region directory if it is a Minecraft world
+func regionFiles() []string {
+	if flag.NArg() == 0 {
+		log.Fatal("need region files or directories")
+	}
+	var files []string
+	for _, arg := range flag.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(arg, "region")); err == nil {
+			arg = filepath.Join(arg, "region")
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "r.*.*.mca"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// logUnmapped logs counts of unmapped blocks, most common first
+func logUnmapped(unmapped map[string]int) {
+	names := make([]string, 0, len(unmapped))
+	for name := range unmapped {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return unmapped[names[i]] > unmapped[names[j]] })
+	for _, name := range names {
+		log.Printf("unmapped %s: %d blocks", name, unmapped[name])
+	}
+}
+
+// importMinecraft reads Minecraft region files into the world in -db
+func importMinecraft() {
+	m, offset := loadAnvil()
+	files := regionFiles()
+	if err := InitStore(); err != nil {
+		log.Fatal(err)
+	}
+	defer GlobalStore.Close()
+
+	var total AnvilStats
+	for _, path := range files {
+		stats, err := GlobalStore.ImportAnvil(path, m, offset)
+		if err != nil {
+			log.Printf("import %s error:%s", path, err)
+			continue
+		}
+		log.Printf("%s: %d chunks imported", path, stats.Chunks)
+		total.Chunks += stats.Chunks
+		for name, n := range stats.Unmapped {
+			if total.Unmapped == nil {
+				total.Unmapped = make(map[string]int)
+			}
+			total.Unmapped[name] += n
+		}
+	}
+	logUnmapped(total.Unmapped)
+	log.Printf("%d chunks of %d region files imported", total.Chunks, len(files))
+}
+
+// exportMinecraft writes -region of the world in -db as Minecraft region files to the directory argument
+func exportMinecraft() {
+	if flag.NArg() != 1 {
+		log.Fatal("need one directory argument")
+	}
+	dir := flag.Arg(0)
+	x0, z0, x1, z1, err := parseRegion(*mapRegion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m, offset := loadAnvil()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	world, err := openWorld()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer GlobalStore.Close()
+
+	stats, err := ExportAnvil(world, m, dir, offset, x0, z0, x1, z1)
+	if err != nil {
+		log.Fatalf("export error:%s", err)
+	}
+	logUnmapped(stats.Unmapped)
+	log.Printf("%d chunks of %d,%d to %d,%d exported to %s", stats.Chunks, x0, z0, x1, z1, dir)
+}
@@ -0,0 +1,118 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	_ "image/png"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var (
+	serverAddr = flag.String("server", "", "play online on Craft server host:port")
+)
+
+func play() {
+	mainthread.Run(run)
+}
+
+func run() {
+	err := LoadBlocks()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		world  *World
+		client *Client
+	)
+	if *serverAddr != "" {
+		client, err = NewClient(*serverAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		store := NewRemoteStore(client)
+
+		// servers only send edited blocks, the terrain under them is generated here.
+		// A Craft server which does not tell its generator uses its own, which
+		// gocraft has not, so the classic terrain shown here won't match its edits
+		name, seed, ok := client.Generator()
+		if !ok {
+			log.Printf("server %s did not tell its generator, terrain may not match the server's", *serverAddr)
+			name, seed = "classic", 0
+		}
+		gen, err := NewGenerator(name, seed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("play on server %s, generator %s, seed %d", *serverAddr, name, seed)
+		world = NewWorld(store, gen)
+		store.OnChange(world.SetBlock)
+	} else {
+		world, err = openWorld()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer GlobalStore.Close()
+	}
+
+	game, err := NewGame(800, 600, world)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if client == nil {
+		game.Camera().Restore(GlobalStore.GetCamera())
+	} else {
+		game.SetClient(client)
+	}
+
+	// the web map shows where we are, and other players online
+	var me struct {
+		sync.Mutex
+		Player
+	}
+	me.Name = "me"
+	serveMap(world, func() []Player {
+		me.Lock()
+		players := []Player{me.Player}
+		me.Unlock()
+		if client != nil {
+			players = append(players, client.Players()...)
+		}
+		return players
+	})
+
+	tick := time.Tick(time.Second / 60)
+	posTick := time.Tick(time.Second / 10)
+	for !game.ShouldClose() {
+		<-tick
+		game.Update()
+		me.Lock()
+		pos, rx, ry := game.Camera().State()
+		me.Pos, me.Rx, me.Ry = pos, mgl32.DegToRad(rx), mgl32.DegToRad(ry)
+		me.Unlock()
+		if client == nil {
+			continue
+		}
+		select {
+		case <-posTick:
+			err = client.UpdatePosition(game.Camera().State())
+			if err != nil {
+				log.Printf("send position error:%s", err)
+			}
+		default:
+		}
+	}
+	if client == nil {
+		GlobalStore.UpdateCamera(game.Camera().State())
+	}
+}
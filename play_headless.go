@@ -0,0 +1,10 @@
+//go:build headless
+// +build headless
+
+package main
+
+import "log"
+
+func play() {
+	log.Fatal("gocraft is built headless, only the server command is available")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	. "github.com/cLazyZombie/gocraft/internal"
+)
+
+var (
+	copyBox      = flag.String("box", "", "box x0,y0,z0,x1,y1,z1 of blocks to copy")
+	pasteAt      = flag.String("at", "", "x,y,z of the lowest corner of pasted blocks")
+	pasteRotate  = flag.Int("rotate", 0, "degrees pasted blocks are turned clockwise seen from above, 0, 90, 180 or 270")
+	pasteMirror  = flag.Bool("mirror", false, "flip pasted blocks east to west, before turning them")
+	pasteSkipAir = flag.Bool("skipair", false, "keep blocks where pasted blocks are air")
+)
+
+// schematicPath returns the schematic file argument
+func schematicPath() string {
+	if flag.NArg() != 1 {
+		log.Fatal("need one schematic file argument")
+	}
+	return flag.Arg(0)
+}
+
+// parseBox parses x0,y0,z0,x1,y1,z1
+func parseBox(s string) (BlockID, BlockID, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 6 {
+		return BlockID{}, BlockID{}, fmt.Errorf("bad box %q, need x0,y0,z0,x1,y1,z1", s)
+	}
+	a, err := parseBlockID(strings.Join(parts[:3], ","))
+	if err != nil {
+		return BlockID{}, BlockID{}, err
+	}
+	b, err := parseBlockID(strings.Join(parts[3:], ","))
+	return a, b, err
+}
+
+// copyBlocks writes -box of the world in -db to the schematic file
+func copyBlocks() {
+	path := schematicPath()
+	a, b, err := parseBox(*copyBox)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := LoadBlocks(); err != nil {
+		log.Fatal(err)
+	}
+	world, err := openWorld()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer GlobalStore.Close()
+
+	s, err := CopySchematic(world, a, b)
+	if err == nil {
+		err = WriteSchematicFile(path, s, LoadSchematicMapping())
+	}
+	if err != nil {
+		log.Fatalf("copy error:%s", err)
+	}
+	log.Printf("%dx%dx%d blocks copied to %s", s.Width, s.Height, s.Length, path)
+}
+
+// pasteBlocks pastes the schematic file at -at of the world in -db
+func pasteBlocks() {
+	path := schematicPath()
+	at, err := parseBlockID(*pasteAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *pasteRotate%90 != 0 {
+		log.Fatalf("bad rotation %d, need a multiple of 90", *pasteRotate)
+	}
+	if err := LoadBlocks(); err != nil {
+		log.Fatal(err)
+	}
+	s, unmapped, err := ReadSchematicFile(path, LoadSchematicMapping())
+	if err != nil {
+		log.Fatal(err)
+	}
+	logUnmapped(unmapped)
+	if *pasteMirror {
+		s = s.Mirror()
+	}
+	s = s.Rotate(*pasteRotate / 90)
+
+	world, err := openWorld()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer GlobalStore.Close()
+	n, err := s.Paste(world, at, *pasteSkipAir)
+	if err != nil {
+		log.Printf("paste error:%s", err)
+	}
+	log.Printf("%d blocks of %dx%dx%d changed at %v", n, s.Width, s.Height, s.Length, at)
+}